@@ -2,19 +2,51 @@ package main
 
 import (
 	"flag"
+	"os"
 
 	"github.com/Spazzy757/credentials-rotator/pkg/config"
 	"github.com/Spazzy757/credentials-rotator/pkg/handlers"
 	log "github.com/sirupsen/logrus"
+
+	// sources and destinations register themselves
+	_ "github.com/Spazzy757/credentials-rotator/pkg/aws"
+	_ "github.com/Spazzy757/credentials-rotator/pkg/azure"
+	_ "github.com/Spazzy757/credentials-rotator/pkg/bitbucket"
+	_ "github.com/Spazzy757/credentials-rotator/pkg/file"
+	_ "github.com/Spazzy757/credentials-rotator/pkg/github"
+	_ "github.com/Spazzy757/credentials-rotator/pkg/gitlab"
+	_ "github.com/Spazzy757/credentials-rotator/pkg/google"
+	_ "github.com/Spazzy757/credentials-rotator/pkg/kubernetes"
+	_ "github.com/Spazzy757/credentials-rotator/pkg/sops"
+	_ "github.com/Spazzy757/credentials-rotator/pkg/vault"
 )
 
 var configHelpMessage = "The configuration file for credentials to rotate"
+var dryRunHelpMessage = "Show what would be rotated without changing anything"
+var forceHelpMessage = "Rotate every credential even if its key is younger than max_age"
+var outputHelpMessage = "The format of the dry run output (text or json)"
+
+// Exit codes so a CI job can tell a partial failure apart
+const (
+	exitSuccess        = 0
+	exitFailure        = 1
+	exitPartialFailure = 2
+)
 
 func main() {
 	// Flags
 	configFile := flag.String("config-file", "config.yaml", configHelpMessage)
+	dryRun := flag.Bool("dry-run", false, dryRunHelpMessage)
+	force := flag.Bool("force", false, forceHelpMessage)
+	output := flag.String("output", "text", outputHelpMessage)
 	flag.Parse()
 
+	if *output != "text" && *output != "json" {
+		log.WithFields(log.Fields{
+			"output": *output,
+		}).Fatal("invalid output format")
+	}
+
 	cfg := config.Config{}
 	err := cfg.LoadConfig(*configFile)
 	if err != nil {
@@ -22,13 +54,78 @@ func main() {
 			"error": err.Error(),
 		}).Fatal("config error")
 	}
-	err = handlers.ConfigHandler(&cfg)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error": err.Error(),
-		}).Fatal("runtime error")
+	cfg.Force = *force
+	if *dryRun {
+		os.Exit(plan(&cfg, *output))
 	}
+	results, err := handlers.ConfigHandler(&cfg)
+	for _, result := range results {
+		fields := log.Fields{
+			"credential": result.Credential.String(),
+			"status":     result.Status,
+		}
+		for _, dst := range result.Destinations {
+			switch {
+			case dst.Err != nil:
+				log.WithFields(log.Fields{
+					"credential":  result.Credential.String(),
+					"destination": dst.Destination.String(),
+					"error":       dst.Err.Error(),
+				}).Error("destination failed")
+			case dst.Version != "":
+				log.WithFields(log.Fields{
+					"credential":  result.Credential.String(),
+					"destination": dst.Destination.String(),
+					"version":     dst.Version,
+				}).Info("destination written")
+			}
+		}
+		if result.Err != nil {
+			fields["error"] = result.Err.Error()
+			log.WithFields(fields).Error("credential failed")
+			continue
+		}
+		log.WithFields(fields).Info("credential processed")
+	}
+	summary := results.Summary()
 	log.WithFields(log.Fields{
-		"count": len(cfg.Credentials),
-	}).Info("success")
+		"count":     summary.Total,
+		"succeeded": summary.Succeeded,
+		"failed":    summary.Failed,
+		"skipped":   summary.Skipped,
+	}).Info("summary")
+	os.Exit(exitCode(summary, err))
+}
+
+//plan
+//prints what a run would do without changing anything
+func plan(cfg *config.Config, output string) int {
+	plans, err := handlers.PlanHandler(cfg)
+	write := plans.WriteText
+	if output == "json" {
+		write = plans.WriteJSON
+	}
+	printErr := write(os.Stdout)
+	if printErr != nil {
+		log.WithFields(log.Fields{
+			"error": printErr.Error(),
+		}).Fatal("output error")
+	}
+	if err != nil {
+		return exitFailure
+	}
+	return exitSuccess
+}
+
+//exitCode
+//fails completely when every credential failed or the
+//run itself errored, partially when only some credentials failed
+func exitCode(summary handlers.Summary, err error) int {
+	if err == nil {
+		return exitSuccess
+	}
+	if summary.Failed > 0 && summary.Failed < summary.Total {
+		return exitPartialFailure
+	}
+	return exitFailure
 }
@@ -4,14 +4,24 @@ go 1.16
 
 require (
 	cloud.google.com/go v0.82.0
+	filippo.io/age v1.0.0-beta7
+	github.com/aws/aws-sdk-go v1.38.69
 	github.com/golang/protobuf v1.5.2
+	github.com/google/go-github/v35 v35.3.0
+	github.com/hashicorp/go-retryablehttp v0.6.8
+	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/sirupsen/logrus v1.8.1
 	github.com/stretchr/testify v1.7.0
 	github.com/xanzy/go-gitlab v0.50.0
-	golang.org/x/net v0.0.0-20210520170846-37e1c6afe023 // indirect
+	go.mozilla.org/sops/v3 v3.7.1
+	golang.org/x/crypto v0.0.0-20220315160706-3147a52a75dd
+	golang.org/x/oauth2 v0.0.0-20210514164344-f6687ab2804c
 	google.golang.org/api v0.47.0
 	google.golang.org/genproto v0.0.0-20210517163617-5e0236093d7a
 	google.golang.org/grpc v1.37.1
 	google.golang.org/protobuf v1.26.0
 	gopkg.in/yaml.v2 v2.4.0
+	k8s.io/api v0.21.14
+	k8s.io/apimachinery v0.21.14
+	k8s.io/client-go v0.21.14
 )
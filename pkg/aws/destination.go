@@ -0,0 +1,135 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+func init() {
+	destination.Register("aws-secrets-manager", NewSecretsManagerDestination)
+	destination.Register("aws-ssm", NewParameterDestination)
+}
+
+//SecretsManagerDestination writes credentials to AWS Secrets Manager secrets
+type SecretsManagerDestination struct {
+	client secretsmanageriface.SecretsManagerAPI
+}
+
+//NewSecretsManagerDestination creates a SecretsManagerDestination from the configuration
+func NewSecretsManagerDestination(cfg *config.Config) (destination.Destination, error) {
+	if cfg.AWSSecretsManagerClient == nil {
+		return nil, fmt.Errorf("aws secrets manager client is not configured")
+	}
+	return &SecretsManagerDestination{client: cfg.AWSSecretsManagerClient}, nil
+}
+
+//Write sets the value as the current version of the secret
+func (d *SecretsManagerDestination) Write(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+) error {
+	_, err := d.WriteVersion(ctx, cred, value)
+	return err
+}
+
+//WriteVersion sets the value as the current version
+//of the secret and returns the version ID
+func (d *SecretsManagerDestination) WriteVersion(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+) (string, error) {
+	return PutSecretValue(ctx, cred, value, d.client)
+}
+
+//Read returns the current value of the secret
+func (d *SecretsManagerDestination) Read(
+	ctx context.Context,
+	cred *config.Credential,
+) (string, error) {
+	return GetSecretValue(ctx, cred, d.client)
+}
+
+//Delete schedules the secret for deletion
+func (d *SecretsManagerDestination) Delete(
+	ctx context.Context,
+	cred *config.Credential,
+) error {
+	return DeleteSecret(ctx, cred, d.client)
+}
+
+//Prune removes the AWSPREVIOUS label from the previous
+//version once the grace period has passed
+func (d *SecretsManagerDestination) Prune(
+	ctx context.Context,
+	cred *config.Credential,
+	gracePeriod time.Duration,
+) error {
+	return ExpirePreviousSecretVersion(ctx, cred, gracePeriod, d.client)
+}
+
+//Describe returns the secret that is written to
+func (d *SecretsManagerDestination) Describe(cred *config.Credential) string {
+	return fmt.Sprintf("secrets manager secret %s", cred.Variable)
+}
+
+//ParameterDestination writes credentials to
+//AWS SSM Parameter Store SecureString parameters
+type ParameterDestination struct {
+	client ssmiface.SSMAPI
+}
+
+//NewParameterDestination creates a ParameterDestination from the configuration
+func NewParameterDestination(cfg *config.Config) (destination.Destination, error) {
+	if cfg.AWSSSMClient == nil {
+		return nil, fmt.Errorf("aws ssm client is not configured")
+	}
+	return &ParameterDestination{client: cfg.AWSSSMClient}, nil
+}
+
+//Write sets the value on the parameter
+func (d *ParameterDestination) Write(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+) error {
+	_, err := d.WriteVersion(ctx, cred, value)
+	return err
+}
+
+//WriteVersion sets the value on the parameter and returns its version
+func (d *ParameterDestination) WriteVersion(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+) (string, error) {
+	return PutParameter(ctx, cred, value, d.client)
+}
+
+//Read returns the current value of the parameter
+func (d *ParameterDestination) Read(
+	ctx context.Context,
+	cred *config.Credential,
+) (string, error) {
+	return GetParameter(ctx, cred, d.client)
+}
+
+//Delete deletes the parameter
+func (d *ParameterDestination) Delete(
+	ctx context.Context,
+	cred *config.Credential,
+) error {
+	return DeleteParameter(ctx, cred, d.client)
+}
+
+//Describe returns the parameter that is written to
+func (d *ParameterDestination) Describe(cred *config.Credential) string {
+	return fmt.Sprintf("ssm parameter %s", cred.Variable)
+}
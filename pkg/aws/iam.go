@@ -0,0 +1,122 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	log "github.com/sirupsen/logrus"
+)
+
+//maxAccessKeys is the number of access keys
+//AWS allows an IAM user to have
+const maxAccessKeys = 2
+
+//CreateAccessKey creates a new access key for an IAM user
+func CreateAccessKey(
+	ctx context.Context,
+	user string,
+	client iamiface.IAMAPI,
+) (*iam.AccessKey, error) {
+	resp, err := client.CreateAccessKeyWithContext(ctx, &iam.CreateAccessKeyInput{
+		UserName: aws.String(user),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.AccessKey, nil
+}
+
+//ListAccessKeys returns all the access keys of an IAM user
+func ListAccessKeys(
+	ctx context.Context,
+	user string,
+	client iamiface.IAMAPI,
+) ([]*iam.AccessKeyMetadata, error) {
+	keys := []*iam.AccessKeyMetadata{}
+	err := client.ListAccessKeysPagesWithContext(
+		ctx,
+		&iam.ListAccessKeysInput{UserName: aws.String(user)},
+		func(page *iam.ListAccessKeysOutput, lastPage bool) bool {
+			keys = append(keys, page.AccessKeyMetadata...)
+			return true
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+//DeactivateAccessKey marks an access key of an IAM user as
+//inactive, it stops working but can be activated again
+func DeactivateAccessKey(
+	ctx context.Context,
+	user string,
+	keyID string,
+	client iamiface.IAMAPI,
+) error {
+	_, err := client.UpdateAccessKeyWithContext(ctx, &iam.UpdateAccessKeyInput{
+		UserName:    aws.String(user),
+		AccessKeyId: aws.String(keyID),
+		Status:      aws.String(iam.StatusTypeInactive),
+	})
+	return err
+}
+
+//DeleteAccessKey deletes an access key of an IAM user
+func DeleteAccessKey(
+	ctx context.Context,
+	user string,
+	keyID string,
+	client iamiface.IAMAPI,
+) error {
+	_, err := client.DeleteAccessKeyWithContext(ctx, &iam.DeleteAccessKeyInput{
+		UserName:    aws.String(user),
+		AccessKeyId: aws.String(keyID),
+	})
+	return err
+}
+
+//makeRoom deletes the oldest inactive access key when the IAM
+//user already has the maximum number of keys, active keys are
+//never deleted as they could still be in use, returns the ID
+//of the deleted key or an empty string when nothing was deleted
+func makeRoom(ctx context.Context, user string, client iamiface.IAMAPI) (string, error) {
+	keys, err := ListAccessKeys(ctx, user, client)
+	if err != nil {
+		return "", err
+	}
+	if len(keys) < maxAccessKeys {
+		return "", nil
+	}
+	inactive := []*iam.AccessKeyMetadata{}
+	for _, key := range keys {
+		if aws.StringValue(key.Status) == iam.StatusTypeInactive {
+			inactive = append(inactive, key)
+		}
+	}
+	if len(inactive) == 0 {
+		return "", fmt.Errorf(
+			"IAM user %s already has %d active access keys, deactivate one before rotating",
+			user,
+			len(keys),
+		)
+	}
+	sort.Slice(inactive, func(i, j int) bool {
+		return aws.TimeValue(inactive[i].CreateDate).Before(aws.TimeValue(inactive[j].CreateDate))
+	})
+	keyID := aws.StringValue(inactive[0].AccessKeyId)
+	err = DeleteAccessKey(ctx, user, keyID, client)
+	if err != nil {
+		return "", err
+	}
+	log.WithFields(log.Fields{
+		"user": user,
+		"key":  keyID,
+	}).Warn("deleted inactive access key to stay within the access key limit")
+	return keyID, nil
+}
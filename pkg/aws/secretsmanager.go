@@ -0,0 +1,204 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	log "github.com/sirupsen/logrus"
+)
+
+// Staging labels Secrets Manager moves between versions
+const (
+	StageCurrent  = "AWSCURRENT"
+	StagePrevious = "AWSPREVIOUS"
+)
+
+//isErrorCode checks if the error is an AWS error with the code
+func isErrorCode(err error, code string) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == code
+}
+
+//PutSecretValue writes the value as the current version of the credentials
+//secret and returns the version ID, the previous current version keeps
+//the AWSPREVIOUS label, the secret is created if it is missing and its
+//KMS key is updated if it is not the configured key
+func PutSecretValue(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+	client secretsmanageriface.SecretsManagerAPI,
+) (string, error) {
+	secret, err := client.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(cred.Variable),
+	})
+	if isErrorCode(err, secretsmanager.ErrCodeResourceNotFoundException) {
+		return createSecret(ctx, cred, value, client)
+	}
+	if err != nil {
+		return "", err
+	}
+	if cred.AWSKMSKeyID != "" && !sameKMSKey(aws.StringValue(secret.KmsKeyId), cred.AWSKMSKeyID) {
+		log.WithFields(log.Fields{
+			"secret":  cred.Variable,
+			"kms_key": cred.AWSKMSKeyID,
+		}).Warn("correcting secret kms key")
+		resp, err := client.UpdateSecretWithContext(ctx, &secretsmanager.UpdateSecretInput{
+			SecretId:     aws.String(cred.Variable),
+			KmsKeyId:     aws.String(cred.AWSKMSKeyID),
+			SecretString: aws.String(value),
+		})
+		if err != nil {
+			return "", err
+		}
+		return aws.StringValue(resp.VersionId), nil
+	}
+	resp, err := client.PutSecretValueWithContext(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(cred.Variable),
+		SecretString: aws.String(value),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(resp.VersionId), nil
+}
+
+//sameKMSKey checks if the KMS key of a secret, which Secrets Manager
+//returns as a key ARN, is the configured key ARN or key ID. Aliases
+//can't be compared without looking them up so they are assumed to match
+func sameKMSKey(secretKey string, configured string) bool {
+	switch {
+	case strings.HasPrefix(configured, "alias/") || strings.Contains(configured, ":alias/"):
+		return true
+	case strings.HasPrefix(configured, "arn:"):
+		return secretKey == configured
+	default:
+		return strings.HasSuffix(secretKey, ":key/"+configured)
+	}
+}
+
+//createSecret creates the credentials secret with the value
+func createSecret(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+	client secretsmanageriface.SecretsManagerAPI,
+) (string, error) {
+	input := &secretsmanager.CreateSecretInput{
+		Name:         aws.String(cred.Variable),
+		SecretString: aws.String(value),
+	}
+	if cred.AWSKMSKeyID != "" {
+		input.KmsKeyId = aws.String(cred.AWSKMSKeyID)
+	}
+	resp, err := client.CreateSecretWithContext(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	log.WithFields(log.Fields{
+		"secret": cred.Variable,
+	}).Info("created missing secret")
+	return aws.StringValue(resp.VersionId), nil
+}
+
+//GetSecretValue returns the current value of the credentials secret,
+//if the secret doesn't exist destination.ErrNotFound is returned
+func GetSecretValue(
+	ctx context.Context,
+	cred *config.Credential,
+	client secretsmanageriface.SecretsManagerAPI,
+) (string, error) {
+	resp, err := client.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(cred.Variable),
+	})
+	if isErrorCode(err, secretsmanager.ErrCodeResourceNotFoundException) {
+		return "", fmt.Errorf("secret %s: %w", cred.Variable, destination.ErrNotFound)
+	}
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(resp.SecretString), nil
+}
+
+//DeleteSecret schedules the credentials secret for
+//deletion after the default recovery window
+func DeleteSecret(
+	ctx context.Context,
+	cred *config.Credential,
+	client secretsmanageriface.SecretsManagerAPI,
+) error {
+	_, err := client.DeleteSecretWithContext(ctx, &secretsmanager.DeleteSecretInput{
+		SecretId: aws.String(cred.Variable),
+	})
+	if isErrorCode(err, secretsmanager.ErrCodeResourceNotFoundException) {
+		return nil
+	}
+	return err
+}
+
+//ExpirePreviousSecretVersion removes the AWSPREVIOUS label from the
+//version the current version replaced once the grace period has
+//passed, versions without labels are deleted by Secrets Manager
+func ExpirePreviousSecretVersion(
+	ctx context.Context,
+	cred *config.Credential,
+	gracePeriod time.Duration,
+	client secretsmanageriface.SecretsManagerAPI,
+) error {
+	var current, previous *secretsmanager.SecretVersionsListEntry
+	err := client.ListSecretVersionIdsPagesWithContext(
+		ctx,
+		&secretsmanager.ListSecretVersionIdsInput{SecretId: aws.String(cred.Variable)},
+		func(page *secretsmanager.ListSecretVersionIdsOutput, lastPage bool) bool {
+			for _, version := range page.Versions {
+				for _, stage := range version.VersionStages {
+					switch aws.StringValue(stage) {
+					case StageCurrent:
+						current = version
+					case StagePrevious:
+						previous = version
+					}
+				}
+			}
+			return true
+		},
+	)
+	if isErrorCode(err, secretsmanager.ErrCodeResourceNotFoundException) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current == nil || previous == nil {
+		return nil
+	}
+	// the previous version is in use until the current version was added
+	if time.Since(aws.TimeValue(current.CreatedDate)) < gracePeriod {
+		return nil
+	}
+	_, err = client.UpdateSecretVersionStageWithContext(
+		ctx,
+		&secretsmanager.UpdateSecretVersionStageInput{
+			SecretId:            aws.String(cred.Variable),
+			VersionStage:        aws.String(StagePrevious),
+			RemoveFromVersionId: previous.VersionId,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"secret":  cred.Variable,
+		"version": aws.StringValue(previous.VersionId),
+	}).Info("expired previous secret version")
+	return nil
+}
@@ -0,0 +1,200 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/Spazzy757/credentials-rotator/pkg/test"
+	"github.com/stretchr/testify/require"
+)
+
+// version IDs are UUIDs, the SDK rejects shorter IDs
+const (
+	oldVersionID     = "00000000-0000-0000-0000-000000000001"
+	currentVersionID = "00000000-0000-0000-0000-000000000002"
+)
+
+// Secrets Manager describes the KMS key of a secret by its ARN
+const (
+	keyARN    = "arn:aws:kms:us-east-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	oldKeyARN = "arn:aws:kms:us-east-1:111122223333:key/0000abcd-12ab-34cd-56ef-1234567890ab"
+)
+
+func TestPutSecretValue(t *testing.T) {
+	cred := &config.Credential{Variable: "ci/deployer"}
+	t.Run("missing secret gets created", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupSecretsManagerTestServer(t)
+		defer server.Close()
+		kms := *cred
+		kms.AWSKMSKeyID = "alias/ci"
+
+		version, err := PutSecretValue(context.Background(), &kms, "ABCDBC", client)
+		assertions.NoError(err)
+		secret := mock.Secrets["ci/deployer"]
+		assertions.NotNil(secret)
+		assertions.Equal("alias/ci", secret.KMSKeyID)
+		assertions.Equal(version, secret.Versions[0].ID)
+		assertions.Equal("ABCDBC", secret.Versions[0].Value)
+		assertions.Equal([]string{StageCurrent}, secret.Versions[0].Stages)
+	})
+	t.Run("current version becomes the previous version", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupSecretsManagerTestServer(t)
+		defer server.Close()
+		mock.Secrets["ci/deployer"] = &test.MockSecret{
+			Versions: []*test.MockSecretVersion{
+				{ID: oldVersionID, Value: "old value", Stages: []string{StageCurrent}},
+			},
+		}
+
+		version, err := PutSecretValue(context.Background(), cred, "ABCDBC", client)
+		assertions.NoError(err)
+		secret := mock.Secrets["ci/deployer"]
+		assertions.Equal([]string{StagePrevious}, secret.Versions[0].Stages)
+		assertions.Equal(version, secret.Versions[1].ID)
+		assertions.Equal([]string{StageCurrent}, secret.Versions[1].Stages)
+		assertions.Equal([]string{"DescribeSecret", "PutSecretValue"}, mock.Actions)
+	})
+	t.Run("kms key gets corrected", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupSecretsManagerTestServer(t)
+		defer server.Close()
+		mock.Secrets["ci/deployer"] = &test.MockSecret{
+			KMSKeyID: oldKeyARN,
+			Versions: []*test.MockSecretVersion{
+				{ID: oldVersionID, Value: "old value", Stages: []string{StageCurrent}},
+			},
+		}
+		kms := *cred
+		kms.AWSKMSKeyID = keyARN
+
+		_, err := PutSecretValue(context.Background(), &kms, "ABCDBC", client)
+		assertions.NoError(err)
+		assertions.Equal(keyARN, mock.Secrets["ci/deployer"].KMSKeyID)
+		assertions.Equal([]string{"DescribeSecret", "UpdateSecret"}, mock.Actions)
+	})
+	t.Run("kms key id and alias match the key arn", func(t *testing.T) {
+		assertions := require.New(t)
+		for _, keyID := range []string{
+			keyARN,
+			"1234abcd-12ab-34cd-56ef-1234567890ab",
+			"alias/ci",
+			"arn:aws:kms:us-east-1:111122223333:alias/ci",
+		} {
+			mock, server, client := test.SetupSecretsManagerTestServer(t)
+			mock.Secrets["ci/deployer"] = &test.MockSecret{
+				KMSKeyID: keyARN,
+				Versions: []*test.MockSecretVersion{
+					{ID: oldVersionID, Value: "old value", Stages: []string{StageCurrent}},
+				},
+			}
+			kms := *cred
+			kms.AWSKMSKeyID = keyID
+
+			_, err := PutSecretValue(context.Background(), &kms, "ABCDBC", client)
+			server.Close()
+			assertions.NoError(err)
+			assertions.Equal([]string{"DescribeSecret", "PutSecretValue"}, mock.Actions, keyID)
+		}
+	})
+}
+
+func TestGetSecretValue(t *testing.T) {
+	cred := &config.Credential{Variable: "ci/deployer"}
+	t.Run("current value gets returned", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupSecretsManagerTestServer(t)
+		defer server.Close()
+		mock.Secrets["ci/deployer"] = &test.MockSecret{
+			Versions: []*test.MockSecretVersion{
+				{ID: oldVersionID, Value: "old value", Stages: []string{StagePrevious}},
+				{ID: currentVersionID, Value: "ABCDBC", Stages: []string{StageCurrent}},
+			},
+		}
+
+		value, err := GetSecretValue(context.Background(), cred, client)
+		assertions.NoError(err)
+		assertions.Equal("ABCDBC", value)
+	})
+	t.Run("missing secret returns not found", func(t *testing.T) {
+		assertions := require.New(t)
+		_, server, client := test.SetupSecretsManagerTestServer(t)
+		defer server.Close()
+
+		_, err := GetSecretValue(context.Background(), cred, client)
+		assertions.True(errors.Is(err, destination.ErrNotFound))
+	})
+}
+
+func TestExpirePreviousSecretVersion(t *testing.T) {
+	cred := &config.Credential{Variable: "ci/deployer"}
+	secret := func(replacedAt time.Time) *test.MockSecret {
+		return &test.MockSecret{
+			Versions: []*test.MockSecretVersion{
+				{
+					ID:          oldVersionID,
+					Stages:      []string{StagePrevious},
+					CreatedDate: replacedAt.Add(-time.Hour),
+				},
+				{
+					ID:          currentVersionID,
+					Stages:      []string{StageCurrent},
+					CreatedDate: replacedAt,
+				},
+			},
+		}
+	}
+	t.Run("previous version expires after the grace period", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupSecretsManagerTestServer(t)
+		defer server.Close()
+		mock.Secrets["ci/deployer"] = secret(time.Now().Add(-2 * time.Hour))
+
+		err := ExpirePreviousSecretVersion(context.Background(), cred, time.Hour, client)
+		assertions.NoError(err)
+		assertions.Empty(mock.Secrets["ci/deployer"].Versions[0].Stages)
+		assertions.Equal([]string{StageCurrent}, mock.Secrets["ci/deployer"].Versions[1].Stages)
+	})
+	t.Run("previous version is kept during the grace period", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupSecretsManagerTestServer(t)
+		defer server.Close()
+		mock.Secrets["ci/deployer"] = secret(time.Now().Add(-time.Minute))
+
+		err := ExpirePreviousSecretVersion(context.Background(), cred, time.Hour, client)
+		assertions.NoError(err)
+		assertions.Equal([]string{StagePrevious}, mock.Secrets["ci/deployer"].Versions[0].Stages)
+	})
+	t.Run("missing secret is ignored", func(t *testing.T) {
+		assertions := require.New(t)
+		_, server, client := test.SetupSecretsManagerTestServer(t)
+		defer server.Close()
+
+		err := ExpirePreviousSecretVersion(context.Background(), cred, 0, client)
+		assertions.NoError(err)
+	})
+}
+
+func TestSecretsManagerDestination(t *testing.T) {
+	t.Run("missing client returns an error", func(t *testing.T) {
+		assertions := require.New(t)
+		_, err := NewSecretsManagerDestination(&config.Config{})
+		assertions.Error(err)
+	})
+	t.Run("destination describes the secret", func(t *testing.T) {
+		assertions := require.New(t)
+		_, server, client := test.SetupSecretsManagerTestServer(t)
+		defer server.Close()
+		dst, err := NewSecretsManagerDestination(&config.Config{AWSSecretsManagerClient: client})
+		assertions.NoError(err)
+		assertions.Equal(
+			"secrets manager secret ci/deployer",
+			destination.Describe(dst, &config.Credential{Variable: "ci/deployer"}),
+		)
+	})
+}
@@ -0,0 +1,120 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/source"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+)
+
+func init() {
+	source.Register("aws-iam", NewAccessKeySource)
+}
+
+// Fields of an issued access key that can be written to separate variables
+const (
+	FieldAccessKeyID     = "access_key_id"
+	FieldSecretAccessKey = "secret_access_key"
+)
+
+//AccessKeySource issues access keys for AWS IAM users
+type AccessKeySource struct {
+	client iamiface.IAMAPI
+}
+
+//NewAccessKeySource creates an AccessKeySource from the configuration
+func NewAccessKeySource(cfg *config.Config) (source.Source, error) {
+	if cfg.AWSIAMClient == nil {
+		return nil, fmt.Errorf("aws iam client is not configured")
+	}
+	return &AccessKeySource{client: cfg.AWSIAMClient}, nil
+}
+
+//Issue creates a new access key for the credentials IAM user,
+//the key is an AWS shared credentials file so it can be used
+//as a file variable, the ID and secret are also available as fields
+func (s *AccessKeySource) Issue(
+	ctx context.Context,
+	cred *config.Credential,
+) (*source.Key, error) {
+	deleted, err := makeRoom(ctx, cred.AWSUser, s.client)
+	if err != nil {
+		return nil, err
+	}
+	key, err := CreateAccessKey(ctx, cred.AWSUser, s.client)
+	if err != nil {
+		return nil, err
+	}
+	keyID := aws.StringValue(key.AccessKeyId)
+	secret := aws.StringValue(key.SecretAccessKey)
+	sharedCredentials := fmt.Sprintf(
+		"[default]\naws_access_key_id = %s\naws_secret_access_key = %s\n",
+		keyID,
+		secret,
+	)
+	issued := &source.Key{
+		ID:    keyID,
+		Value: []byte(sharedCredentials),
+		Fields: map[string]string{
+			FieldAccessKeyID:     keyID,
+			FieldSecretAccessKey: secret,
+		},
+		CreatedAt: aws.TimeValue(key.CreateDate),
+	}
+	if deleted != "" {
+		issued.Revoked = []string{deleted}
+	}
+	return issued, nil
+}
+
+//List returns the access keys of the credentials IAM user
+func (s *AccessKeySource) List(
+	ctx context.Context,
+	cred *config.Credential,
+) ([]source.Key, error) {
+	metadata, err := ListAccessKeys(ctx, cred.AWSUser, s.client)
+	if err != nil {
+		return nil, err
+	}
+	keys := []source.Key{}
+	for _, key := range metadata {
+		keys = append(keys, source.Key{
+			ID:        aws.StringValue(key.AccessKeyId),
+			CreatedAt: aws.TimeValue(key.CreateDate),
+		})
+	}
+	return keys, nil
+}
+
+//Deactivate marks an access key of the credentials IAM user as
+//inactive while it waits for its grace period to pass
+func (s *AccessKeySource) Deactivate(
+	ctx context.Context,
+	cred *config.Credential,
+	keyID string,
+) error {
+	return DeactivateAccessKey(ctx, cred.AWSUser, keyID, s.client)
+}
+
+//Revoke deletes an access key from the credentials IAM user
+func (s *AccessKeySource) Revoke(
+	ctx context.Context,
+	cred *config.Credential,
+	keyID string,
+) error {
+	return DeleteAccessKey(ctx, cred.AWSUser, keyID, s.client)
+}
+
+//KeyLimit returns the number of access keys
+//an IAM user is allowed to have
+func (s *AccessKeySource) KeyLimit() int {
+	return maxAccessKeys
+}
+
+//Describe returns the IAM user access keys are issued for
+func (s *AccessKeySource) Describe(cred *config.Credential) string {
+	return fmt.Sprintf("IAM user %s", cred.AWSUser)
+}
@@ -0,0 +1,93 @@
+package aws
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/test"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessKeySource(t *testing.T) {
+	cred := &config.Credential{AWSUser: "deployer"}
+	t.Run("issued key has the id and secret as fields", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupAWSIAMTestServer(t)
+		defer server.Close()
+		src := &AccessKeySource{client: client}
+
+		key, err := src.Issue(context.Background(), cred)
+		assertions.NoError(err)
+		assertions.Equal("AKIANEW000000000001", key.ID)
+		assertions.Equal("AKIANEW000000000001", key.Fields[FieldAccessKeyID])
+		assertions.Equal("secret-1", key.Fields[FieldSecretAccessKey])
+		assertions.Contains(string(key.Value), "aws_secret_access_key = secret-1")
+		assertions.Empty(key.Revoked)
+		assertions.Equal([]string{"ListAccessKeys", "CreateAccessKey"}, mock.Actions)
+	})
+	t.Run("inactive key is deleted to stay within the limit", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupAWSIAMTestServer(t)
+		defer server.Close()
+		mock.Keys = []test.MockAccessKey{
+			{ID: "AKIACURRENT00000001", Status: iam.StatusTypeActive, CreateDate: time.Now()},
+			{ID: "AKIAOLD000000000001", Status: iam.StatusTypeInactive, CreateDate: time.Now().Add(-time.Hour)},
+		}
+		src := &AccessKeySource{client: client}
+
+		key, err := src.Issue(context.Background(), cred)
+		assertions.NoError(err)
+		assertions.Equal("AKIANEW000000000001", key.ID)
+		assertions.Equal([]string{"AKIAOLD000000000001"}, key.Revoked)
+		keys, err := src.List(context.Background(), cred)
+		assertions.NoError(err)
+		assertions.Len(keys, 2)
+		assertions.Equal("AKIACURRENT00000001", keys[0].ID)
+		assertions.Equal("AKIANEW000000000001", keys[1].ID)
+	})
+	t.Run("two active keys fail the rotation", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupAWSIAMTestServer(t)
+		defer server.Close()
+		mock.Keys = []test.MockAccessKey{
+			{ID: "AKIAONE000000000001", Status: iam.StatusTypeActive, CreateDate: time.Now()},
+			{ID: "AKIATWO000000000001", Status: iam.StatusTypeActive, CreateDate: time.Now()},
+		}
+		src := &AccessKeySource{client: client}
+
+		_, err := src.Issue(context.Background(), cred)
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "already has 2 active access keys")
+		assertions.Equal([]string{"ListAccessKeys"}, mock.Actions)
+	})
+	t.Run("old keys are deactivated and then deleted", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupAWSIAMTestServer(t)
+		defer server.Close()
+		mock.Keys = []test.MockAccessKey{
+			{ID: "AKIAOLD000000000001", Status: iam.StatusTypeActive, CreateDate: time.Now()},
+		}
+		src := &AccessKeySource{client: client}
+
+		err := src.Deactivate(context.Background(), cred, "AKIAOLD000000000001")
+		assertions.NoError(err)
+		assertions.Equal(iam.StatusTypeInactive, mock.Keys[0].Status)
+		err = src.Revoke(context.Background(), cred, "AKIAOLD000000000001")
+		assertions.NoError(err)
+		assertions.Empty(mock.Keys)
+	})
+	t.Run("failing api returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupAWSIAMTestServer(t)
+		defer server.Close()
+		mock.ErrCode = "AccessDenied"
+		src := &AccessKeySource{client: client}
+
+		_, err := src.List(context.Background(), cred)
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "AccessDenied")
+	})
+}
@@ -0,0 +1,73 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+//PutParameter writes the value to the credentials SecureString
+//parameter and returns the version, the parameter is created if it is
+//missing and encrypted with the configured KMS key if there is one
+func PutParameter(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+	client ssmiface.SSMAPI,
+) (string, error) {
+	input := &ssm.PutParameterInput{
+		Name:      aws.String(cred.Variable),
+		Value:     aws.String(value),
+		Type:      aws.String(ssm.ParameterTypeSecureString),
+		Overwrite: aws.Bool(true),
+	}
+	if cred.AWSKMSKeyID != "" {
+		input.KeyId = aws.String(cred.AWSKMSKeyID)
+	}
+	resp, err := client.PutParameterWithContext(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(aws.Int64Value(resp.Version), 10), nil
+}
+
+//GetParameter returns the decrypted value of the credentials parameter,
+//if the parameter doesn't exist destination.ErrNotFound is returned
+func GetParameter(
+	ctx context.Context,
+	cred *config.Credential,
+	client ssmiface.SSMAPI,
+) (string, error) {
+	resp, err := client.GetParameterWithContext(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(cred.Variable),
+		WithDecryption: aws.Bool(true),
+	})
+	if isErrorCode(err, ssm.ErrCodeParameterNotFound) {
+		return "", fmt.Errorf("parameter %s: %w", cred.Variable, destination.ErrNotFound)
+	}
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(resp.Parameter.Value), nil
+}
+
+//DeleteParameter deletes the credentials parameter
+func DeleteParameter(
+	ctx context.Context,
+	cred *config.Credential,
+	client ssmiface.SSMAPI,
+) error {
+	_, err := client.DeleteParameterWithContext(ctx, &ssm.DeleteParameterInput{
+		Name: aws.String(cred.Variable),
+	})
+	if isErrorCode(err, ssm.ErrCodeParameterNotFound) {
+		return nil
+	}
+	return err
+}
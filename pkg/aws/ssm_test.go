@@ -0,0 +1,93 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/Spazzy757/credentials-rotator/pkg/test"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPutParameter(t *testing.T) {
+	cred := &config.Credential{Variable: "/ci/deployer"}
+	t.Run("missing parameter gets created as a secure string", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupSSMTestServer(t)
+		defer server.Close()
+		kms := *cred
+		kms.AWSKMSKeyID = "alias/ci"
+
+		version, err := PutParameter(context.Background(), &kms, "ABCDBC", client)
+		assertions.NoError(err)
+		assertions.Equal("1", version)
+		parameter := mock.Parameters["/ci/deployer"]
+		assertions.Equal(ssm.ParameterTypeSecureString, parameter.Type)
+		assertions.Equal("alias/ci", parameter.KMSKeyID)
+		assertions.Equal([]string{"ABCDBC"}, parameter.Values)
+	})
+	t.Run("existing parameter gets a new version", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupSSMTestServer(t)
+		defer server.Close()
+		mock.Parameters["/ci/deployer"] = &test.MockParameter{
+			Type:   ssm.ParameterTypeSecureString,
+			Values: []string{"old value"},
+		}
+
+		version, err := PutParameter(context.Background(), cred, "ABCDBC", client)
+		assertions.NoError(err)
+		assertions.Equal("2", version)
+		assertions.Equal([]string{"old value", "ABCDBC"}, mock.Parameters["/ci/deployer"].Values)
+	})
+}
+
+func TestGetParameter(t *testing.T) {
+	cred := &config.Credential{Variable: "/ci/deployer"}
+	t.Run("decrypted value gets returned", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupSSMTestServer(t)
+		defer server.Close()
+		mock.Parameters["/ci/deployer"] = &test.MockParameter{
+			Type:   ssm.ParameterTypeSecureString,
+			Values: []string{"ABCDBC"},
+		}
+
+		value, err := GetParameter(context.Background(), cred, client)
+		assertions.NoError(err)
+		assertions.Equal("ABCDBC", value)
+	})
+	t.Run("missing parameter returns not found", func(t *testing.T) {
+		assertions := require.New(t)
+		_, server, client := test.SetupSSMTestServer(t)
+		defer server.Close()
+
+		_, err := GetParameter(context.Background(), cred, client)
+		assertions.True(errors.Is(err, destination.ErrNotFound))
+	})
+}
+
+func TestDeleteParameter(t *testing.T) {
+	cred := &config.Credential{Variable: "/ci/deployer"}
+	t.Run("parameter gets deleted", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupSSMTestServer(t)
+		defer server.Close()
+		mock.Parameters["/ci/deployer"] = &test.MockParameter{Values: []string{"ABCDBC"}}
+
+		err := DeleteParameter(context.Background(), cred, client)
+		assertions.NoError(err)
+		assertions.Empty(mock.Parameters)
+	})
+	t.Run("missing parameter is ignored", func(t *testing.T) {
+		assertions := require.New(t)
+		_, server, client := test.SetupSSMTestServer(t)
+		defer server.Close()
+
+		err := DeleteParameter(context.Background(), cred, client)
+		assertions.NoError(err)
+	})
+}
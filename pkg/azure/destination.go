@@ -0,0 +1,81 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+)
+
+func init() {
+	destination.Register("azure-devops", NewVariableGroupDestination)
+}
+
+//VariableGroupDestination writes credentials to a secret
+//variable of an Azure DevOps library variable group
+type VariableGroupDestination struct {
+	client  *http.Client
+	baseURL string
+}
+
+//NewVariableGroupDestination creates a VariableGroupDestination from the configuration
+func NewVariableGroupDestination(cfg *config.Config) (destination.Destination, error) {
+	if cfg.AzureDevOpsClient == nil {
+		return nil, fmt.Errorf("azure devops client is not configured")
+	}
+	return &VariableGroupDestination{
+		client:  cfg.AzureDevOpsClient,
+		baseURL: cfg.AzureDevOpsURL,
+	}, nil
+}
+
+//Write sets the value on the secret variable of the group
+func (d *VariableGroupDestination) Write(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+) error {
+	return SetGroupVariable(ctx, d.client, d.baseURL, cred, value)
+}
+
+//Read is not supported as Azure DevOps never returns secret values
+func (d *VariableGroupDestination) Read(
+	ctx context.Context,
+	cred *config.Credential,
+) (string, error) {
+	return "", destination.ErrReadNotSupported
+}
+
+//Delete removes the variable from the group
+func (d *VariableGroupDestination) Delete(
+	ctx context.Context,
+	cred *config.Credential,
+) error {
+	return RemoveGroupVariable(ctx, d.client, d.baseURL, cred)
+}
+
+//Check makes sure the variable group exists and its
+//variables can be set before anything is rotated
+func (d *VariableGroupDestination) Check(
+	ctx context.Context,
+	cred *config.Credential,
+) error {
+	group, err := GetVariableGroup(ctx, d.client, d.baseURL, cred)
+	if err != nil {
+		return err
+	}
+	return checkWritable(group)
+}
+
+//Describe returns the variable group that is written to
+func (d *VariableGroupDestination) Describe(cred *config.Credential) string {
+	return fmt.Sprintf(
+		"variable %s in variable group %s of %s/%s",
+		cred.Variable,
+		cred.AzureDevOpsGroup,
+		cred.AzureDevOpsOrganization,
+		cred.AzureDevOpsProject,
+	)
+}
@@ -0,0 +1,223 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/Spazzy757/credentials-rotator/pkg/httpapi"
+)
+
+//devOpsAPIVersion is the version of the Azure DevOps variable groups API
+const devOpsAPIVersion = "6.0-preview.2"
+
+//keyVaultGroupType is the type of variable groups linked to an
+//Azure Key Vault, their variables can't be set through Azure DevOps
+const keyVaultGroupType = "AzureKeyVault"
+
+//GroupVariable is a variable of a variable group, the
+//value of secret variables is never returned and is
+//kept when it is sent back without a value
+type GroupVariable struct {
+	Value    *string `json:"value"`
+	IsSecret bool    `json:"isSecret,omitempty"`
+}
+
+//VariableGroup is an Azure DevOps library variable group, the fields
+//and variables that aren't changed are kept as they are so they
+//are sent back unchanged along with properties this doesn't know
+type VariableGroup struct {
+	ID                             int                        `json:"id,omitempty"`
+	Name                           string                     `json:"name"`
+	Description                    string                     `json:"description,omitempty"`
+	Type                           string                     `json:"type,omitempty"`
+	Variables                      map[string]json.RawMessage `json:"variables"`
+	ProviderData                   json.RawMessage            `json:"providerData,omitempty"`
+	VariableGroupProjectReferences json.RawMessage            `json:"variableGroupProjectReferences,omitempty"`
+}
+
+//checkWritable makes sure the variables of the group can be set
+func checkWritable(group *VariableGroup) error {
+	if group.Type == keyVaultGroupType {
+		return fmt.Errorf(
+			"variable group %s is linked to an Azure Key Vault, write to the key vault instead",
+			group.Name,
+		)
+	}
+	return nil
+}
+
+//devOpsError is the error body returned by Azure DevOps
+type devOpsError struct {
+	Message string `json:"message"`
+}
+
+//devOpsErrorMessage returns the message of an Azure DevOps error
+func devOpsErrorMessage(body []byte) string {
+	devOpsErr := devOpsError{}
+	if json.Unmarshal(body, &devOpsErr) == nil && devOpsErr.Message != "" {
+		return devOpsErr.Message
+	}
+	return strings.TrimSpace(string(body))
+}
+
+//checkDevOpsResponse fails requests with an invalid token, Azure
+//DevOps answers them with the sign in page instead of an error
+func checkDevOpsResponse(resp *http.Response) error {
+	if resp.StatusCode == http.StatusNonAuthoritativeInfo {
+		return errors.New("not authenticated, check the personal access token")
+	}
+	return nil
+}
+
+//doDevOpsRequest sends a request to Azure DevOps and decodes the
+//response into out if it is set, if the resource doesn't exist
+//the error wraps destination.ErrNotFound
+func doDevOpsRequest(
+	ctx context.Context,
+	client *http.Client,
+	method string,
+	requestURL string,
+	body interface{},
+	out interface{},
+) error {
+	api := &httpapi.Client{
+		HTTP:          client,
+		Header:        http.Header{"Accept": []string{"application/json"}},
+		ErrorMessage:  devOpsErrorMessage,
+		NotFound:      destination.ErrNotFound,
+		CheckResponse: checkDevOpsResponse,
+	}
+	return api.Do(ctx, method, requestURL, body, out)
+}
+
+//GetVariableGroup returns the variable group of the credential,
+//if the group doesn't exist destination.ErrNotFound is returned
+func GetVariableGroup(
+	ctx context.Context,
+	client *http.Client,
+	baseURL string,
+	cred *config.Credential,
+) (*VariableGroup, error) {
+	query := url.Values{}
+	query.Set("groupName", cred.AzureDevOpsGroup)
+	query.Set("api-version", devOpsAPIVersion)
+	groups := struct {
+		Value []VariableGroup `json:"value"`
+	}{}
+	err := doDevOpsRequest(
+		ctx,
+		client,
+		http.MethodGet,
+		fmt.Sprintf(
+			"%s/%s/%s/_apis/distributedtask/variablegroups?%s",
+			strings.TrimSuffix(baseURL, "/"),
+			url.PathEscape(cred.AzureDevOpsOrganization),
+			url.PathEscape(cred.AzureDevOpsProject),
+			query.Encode(),
+		),
+		nil,
+		&groups,
+	)
+	if err != nil {
+		return nil, err
+	}
+	// the group name is matched as a pattern ignoring case
+	for i := range groups.Value {
+		if strings.EqualFold(groups.Value[i].Name, cred.AzureDevOpsGroup) {
+			return &groups.Value[i], nil
+		}
+	}
+	return nil, fmt.Errorf(
+		"variable group %s in %s/%s: %w",
+		cred.AzureDevOpsGroup,
+		cred.AzureDevOpsOrganization,
+		cred.AzureDevOpsProject,
+		destination.ErrNotFound,
+	)
+}
+
+//updateVariableGroup replaces the variable group with the group
+func updateVariableGroup(
+	ctx context.Context,
+	client *http.Client,
+	baseURL string,
+	cred *config.Credential,
+	group *VariableGroup,
+) error {
+	return doDevOpsRequest(
+		ctx,
+		client,
+		http.MethodPut,
+		fmt.Sprintf(
+			"%s/%s/_apis/distributedtask/variablegroups/%d?api-version=%s",
+			strings.TrimSuffix(baseURL, "/"),
+			url.PathEscape(cred.AzureDevOpsOrganization),
+			group.ID,
+			devOpsAPIVersion,
+		),
+		group,
+		nil,
+	)
+}
+
+//SetGroupVariable sets the value on the secret variable
+//of the variable group keeping its other variables,
+//groups linked to an Azure Key Vault are refused
+func SetGroupVariable(
+	ctx context.Context,
+	client *http.Client,
+	baseURL string,
+	cred *config.Credential,
+	value string,
+) error {
+	group, err := GetVariableGroup(ctx, client, baseURL, cred)
+	if err != nil {
+		return err
+	}
+	err = checkWritable(group)
+	if err != nil {
+		return err
+	}
+	variable, err := json.Marshal(GroupVariable{Value: &value, IsSecret: true})
+	if err != nil {
+		return err
+	}
+	if group.Variables == nil {
+		group.Variables = map[string]json.RawMessage{}
+	}
+	group.Variables[cred.Variable] = variable
+	return updateVariableGroup(ctx, client, baseURL, cred, group)
+}
+
+//RemoveGroupVariable removes the variable from the variable group,
+//a group or variable that doesn't exist is already removed
+func RemoveGroupVariable(
+	ctx context.Context,
+	client *http.Client,
+	baseURL string,
+	cred *config.Credential,
+) error {
+	group, err := GetVariableGroup(ctx, client, baseURL, cred)
+	if errors.Is(err, destination.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, ok := group.Variables[cred.Variable]; !ok {
+		return nil
+	}
+	err = checkWritable(group)
+	if err != nil {
+		return err
+	}
+	delete(group.Variables, cred.Variable)
+	return updateVariableGroup(ctx, client, baseURL, cred, group)
+}
@@ -0,0 +1,171 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/Spazzy757/credentials-rotator/pkg/test"
+	"github.com/stretchr/testify/require"
+)
+
+func existingGroup() *test.MockVariableGroup {
+	return &test.MockVariableGroup{
+		ID:          7,
+		Name:        "ci-secrets",
+		Description: "secrets for the build farm",
+		Variables: map[string]test.MockGroupVariable{
+			"REGION":        {Value: "europe-west1", IsReadOnly: true},
+			"OTHER_SECRET":  {Value: "other secret", IsSecret: true},
+			"TEST_VARIABLE": {Value: "old value", IsSecret: true},
+		},
+	}
+}
+
+func TestSetGroupVariable(t *testing.T) {
+	cred := config.Credential{
+		AzureDevOpsOrganization: "organization",
+		AzureDevOpsProject:      "project",
+		AzureDevOpsGroup:        "ci-secrets",
+		Variable:                "TEST_VARIABLE",
+	}
+	t.Run("variable gets updated and other variables are kept", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupAzureDevOpsTestServer(t)
+		defer server.Close()
+		mock.Groups = []*test.MockVariableGroup{existingGroup()}
+
+		err := SetGroupVariable(context.Background(), client, server.URL, &cred, "ABCDBC")
+		assertions.NoError(err)
+
+		group := mock.Groups[0]
+		assertions.Equal(1, mock.Updates)
+		assertions.Equal("secrets for the build farm", group.Description)
+		assertions.Equal(
+			test.MockGroupVariable{Value: "ABCDBC", IsSecret: true},
+			group.Variables["TEST_VARIABLE"],
+		)
+		assertions.Equal(
+			test.MockGroupVariable{Value: "other secret", IsSecret: true},
+			group.Variables["OTHER_SECRET"],
+		)
+		assertions.Equal(
+			test.MockGroupVariable{Value: "europe-west1", IsReadOnly: true},
+			group.Variables["REGION"],
+		)
+	})
+	t.Run("missing variable gets added as a secret", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupAzureDevOpsTestServer(t)
+		defer server.Close()
+		mock.Groups = []*test.MockVariableGroup{existingGroup()}
+		newCred := cred
+		newCred.Variable = "NEW_VARIABLE"
+
+		err := SetGroupVariable(context.Background(), client, server.URL, &newCred, "ABCDBC")
+		assertions.NoError(err)
+
+		group := mock.Groups[0]
+		assertions.Len(group.Variables, 4)
+		assertions.Equal(
+			test.MockGroupVariable{Value: "ABCDBC", IsSecret: true},
+			group.Variables["NEW_VARIABLE"],
+		)
+	})
+	t.Run("group name is matched ignoring case", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupAzureDevOpsTestServer(t)
+		defer server.Close()
+		mock.Groups = []*test.MockVariableGroup{existingGroup()}
+		upperCred := cred
+		upperCred.AzureDevOpsGroup = "CI-Secrets"
+
+		err := SetGroupVariable(context.Background(), client, server.URL, &upperCred, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("ABCDBC", mock.Groups[0].Variables["TEST_VARIABLE"].Value)
+	})
+	t.Run("key vault group is refused", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupAzureDevOpsTestServer(t)
+		defer server.Close()
+		group := existingGroup()
+		group.Type = "AzureKeyVault"
+		mock.Groups = []*test.MockVariableGroup{group}
+
+		err := SetGroupVariable(context.Background(), client, server.URL, &cred, "ABCDBC")
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "linked to an Azure Key Vault")
+		assertions.Equal(0, mock.Updates)
+
+		dst := &VariableGroupDestination{client: client, baseURL: server.URL}
+		err = destination.Check(context.Background(), dst, &cred)
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "linked to an Azure Key Vault")
+	})
+	t.Run("missing group is not found", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupAzureDevOpsTestServer(t)
+		defer server.Close()
+
+		err := SetGroupVariable(context.Background(), client, server.URL, &cred, "ABCDBC")
+		assertions.True(errors.Is(err, destination.ErrNotFound))
+		assertions.Equal(0, mock.Updates)
+	})
+	t.Run("invalid token returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, _ := test.SetupAzureDevOpsTestServer(t)
+		defer server.Close()
+		mock.Groups = []*test.MockVariableGroup{existingGroup()}
+
+		err := SetGroupVariable(context.Background(), http.DefaultClient, server.URL, &cred, "ABCDBC")
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "not authenticated")
+		assertions.Equal(0, mock.Updates)
+	})
+}
+
+func TestRemoveGroupVariable(t *testing.T) {
+	cred := config.Credential{
+		AzureDevOpsOrganization: "organization",
+		AzureDevOpsProject:      "project",
+		AzureDevOpsGroup:        "ci-secrets",
+		Variable:                "TEST_VARIABLE",
+	}
+	t.Run("variable gets removed and other variables are kept", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupAzureDevOpsTestServer(t)
+		defer server.Close()
+		mock.Groups = []*test.MockVariableGroup{existingGroup()}
+
+		err := RemoveGroupVariable(context.Background(), client, server.URL, &cred)
+		assertions.NoError(err)
+
+		group := mock.Groups[0]
+		assertions.Len(group.Variables, 2)
+		assertions.NotContains(group.Variables, "TEST_VARIABLE")
+		assertions.Equal("other secret", group.Variables["OTHER_SECRET"].Value)
+	})
+	t.Run("missing variable is ignored", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupAzureDevOpsTestServer(t)
+		defer server.Close()
+		mock.Groups = []*test.MockVariableGroup{existingGroup()}
+		missingCred := cred
+		missingCred.Variable = "MISSING"
+
+		err := RemoveGroupVariable(context.Background(), client, server.URL, &missingCred)
+		assertions.NoError(err)
+		assertions.Equal(0, mock.Updates)
+	})
+	t.Run("missing group is ignored", func(t *testing.T) {
+		assertions := require.New(t)
+		_, server, client := test.SetupAzureDevOpsTestServer(t)
+		defer server.Close()
+
+		err := RemoveGroupVariable(context.Background(), client, server.URL, &cred)
+		assertions.NoError(err)
+	})
+}
@@ -0,0 +1,135 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/httpapi"
+)
+
+//PasswordCredential is a client secret of an application registration
+type PasswordCredential struct {
+	KeyID         string    `json:"keyId,omitempty"`
+	DisplayName   string    `json:"displayName,omitempty"`
+	SecretText    string    `json:"secretText,omitempty"`
+	StartDateTime time.Time `json:"startDateTime"`
+	EndDateTime   time.Time `json:"endDateTime"`
+}
+
+//graphError is the error body returned by Microsoft Graph
+type graphError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+//applicationURL returns the URL of the application
+//registration addressed by its application (client) ID
+func applicationURL(graphURL string, appID string) string {
+	return fmt.Sprintf(
+		"%s/v1.0/applications(appId='%s')",
+		strings.TrimSuffix(graphURL, "/"),
+		url.PathEscape(appID),
+	)
+}
+
+//graphErrorMessage returns the code and message of a Microsoft Graph error
+func graphErrorMessage(body []byte) string {
+	graphErr := graphError{}
+	if json.Unmarshal(body, &graphErr) != nil || graphErr.Error.Code == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s: %s", graphErr.Error.Code, graphErr.Error.Message)
+}
+
+//doGraphRequest sends a request to Microsoft Graph
+//and decodes the response into out if it is set
+func doGraphRequest(
+	ctx context.Context,
+	client *http.Client,
+	method string,
+	requestURL string,
+	body interface{},
+	out interface{},
+) error {
+	api := &httpapi.Client{HTTP: client, ErrorMessage: graphErrorMessage}
+	return api.Do(ctx, method, requestURL, body, out)
+}
+
+//AddPassword adds a new client secret to an application registration
+func AddPassword(
+	ctx context.Context,
+	client *http.Client,
+	graphURL string,
+	appID string,
+	displayName string,
+	expiresAt time.Time,
+) (*PasswordCredential, error) {
+	body := map[string]interface{}{
+		"passwordCredential": map[string]interface{}{
+			"displayName": displayName,
+			"endDateTime": expiresAt.UTC().Format(time.RFC3339),
+		},
+	}
+	password := &PasswordCredential{}
+	err := doGraphRequest(
+		ctx,
+		client,
+		http.MethodPost,
+		applicationURL(graphURL, appID)+"/addPassword",
+		body,
+		password,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return password, nil
+}
+
+//ListPasswords returns the client secrets of an application registration
+func ListPasswords(
+	ctx context.Context,
+	client *http.Client,
+	graphURL string,
+	appID string,
+) ([]PasswordCredential, error) {
+	application := struct {
+		PasswordCredentials []PasswordCredential `json:"passwordCredentials"`
+	}{}
+	err := doGraphRequest(
+		ctx,
+		client,
+		http.MethodGet,
+		applicationURL(graphURL, appID)+"?$select=passwordCredentials",
+		nil,
+		&application,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return application.PasswordCredentials, nil
+}
+
+//RemovePassword removes a client secret from an application registration
+func RemovePassword(
+	ctx context.Context,
+	client *http.Client,
+	graphURL string,
+	appID string,
+	keyID string,
+) error {
+	return doGraphRequest(
+		ctx,
+		client,
+		http.MethodPost,
+		applicationURL(graphURL, appID)+"/removePassword",
+		map[string]string{"keyId": keyID},
+		nil,
+	)
+}
@@ -0,0 +1,134 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/source"
+)
+
+func init() {
+	source.Register("azure-ad", NewPasswordSource)
+}
+
+// Fields of an issued client secret that can be written to separate variables
+const (
+	FieldClientID     = "client_id"
+	FieldClientSecret = "client_secret"
+	FieldTenantID     = "tenant_id"
+)
+
+//clientCredentials is the value of an issued client secret, it uses
+//the format of the Azure SDK auth file so tools like azure/login
+//can sign in with it
+type clientCredentials struct {
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+	TenantID     string `json:"tenantId"`
+}
+
+//defaultSecretExpiry is how long client secrets
+//are valid when the credential doesn't set it
+const defaultSecretExpiry = 90 * 24 * time.Hour
+
+//secretDisplayName is set on the client secrets
+//so they can be told apart in the Azure portal
+const secretDisplayName = "credentials-rotator"
+
+//PasswordSource issues client secrets for Azure AD application registrations
+type PasswordSource struct {
+	client   *http.Client
+	graphURL string
+	tenantID string
+}
+
+//NewPasswordSource creates a PasswordSource from the configuration
+func NewPasswordSource(cfg *config.Config) (source.Source, error) {
+	if cfg.AzureGraphClient == nil {
+		return nil, fmt.Errorf("azure graph client is not configured")
+	}
+	return &PasswordSource{
+		client:   cfg.AzureGraphClient,
+		graphURL: cfg.AzureGraphURL,
+		tenantID: cfg.AzureTenantID,
+	}, nil
+}
+
+//Issue adds a new client secret to the credentials application registration,
+//the key is the client ID, secret and tenant ID as JSON and each of
+//them is also available as a field
+func (s *PasswordSource) Issue(
+	ctx context.Context,
+	cred *config.Credential,
+) (*source.Key, error) {
+	expiry := cred.AzureSecretExpiry
+	if expiry == 0 {
+		expiry = defaultSecretExpiry
+	}
+	password, err := AddPassword(
+		ctx,
+		s.client,
+		s.graphURL,
+		cred.AzureApplicationID,
+		secretDisplayName,
+		time.Now().Add(expiry),
+	)
+	if err != nil {
+		return nil, err
+	}
+	value, err := json.Marshal(clientCredentials{
+		ClientID:     cred.AzureApplicationID,
+		ClientSecret: password.SecretText,
+		TenantID:     s.tenantID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &source.Key{
+		ID:    password.KeyID,
+		Value: value,
+		Fields: map[string]string{
+			FieldClientID:     cred.AzureApplicationID,
+			FieldClientSecret: password.SecretText,
+			FieldTenantID:     s.tenantID,
+		},
+		CreatedAt: password.StartDateTime,
+	}, nil
+}
+
+//List returns the client secrets of the credentials application registration
+func (s *PasswordSource) List(
+	ctx context.Context,
+	cred *config.Credential,
+) ([]source.Key, error) {
+	passwords, err := ListPasswords(ctx, s.client, s.graphURL, cred.AzureApplicationID)
+	if err != nil {
+		return nil, err
+	}
+	keys := []source.Key{}
+	for _, password := range passwords {
+		keys = append(keys, source.Key{
+			ID:        password.KeyID,
+			CreatedAt: password.StartDateTime,
+		})
+	}
+	return keys, nil
+}
+
+//Revoke removes a client secret from the credentials application registration
+func (s *PasswordSource) Revoke(
+	ctx context.Context,
+	cred *config.Credential,
+	keyID string,
+) error {
+	return RemovePassword(ctx, s.client, s.graphURL, cred.AzureApplicationID, keyID)
+}
+
+//Describe returns the application registration client secrets are issued for
+func (s *PasswordSource) Describe(cred *config.Credential) string {
+	return fmt.Sprintf("azure application %s", cred.AzureApplicationID)
+}
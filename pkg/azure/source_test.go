@@ -0,0 +1,91 @@
+package azure
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordSource(t *testing.T) {
+	cred := &config.Credential{
+		AzureApplicationID: "app-id",
+		AzureSecretExpiry:  24 * time.Hour,
+	}
+	t.Run("issued secret expires after the configured expiry", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupAzureTestServer(t)
+		defer server.Close()
+		src := &PasswordSource{client: client, graphURL: server.URL, tenantID: "tenant-id"}
+
+		key, err := src.Issue(context.Background(), cred)
+		assertions.NoError(err)
+		assertions.Equal("key-1", key.ID)
+		assertions.JSONEq(
+			`{"clientId": "app-id", "clientSecret": "secret-1", "tenantId": "tenant-id"}`,
+			string(key.Value),
+		)
+		assertions.Equal("app-id", key.Fields[FieldClientID])
+		assertions.Equal("secret-1", key.Fields[FieldClientSecret])
+		assertions.Equal("tenant-id", key.Fields[FieldTenantID])
+		assertions.Len(mock.Passwords, 1)
+		assertions.Equal(secretDisplayName, mock.Passwords[0].DisplayName)
+		assertions.WithinDuration(
+			time.Now().Add(24*time.Hour),
+			mock.Passwords[0].EndDateTime,
+			time.Minute,
+		)
+		assertions.Equal(1, mock.Tokens)
+	})
+	t.Run("secrets are listed and removed", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupAzureTestServer(t)
+		defer server.Close()
+		created := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+		mock.Passwords = []test.MockPassword{
+			{KeyID: "old-key", StartDateTime: created},
+			{KeyID: "current-key", StartDateTime: time.Now().UTC()},
+		}
+		src := &PasswordSource{client: client, graphURL: server.URL}
+
+		keys, err := src.List(context.Background(), cred)
+		assertions.NoError(err)
+		assertions.Len(keys, 2)
+		assertions.Equal("old-key", keys[0].ID)
+		assertions.True(created.Equal(keys[0].CreatedAt))
+
+		err = src.Revoke(context.Background(), cred, "old-key")
+		assertions.NoError(err)
+		assertions.Len(mock.Passwords, 1)
+		assertions.Equal("current-key", mock.Passwords[0].KeyID)
+	})
+	t.Run("graph errors are returned", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupAzureTestServer(t)
+		defer server.Close()
+		mock.ErrStatus = http.StatusForbidden
+		src := &PasswordSource{client: client, graphURL: server.URL}
+
+		_, err := src.List(context.Background(), cred)
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "403 Request_BadRequest")
+	})
+	t.Run("unknown application returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		_, server, client := test.SetupAzureTestServer(t)
+		defer server.Close()
+		src := &PasswordSource{client: client, graphURL: server.URL}
+
+		err := src.Revoke(
+			context.Background(),
+			&config.Credential{AzureApplicationID: "other"},
+			"old-key",
+		)
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "Request_ResourceNotFound")
+	})
+}
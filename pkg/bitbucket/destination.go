@@ -0,0 +1,81 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+)
+
+func init() {
+	destination.Register("bitbucket", NewVariableDestination)
+}
+
+//VariableDestination writes credentials to secured Bitbucket
+//Pipelines repository or deployment variables
+type VariableDestination struct {
+	client  *http.Client
+	baseURL string
+}
+
+//NewVariableDestination creates a VariableDestination from the configuration
+func NewVariableDestination(cfg *config.Config) (destination.Destination, error) {
+	if cfg.BitbucketClient == nil {
+		return nil, fmt.Errorf(
+			"bitbucket client is not configured, set BITBUCKET_TOKEN or " +
+				"BITBUCKET_USERNAME and BITBUCKET_APP_PASSWORD",
+		)
+	}
+	return &VariableDestination{
+		client:  cfg.BitbucketClient,
+		baseURL: cfg.BitbucketURL,
+	}, nil
+}
+
+//Write sets the value on the secured variable
+func (d *VariableDestination) Write(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+) error {
+	return UpdateVariable(ctx, d.client, d.baseURL, cred, value)
+}
+
+//Read is not supported as Bitbucket never returns secured values
+func (d *VariableDestination) Read(
+	ctx context.Context,
+	cred *config.Credential,
+) (string, error) {
+	return "", destination.ErrReadNotSupported
+}
+
+//Delete removes the variable
+func (d *VariableDestination) Delete(
+	ctx context.Context,
+	cred *config.Credential,
+) error {
+	return RemoveVariable(ctx, d.client, d.baseURL, cred)
+}
+
+//Check makes sure the variables can be listed before anything is rotated
+func (d *VariableDestination) Check(
+	ctx context.Context,
+	cred *config.Credential,
+) error {
+	return CheckVariables(ctx, d.client, d.baseURL, cred)
+}
+
+//Describe returns the variable that is written to
+func (d *VariableDestination) Describe(cred *config.Credential) string {
+	if cred.BitbucketEnvironment != "" {
+		return fmt.Sprintf(
+			"variable %s in environment %s of repository %s",
+			cred.Variable,
+			cred.BitbucketEnvironment,
+			cred.Repository,
+		)
+	}
+	return fmt.Sprintf("variable %s in repository %s", cred.Variable, cred.Repository)
+}
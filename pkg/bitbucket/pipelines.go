@@ -0,0 +1,269 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/Spazzy757/credentials-rotator/pkg/httpapi"
+	log "github.com/sirupsen/logrus"
+)
+
+//Variable is a repository or deployment variable of Bitbucket Pipelines
+type Variable struct {
+	UUID    string `json:"uuid,omitempty"`
+	Key     string `json:"key"`
+	Value   string `json:"value,omitempty"`
+	Secured bool   `json:"secured"`
+}
+
+//Environment is a deployment environment of a repository
+type Environment struct {
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+}
+
+//variablesPage is a page of variables, next is
+//the URL of the next page if there is one
+type variablesPage struct {
+	Values []Variable `json:"values"`
+	Next   string     `json:"next"`
+}
+
+//environmentsPage is a page of deployment environments
+type environmentsPage struct {
+	Values []Environment `json:"values"`
+	Next   string        `json:"next"`
+}
+
+//bitbucketError is the error body returned by Bitbucket
+type bitbucketError struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+//bitbucketErrorMessage returns the message of a Bitbucket error
+func bitbucketErrorMessage(body []byte) string {
+	bitbucketErr := bitbucketError{}
+	if json.Unmarshal(body, &bitbucketErr) == nil && bitbucketErr.Error.Message != "" {
+		return bitbucketErr.Error.Message
+	}
+	return strings.TrimSpace(string(body))
+}
+
+//doBitbucketRequest sends a request to Bitbucket and decodes the
+//response into out if it is set, if the resource doesn't exist
+//the error wraps destination.ErrNotFound
+func doBitbucketRequest(
+	ctx context.Context,
+	client *http.Client,
+	method string,
+	requestURL string,
+	body interface{},
+	out interface{},
+) error {
+	api := &httpapi.Client{
+		HTTP:         client,
+		ErrorMessage: bitbucketErrorMessage,
+		NotFound:     destination.ErrNotFound,
+	}
+	return api.Do(ctx, method, requestURL, body, out)
+}
+
+//repositoryURL returns the URL of the credentials repository
+func repositoryURL(baseURL string, cred *config.Credential) (string, error) {
+	parts := strings.Split(cred.Repository, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf(
+			"invalid bitbucket repository %q, expected workspace/repo_slug",
+			cred.Repository,
+		)
+	}
+	return fmt.Sprintf(
+		"%s/repositories/%s/%s",
+		strings.TrimSuffix(baseURL, "/"),
+		url.PathEscape(parts[0]),
+		url.PathEscape(parts[1]),
+	), nil
+}
+
+//GetEnvironment returns the deployment environment of
+//the repository with the name of bitbucket_environment
+func GetEnvironment(
+	ctx context.Context,
+	client *http.Client,
+	baseURL string,
+	cred *config.Credential,
+) (*Environment, error) {
+	repoURL, err := repositoryURL(baseURL, cred)
+	if err != nil {
+		return nil, err
+	}
+	next := repoURL + "/environments/?pagelen=100"
+	for next != "" {
+		page := environmentsPage{}
+		err := doBitbucketRequest(ctx, client, http.MethodGet, next, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		for i := range page.Values {
+			if page.Values[i].Name == cred.BitbucketEnvironment {
+				return &page.Values[i], nil
+			}
+		}
+		next = page.Next
+	}
+	return nil, fmt.Errorf(
+		"deployment environment %s in repository %s: %w",
+		cred.BitbucketEnvironment,
+		cred.Repository,
+		destination.ErrNotFound,
+	)
+}
+
+//variablesURL returns the URL of the repository variables or
+//the variables of the deployment environment if one is set
+func variablesURL(
+	ctx context.Context,
+	client *http.Client,
+	baseURL string,
+	cred *config.Credential,
+) (string, error) {
+	repoURL, err := repositoryURL(baseURL, cred)
+	if err != nil {
+		return "", err
+	}
+	if cred.BitbucketEnvironment == "" {
+		return repoURL + "/pipelines_config/variables", nil
+	}
+	environment, err := GetEnvironment(ctx, client, baseURL, cred)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(
+		"%s/deployments_config/environments/%s/variables",
+		repoURL,
+		url.PathEscape(environment.UUID),
+	), nil
+}
+
+//findVariable looks up the variable with the key of the
+//credential in the variables, nil is returned if it is missing
+func findVariable(
+	ctx context.Context,
+	client *http.Client,
+	variablesURL string,
+	cred *config.Credential,
+) (*Variable, error) {
+	next := variablesURL + "/?pagelen=100"
+	for next != "" {
+		page := variablesPage{}
+		err := doBitbucketRequest(ctx, client, http.MethodGet, next, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		for i := range page.Values {
+			if page.Values[i].Key == cred.Variable {
+				return &page.Values[i], nil
+			}
+		}
+		next = page.Next
+	}
+	return nil, nil
+}
+
+//UpdateVariable sets the value on the secured variable
+//looking it up by its key, the variable is created if it is missing
+func UpdateVariable(
+	ctx context.Context,
+	client *http.Client,
+	baseURL string,
+	cred *config.Credential,
+	value string,
+) error {
+	variables, err := variablesURL(ctx, client, baseURL, cred)
+	if err != nil {
+		return err
+	}
+	variable, err := findVariable(ctx, client, variables, cred)
+	if err != nil {
+		return err
+	}
+	if variable == nil {
+		err = doBitbucketRequest(ctx, client, http.MethodPost, variables+"/", &Variable{
+			Key:     cred.Variable,
+			Value:   value,
+			Secured: true,
+		}, nil)
+		if err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"repository":  cred.Repository,
+			"environment": cred.BitbucketEnvironment,
+			"variable":    cred.Variable,
+		}).Info("created missing variable")
+		return nil
+	}
+	return doBitbucketRequest(
+		ctx,
+		client,
+		http.MethodPut,
+		variables+"/"+url.PathEscape(variable.UUID),
+		&Variable{
+			UUID:    variable.UUID,
+			Key:     cred.Variable,
+			Value:   value,
+			Secured: true,
+		},
+		nil,
+	)
+}
+
+//RemoveVariable removes the variable with the key of the
+//credential, a variable that doesn't exist is already removed
+func RemoveVariable(
+	ctx context.Context,
+	client *http.Client,
+	baseURL string,
+	cred *config.Credential,
+) error {
+	variables, err := variablesURL(ctx, client, baseURL, cred)
+	if err != nil {
+		return err
+	}
+	variable, err := findVariable(ctx, client, variables, cred)
+	if err != nil || variable == nil {
+		return err
+	}
+	return doBitbucketRequest(
+		ctx,
+		client,
+		http.MethodDelete,
+		variables+"/"+url.PathEscape(variable.UUID),
+		nil,
+		nil,
+	)
+}
+
+//CheckVariables makes sure the repository and deployment
+//environment exist and their variables can be listed
+func CheckVariables(
+	ctx context.Context,
+	client *http.Client,
+	baseURL string,
+	cred *config.Credential,
+) error {
+	variables, err := variablesURL(ctx, client, baseURL, cred)
+	if err != nil {
+		return err
+	}
+	_, err = findVariable(ctx, client, variables, cred)
+	return err
+}
@@ -0,0 +1,173 @@
+package bitbucket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/Spazzy757/credentials-rotator/pkg/test"
+	"github.com/stretchr/testify/require"
+)
+
+func existingVariables() []test.MockBitbucketVariable {
+	return []test.MockBitbucketVariable{
+		{UUID: "{first}", Key: "FIRST", Value: "first value"},
+		{UUID: "{second}", Key: "SECOND", Value: "second value", Secured: true},
+		{UUID: "{existing}", Key: "TEST_VARIABLE", Value: "old value", Secured: true},
+	}
+}
+
+func TestUpdateVariable(t *testing.T) {
+	cred := config.Credential{Repository: "workspace/repo", Variable: "TEST_VARIABLE"}
+	t.Run("existing variable on a later page gets updated", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupBitbucketTestServer(t)
+		defer server.Close()
+		mock.Variables = map[string][]test.MockBitbucketVariable{"": existingVariables()}
+
+		err := UpdateVariable(context.Background(), client, server.URL, &cred, "ABCDBC")
+		assertions.NoError(err)
+
+		variables := mock.Variables[""]
+		assertions.Len(variables, 3)
+		assertions.Equal("{existing}", variables[2].UUID)
+		assertions.Equal("ABCDBC", variables[2].Value)
+		assertions.True(variables[2].Secured)
+		assertions.Equal("first value", variables[0].Value)
+	})
+	t.Run("missing variable gets created secured", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupBitbucketTestServer(t)
+		defer server.Close()
+
+		err := UpdateVariable(context.Background(), client, server.URL, &cred, "ABCDBC")
+		assertions.NoError(err)
+
+		variables := mock.Variables[""]
+		assertions.Len(variables, 1)
+		assertions.Equal("TEST_VARIABLE", variables[0].Key)
+		assertions.Equal("ABCDBC", variables[0].Value)
+		assertions.True(variables[0].Secured)
+	})
+	t.Run("deployment variable gets updated", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupBitbucketTestServer(t)
+		defer server.Close()
+		mock.Environments = []test.MockBitbucketEnvironment{
+			{UUID: "{test}", Name: "Test"},
+			{UUID: "{staging}", Name: "Staging"},
+			{UUID: "{production}", Name: "Production"},
+		}
+		mock.Variables = map[string][]test.MockBitbucketVariable{
+			"":             existingVariables(),
+			"{production}": existingVariables(),
+		}
+		envCred := cred
+		envCred.BitbucketEnvironment = "Production"
+
+		err := UpdateVariable(context.Background(), client, server.URL, &envCred, "ABCDBC")
+		assertions.NoError(err)
+
+		assertions.Equal("ABCDBC", mock.Variables["{production}"][2].Value)
+		assertions.Equal("old value", mock.Variables[""][2].Value)
+	})
+	t.Run("missing environment is not found", func(t *testing.T) {
+		assertions := require.New(t)
+		_, server, client := test.SetupBitbucketTestServer(t)
+		defer server.Close()
+		envCred := cred
+		envCred.BitbucketEnvironment = "Production"
+
+		err := UpdateVariable(context.Background(), client, server.URL, &envCred, "ABCDBC")
+		assertions.True(errors.Is(err, destination.ErrNotFound))
+	})
+	t.Run("missing repository returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		_, server, client := test.SetupBitbucketTestServer(t)
+		defer server.Close()
+		missingCred := cred
+		missingCred.Repository = "workspace/missing"
+
+		err := UpdateVariable(context.Background(), client, server.URL, &missingCred, "ABCDBC")
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "Repository not found")
+	})
+	t.Run("invalid repository returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		invalidCred := cred
+		invalidCred.Repository = "repo"
+
+		err := UpdateVariable(context.Background(), http.DefaultClient, "", &invalidCred, "ABCDBC")
+		assertions.Error(err)
+	})
+	t.Run("unauthenticated request returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		_, server, _ := test.SetupBitbucketTestServer(t)
+		defer server.Close()
+
+		err := UpdateVariable(context.Background(), http.DefaultClient, server.URL, &cred, "ABCDBC")
+		assertions.EqualError(
+			err,
+			"GET "+server.URL+"/repositories/workspace/repo/pipelines_config/variables/?pagelen=100: "+
+				"401 Access token expired",
+		)
+	})
+}
+
+func TestRemoveVariable(t *testing.T) {
+	cred := config.Credential{Repository: "workspace/repo", Variable: "TEST_VARIABLE"}
+	t.Run("variable gets removed", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupBitbucketTestServer(t)
+		defer server.Close()
+		mock.Variables = map[string][]test.MockBitbucketVariable{"": existingVariables()}
+
+		err := RemoveVariable(context.Background(), client, server.URL, &cred)
+		assertions.NoError(err)
+
+		variables := mock.Variables[""]
+		assertions.Len(variables, 2)
+		assertions.Equal("SECOND", variables[1].Key)
+	})
+	t.Run("missing variable is ignored", func(t *testing.T) {
+		assertions := require.New(t)
+		_, server, client := test.SetupBitbucketTestServer(t)
+		defer server.Close()
+
+		err := RemoveVariable(context.Background(), client, server.URL, &cred)
+		assertions.NoError(err)
+	})
+}
+
+func TestCheckVariables(t *testing.T) {
+	t.Run("variables that can be listed pass", func(t *testing.T) {
+		assertions := require.New(t)
+		_, server, client := test.SetupBitbucketTestServer(t)
+		defer server.Close()
+		cred := config.Credential{Repository: "workspace/repo", Variable: "TEST_VARIABLE"}
+
+		err := CheckVariables(context.Background(), client, server.URL, &cred)
+		assertions.NoError(err)
+	})
+	t.Run("missing repository fails", func(t *testing.T) {
+		assertions := require.New(t)
+		_, server, client := test.SetupBitbucketTestServer(t)
+		defer server.Close()
+		cred := config.Credential{Repository: "workspace/missing", Variable: "TEST_VARIABLE"}
+
+		err := CheckVariables(context.Background(), client, server.URL, &cred)
+		assertions.True(errors.Is(err, destination.ErrNotFound))
+	})
+}
+
+func TestVariableDestination(t *testing.T) {
+	t.Run("missing credentials fail the destination", func(t *testing.T) {
+		assertions := require.New(t)
+		_, err := NewVariableDestination(&config.Config{})
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "BITBUCKET_TOKEN")
+	})
+}
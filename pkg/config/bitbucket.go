@@ -0,0 +1,39 @@
+package config
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/helpers"
+	"github.com/Spazzy757/credentials-rotator/pkg/httpapi"
+)
+
+//getBitbucketClient creates a http client that authenticates with
+//the access token in BITBUCKET_TOKEN or the app password in
+//BITBUCKET_USERNAME and BITBUCKET_APP_PASSWORD and attaches it
+//to the configuration, no client is attached when neither is set
+func getBitbucketClient(cfg *Config) {
+	if cfg.BitbucketURL == "" {
+		cfg.BitbucketURL = "https://api.bitbucket.org/2.0"
+	}
+	token := helpers.GetEnv("BITBUCKET_TOKEN", "")
+	username := helpers.GetEnv("BITBUCKET_USERNAME", "")
+	appPassword := helpers.GetEnv("BITBUCKET_APP_PASSWORD", "")
+	var transport http.RoundTripper
+	switch {
+	case token != "":
+		transport = httpapi.BearerTransport(token, http.DefaultTransport)
+	case username != "" && appPassword != "":
+		transport = &httpapi.BasicAuthTransport{
+			Username: username,
+			Password: appPassword,
+			Base:     http.DefaultTransport,
+		}
+	default:
+		return
+	}
+	cfg.BitbucketClient = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: transport,
+	}
+}
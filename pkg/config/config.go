@@ -4,11 +4,36 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	iam "cloud.google.com/go/iam/admin/apiv1"
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"github.com/Spazzy757/credentials-rotator/pkg/helpers"
+	"github.com/Spazzy757/credentials-rotator/pkg/httpapi"
+	"github.com/Spazzy757/credentials-rotator/pkg/state"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awsiam "github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/google/go-github/v35/github"
 	"github.com/xanzy/go-gitlab"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"google.golang.org/api/option"
+	storage "google.golang.org/api/storage/v1"
+	"google.golang.org/grpc"
 	"gopkg.in/yaml.v2"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 //Config used for the CLI command
@@ -19,18 +44,139 @@ type Config struct {
 	// with a Gitlab instance
 	GitlabClient *gitlab.Client
 
+	// Clients of the named Gitlab connections
+	GitlabClients map[string]*gitlab.Client `yaml:"-"`
+
+	// The GithubClient that will be used to communicate
+	// with the Github API
+	GithubClient *github.Client `yaml:"-"`
+
+	// The AWS IAM Client that is used to
+	// communicate with the AWS IAM API
+	AWSIAMClient iamiface.IAMAPI `yaml:"-"`
+
+	// The AWS Secrets Manager client used to write secrets
+	AWSSecretsManagerClient secretsmanageriface.SecretsManagerAPI `yaml:"-"`
+
+	// The AWS SSM client used to write Parameter Store parameters
+	AWSSSMClient ssmiface.SSMAPI `yaml:"-"`
+
+	// The endpoint of AWS Secrets Manager, defaults to
+	// the endpoint of the region e.g for a local stand-in
+	AWSSecretsManagerEndpoint string `yaml:"aws_secrets_manager_endpoint,omitempty"`
+
+	// The endpoint of AWS SSM, defaults to
+	// the endpoint of the region e.g for a local stand-in
+	AWSSSMEndpoint string `yaml:"aws_ssm_endpoint,omitempty"`
+
+	// The Kubernetes client used to write Secrets, not
+	// set when there is no kubeconfig and it isn't running in a cluster
+	KubernetesClient kubernetes.Interface `yaml:"-"`
+
+	// Path to the kubeconfig used for Kubernetes destinations,
+	// defaults to KUBECONFIG, ~/.kube/config or the in-cluster config
+	Kubeconfig string `yaml:"kubeconfig,omitempty"`
+
+	// The kubeconfig context to use, defaults to the current context
+	KubeContext string `yaml:"kube_context,omitempty"`
+
+	// The http client used to communicate with Microsoft Graph,
+	// it authenticates as the service principal in the
+	// AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET env variables
+	AzureGraphClient *http.Client `yaml:"-"`
+
+	// The URL of the Microsoft Graph API
+	// defaults to https://graph.microsoft.com
+	AzureGraphURL string `yaml:"azure_graph_url,omitempty"`
+
+	// The token endpoint used to authenticate with Azure AD, defaults
+	// to https://login.microsoftonline.com/<tenant>/oauth2/v2.0/token
+	AzureTokenURL string `yaml:"azure_token_url,omitempty"`
+
+	// The tenant of the Azure AD application registrations,
+	// defaults to the AZURE_TENANT_ID env variable
+	AzureTenantID string `yaml:"azure_tenant_id,omitempty"`
+
+	// The http client used to communicate with Azure DevOps, it
+	// authenticates with the personal access token in AZURE_DEVOPS_EXT_PAT
+	AzureDevOpsClient *http.Client `yaml:"-"`
+
+	// The URL of Azure DevOps, defaults to https://dev.azure.com
+	// e.g the collection URL of an Azure DevOps Server
+	AzureDevOpsURL string `yaml:"azure_devops_url,omitempty"`
+
+	// The http client used to communicate with Bitbucket Cloud
+	BitbucketClient *http.Client `yaml:"-"`
+
+	// The URL of the Bitbucket Cloud API
+	// defaults to https://api.bitbucket.org/2.0
+	BitbucketURL string `yaml:"bitbucket_url,omitempty"`
+
+	// The http client used to communicate with Vault, it logs in
+	// with the auth method of the vault connection, not set
+	// when there is no Vault address
+	VaultClient *http.Client `yaml:"-"`
+
+	// The Vault server credentials are written to
+	Vault VaultConnection `yaml:"vault,omitempty"`
+
 	// The Google IAM Client that is used to communicate with
 	// Google Clouds IAM service
 	GoogleIAMClient *iam.IamClient
 
+	// The Google Secret Manager client used
+	// to write keys as secret versions
+	GoogleSecretManagerClient *secretmanager.Client `yaml:"-"`
+
+	// The Google Cloud Storage service that is used
+	// to manage HMAC keys of service accounts
+	GoogleStorageService *storage.Service `yaml:"-"`
+
+	// State that is kept between runs e.g keys
+	// that are waiting to be revoked
+	State *state.State `yaml:"-"`
+
+	// File the state is persisted to between runs
+	// defaults to rotator-state.yaml
+	StateFile string `yaml:"state_file,omitempty"`
+
+	// How long an old key is kept after being rotated out
+	// used when a credential doesn't set its own revoke_after
+	RevokeAfter time.Duration `yaml:"revoke_after,omitempty"`
+
+	// How old the newest key can get before it is rotated
+	// used when a credential doesn't set its own max_age,
+	// when not set keys are rotated on every run
+	MaxAge time.Duration `yaml:"max_age,omitempty"`
+
+	// Rotate every credential regardless of its max_age
+	Force bool `yaml:"-"`
+
+	// Named Gitlab instances credentials can reference
+	// with gitlab_connection, e.g for self-managed Gitlab
+	GitlabConnections map[string]GitlabConnection `yaml:"gitlab_connections,omitempty"`
+
 	// List of credentials that will be used to update
 	Credentials []Credential `yaml:"credentials,omitempty"`
 }
 
 //Credential that needs to be updated
 type Credential struct {
-	// The type of Credential (only supports gitlab for now)
-	Type string `yaml:"type"`
+	// Name used to identify the credential in logs and results
+	// defaults to the destination type, where it is and the variable
+	Name string `yaml:"name,omitempty"`
+
+	// The type of destination the credential is written to e.g gitlab
+	Type string `yaml:"type,omitempty"`
+
+	// Destinations the same key is written to instead of a
+	// single destination, each entry takes the destination
+	// fields of a credential e.g type, project_id and variable
+	Destinations []Credential `yaml:"destinations,omitempty"`
+
+	// The type of source that issues the credential
+	// defaults to google
+	Source string `yaml:"source,omitempty"`
 
 	// The variable in the CI/CD to update
 	// e.g GOOGLE_APPLICATION_CREDENTIAL
@@ -42,8 +188,234 @@ type Credential struct {
 	// Project ID the gitlab repos project ID
 	ProjectID string `yaml:"project_id"`
 
+	// GitlabConnection the name of the gitlab connection
+	// to use, defaults to gitlab.com with GITLAB_TOKEN
+	GitlabConnection string `yaml:"gitlab_connection,omitempty"`
+
+	// GroupID the gitlab groups ID or full path
+	// e.g 1234 or my-group/sub-group
+	GroupID string `yaml:"group_id,omitempty"`
+
+	// EnvironmentScope the environment scope of the gitlab
+	// variable, used to pick between variables with the same key
+	// e.g production/*
+	EnvironmentScope string `yaml:"environment_scope,omitempty"`
+
+	// Protected only expose the gitlab variable
+	// to protected branches and tags
+	Protected *bool `yaml:"protected,omitempty"`
+
+	// Masked hide the gitlab variable in job logs
+	Masked *bool `yaml:"masked,omitempty"`
+
+	// VariableType the type of the gitlab variable
+	// file or env_var, defaults to file
+	VariableType string `yaml:"variable_type,omitempty"`
+
+	// Repository the github repository e.g owner/repo
+	// or the bitbucket repository e.g workspace/repo_slug
+	Repository string `yaml:"repository,omitempty"`
+
+	// GithubEnvironment the environment on the github
+	// repository to set the secret on e.g production
+	GithubEnvironment string `yaml:"github_environment,omitempty"`
+
+	// GithubOrg the github organization to set the
+	// secret on instead of a repository
+	GithubOrg string `yaml:"github_org,omitempty"`
+
+	// GithubVisibility which repositories can access the org secret
+	// all, private or selected, defaults to selected when
+	// github_selected_repositories is set otherwise private
+	GithubVisibility string `yaml:"github_visibility,omitempty"`
+
+	// GithubSelectedRepositories the names of the repositories in
+	// the org that can access the org secret
+	GithubSelectedRepositories []string `yaml:"github_selected_repositories,omitempty"`
+
+	// FieldVariables writes the fields of keys made up of
+	// more than one value to separate variables instead of
+	// writing the whole key to variable
+	// e.g access_key_id: AWS_ACCESS_KEY_ID
+	FieldVariables map[string]string `yaml:"field_variables,omitempty"`
+
+	// AWSUser the name of the AWS IAM user to rotate access keys for
+	AWSUser string `yaml:"aws_user,omitempty"`
+
+	// AWSKMSKeyID the KMS key AWS Secrets Manager secrets and SSM
+	// parameters are encrypted with, defaults to the AWS managed key,
+	// variable is used as the name of the secret or parameter
+	AWSKMSKeyID string `yaml:"aws_kms_key_id,omitempty"`
+
+	// AzureApplicationID the application (client) ID of the Azure AD
+	// app registration to rotate the client secrets of
+	AzureApplicationID string `yaml:"azure_application_id,omitempty"`
+
+	// AzureSecretExpiry how long new client secrets are valid
+	// e.g 2160h, defaults to 90 days
+	AzureSecretExpiry time.Duration `yaml:"azure_secret_expiry,omitempty"`
+
+	// AzureDevOpsOrganization the Azure DevOps organization
+	// of the variable group, variable is used as the variable in it
+	AzureDevOpsOrganization string `yaml:"azure_devops_organization,omitempty"`
+
+	// AzureDevOpsProject the Azure DevOps project of the variable group
+	AzureDevOpsProject string `yaml:"azure_devops_project,omitempty"`
+
+	// AzureDevOpsGroup the name of the variable group
+	AzureDevOpsGroup string `yaml:"azure_devops_group,omitempty"`
+
+	// KubernetesNamespace the namespace of the Kubernetes Secret
+	// defaults to default, variable is used as the key in the Secret
+	KubernetesNamespace string `yaml:"kubernetes_namespace,omitempty"`
+
+	// KubernetesSecret the name of the Kubernetes Secret
+	KubernetesSecret string `yaml:"kubernetes_secret,omitempty"`
+
+	// KubernetesAnnotate annotate the Kubernetes Secret
+	// with when it was rotated and the ID of the key
+	KubernetesAnnotate bool `yaml:"kubernetes_annotate,omitempty"`
+
+	// VaultMount the path the KV secrets engine is mounted at
+	// defaults to secret, variable is used as the field of the secret
+	VaultMount string `yaml:"vault_mount,omitempty"`
+
+	// VaultPath the path of the secret in the KV secrets engine
+	VaultPath string `yaml:"vault_path,omitempty"`
+
+	// VaultKVVersion the version of the KV secrets engine
+	// either 1 or 2, defaults to 2
+	VaultKVVersion int `yaml:"vault_kv_version,omitempty"`
+
+	// GoogleSecretProject the project of the Secret Manager secret
+	// defaults to google_project_id, variable is used as the secret ID
+	GoogleSecretProject string `yaml:"google_secret_project,omitempty"`
+
+	// BitbucketEnvironment the name of the deployment environment
+	// of the bitbucket repository to set the variable on e.g Production
+	BitbucketEnvironment string `yaml:"bitbucket_environment,omitempty"`
+
+	// FileMode the permissions of files written by the file
+	// destination in octal e.g 0640, defaults to 0600,
+	// variable is used as the path of the file
+	FileMode string `yaml:"file_mode,omitempty"`
+
+	// SOPSFile the path of the SOPS encrypted YAML or JSON
+	// document to update, variable is used as the key in it
+	SOPSFile string `yaml:"sops_file,omitempty"`
+
+	// SOPSPath the keys leading to the map the variable is
+	// set in e.g [stringData], defaults to the top of the document
+	SOPSPath []string `yaml:"sops_path,omitempty"`
+
 	// Google Project ID where the service account is located
 	GoogleProjectID string `yaml:"google_project_id"`
+
+	// How long an old key is kept after being rotated out
+	// e.g 24h, overrides the global revoke_after
+	RevokeAfter *time.Duration `yaml:"revoke_after,omitempty"`
+
+	// How old the newest key can get before it is rotated
+	// e.g 720h, overrides the global max_age
+	MaxAge *time.Duration `yaml:"max_age,omitempty"`
+}
+
+//String identifies the credential in logs and errors
+func (c *Credential) String() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	if len(c.Destinations) > 0 {
+		names := []string{}
+		for i := range c.Destinations {
+			names = append(names, c.Destinations[i].String())
+		}
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s %s", c.Type, strings.Join(append(c.location(), c.Variable), "/"))
+}
+
+//location returns where the variable of the destination is,
+//so destinations with the same variable can be told apart
+//e.g the gitlab project or the github repository
+func (c *Credential) location() []string {
+	location := []string{}
+	for _, part := range []string{
+		c.GitlabConnection,
+		c.ProjectID,
+		c.GroupID,
+		c.EnvironmentScope,
+		c.Repository,
+		c.GithubOrg,
+		c.GithubEnvironment,
+		c.BitbucketEnvironment,
+		c.AzureDevOpsOrganization,
+		c.AzureDevOpsProject,
+		c.AzureDevOpsGroup,
+		c.KubernetesNamespace,
+		c.KubernetesSecret,
+		c.VaultMount,
+		c.VaultPath,
+		c.GoogleSecretProject,
+		c.SOPSFile,
+	} {
+		if part != "" {
+			location = append(location, part)
+		}
+	}
+	return location
+}
+
+//sourceAccount returns the account the keys of the credential are
+//issued for e.g the service account, empty when none is set
+func (c *Credential) sourceAccount() string {
+	account := []string{}
+	for _, part := range []string{
+		c.GoogleProjectID,
+		c.ServiceAccount,
+		c.AWSUser,
+		c.AzureApplicationID,
+	} {
+		if part != "" {
+			account = append(account, part)
+		}
+	}
+	if len(account) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s %s", c.Source, strings.Join(account, "/"))
+}
+
+//Targets returns the destinations the key of the
+//credential is written to, which is the credential
+//itself when it doesn't list any destinations
+func (c *Credential) Targets() []*Credential {
+	if len(c.Destinations) == 0 {
+		return []*Credential{c}
+	}
+	targets := []*Credential{}
+	for i := range c.Destinations {
+		targets = append(targets, &c.Destinations[i])
+	}
+	return targets
+}
+
+//GracePeriod returns how long old keys are kept
+//before being revoked
+func (c *Credential) GracePeriod() time.Duration {
+	if c.RevokeAfter == nil {
+		return 0
+	}
+	return *c.RevokeAfter
+}
+
+//MaxKeyAge returns how old the newest key can
+//get before it is rotated, zero means always rotate
+func (c *Credential) MaxKeyAge() time.Duration {
+	if c.MaxAge == nil {
+		return 0
+	}
+	return *c.MaxAge
 }
 
 //LoadConfig loads the config from a file
@@ -59,14 +431,158 @@ func (c *Config) LoadConfig(config_file string) error {
 	}
 	ctx := context.Background()
 	c.Ctx = ctx
+	setDefaults(c)
+	err = validate(c)
+	if err != nil {
+		return err
+	}
+	c.State, err = state.Load(c.StateFile)
+	if err != nil {
+		return err
+	}
 	err = getGitlabClient(c)
 	if err != nil {
 		return err
 	}
-	err = getGoogleIAMClient(c)
+	err = getGitlabClients(c)
+	if err != nil {
+		return err
+	}
+	err = getGithubClient(c)
+	if err != nil {
+		return err
+	}
+	err = getAWSClients(c)
+	if err != nil {
+		return err
+	}
+	if c.uses("azure-ad") {
+		getAzureGraphClient(c)
+	}
+	getAzureDevOpsClient(c)
+	getBitbucketClient(c)
+	err = getKubernetesClient(c)
+	if err != nil {
+		return err
+	}
+	err = getVaultClient(c)
+	if err != nil {
+		return err
+	}
+	// the google clients need application default
+	// credentials so they are only created when used
+	if c.uses("google") {
+		err = getGoogleIAMClient(c)
+		if err != nil {
+			return err
+		}
+	}
+	if c.uses("google-secret-manager") {
+		err = getGoogleSecretManagerClient(c)
+		if err != nil {
+			return err
+		}
+	}
+	if c.uses("google-hmac") {
+		err = getGoogleStorageService(c)
+	}
 	return err
 }
 
+//uses checks if a credential issues keys from or writes them
+//to the source or destination type, keys pending revocation
+//count as well as they are revoked through their source
+func (c *Config) uses(name string) bool {
+	for i := range c.Credentials {
+		if c.Credentials[i].Source == name {
+			return true
+		}
+		for _, target := range c.Credentials[i].Targets() {
+			if target.Type == name {
+				return true
+			}
+		}
+	}
+	for _, pending := range c.State.PendingRevocations {
+		if pending.Source == name {
+			return true
+		}
+	}
+	return false
+}
+
+//setDefaults fills in any values
+//that were left out of the config file
+func setDefaults(cfg *Config) {
+	if cfg.StateFile == "" {
+		cfg.StateFile = "rotator-state.yaml"
+	}
+	for i := range cfg.Credentials {
+		if cfg.Credentials[i].Source == "" {
+			cfg.Credentials[i].Source = "google"
+		}
+		if cfg.Credentials[i].RevokeAfter == nil {
+			revokeAfter := cfg.RevokeAfter
+			cfg.Credentials[i].RevokeAfter = &revokeAfter
+		}
+		if cfg.Credentials[i].MaxAge == nil {
+			maxAge := cfg.MaxAge
+			cfg.Credentials[i].MaxAge = &maxAge
+		}
+		// destinations usually use the same variable names
+		for j := range cfg.Credentials[i].Destinations {
+			if cfg.Credentials[i].Destinations[j].Variable == "" {
+				cfg.Credentials[i].Destinations[j].Variable = cfg.Credentials[i].Variable
+			}
+			if cfg.Credentials[i].Destinations[j].FieldVariables == nil {
+				cfg.Credentials[i].Destinations[j].FieldVariables = cfg.Credentials[i].FieldVariables
+			}
+			// destinations in google cloud default to the project of the credential
+			if cfg.Credentials[i].Destinations[j].GoogleProjectID == "" {
+				cfg.Credentials[i].Destinations[j].GoogleProjectID = cfg.Credentials[i].GoogleProjectID
+			}
+		}
+	}
+}
+
+//validate checks the configuration for mistakes
+//that span more than one credential
+func validate(cfg *Config) error {
+	accounts := map[string]string{}
+	for i := range cfg.Credentials {
+		cred := &cfg.Credentials[i]
+		for _, target := range cred.Targets() {
+			// only org secrets with selected visibility have selected repositories
+			if len(target.GithubSelectedRepositories) > 0 &&
+				target.GithubVisibility != "" &&
+				target.GithubVisibility != "selected" {
+				return fmt.Errorf(
+					"%s: github_selected_repositories needs github_visibility selected, not %s",
+					target,
+					target.GithubVisibility,
+				)
+			}
+		}
+		account := cred.sourceAccount()
+		if account == "" {
+			continue
+		}
+		// every key of the account other than the newest is revoked
+		// so a second credential would revoke the keys of the first
+		if other, ok := accounts[account]; ok {
+			return fmt.Errorf(
+				"credentials %s and %s both use %s, list the destinations "+
+					"of both under destinations of a single credential instead",
+				other,
+				cred,
+				account,
+			)
+		}
+		accounts[account] = cred.String()
+	}
+	return nil
+}
+
 //getGitlabClient creates a gitlab client
 //and attaches it to the configuration
 func getGitlabClient(cfg *Config) error {
@@ -91,6 +607,164 @@ func getGitlabClient(cfg *Config) error {
 	return nil
 }
 
+//getGithubClient creates a github client
+//and attaches it to the configuration
+func getGithubClient(cfg *Config) error {
+	isTest := helpers.GetEnv("TEST", "")
+	if isTest != "true" {
+		token := helpers.GetEnv("GITHUB_TOKEN", "")
+		ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+		cfg.GithubClient = github.NewClient(oauth2.NewClient(cfg.Ctx, ts))
+		return nil
+	}
+	// If test check for test URL
+	// this should point to a test server
+	serverURL := helpers.GetEnv("GITHUB_TEST_SERVER_URL", "")
+	if !strings.HasSuffix(serverURL, "/") {
+		serverURL += "/"
+	}
+	baseURL, err := url.Parse(serverURL)
+	if err != nil {
+		return err
+	}
+	c := github.NewClient(nil)
+	c.BaseURL = baseURL
+	cfg.GithubClient = c
+	return nil
+}
+
+//getAWSSession creates an AWS session using the default credential chain
+func getAWSSession() (*session.Session, error) {
+	isTest := helpers.GetEnv("TEST", "")
+	if isTest != "true" {
+		return session.NewSessionWithOptions(session.Options{
+			SharedConfigState: session.SharedConfigEnable,
+		})
+	}
+	// If test check for test URL
+	// this should point to a test server
+	serverURL := helpers.GetEnv("AWS_TEST_SERVER_URL", "")
+	return session.NewSession(&aws.Config{
+		Endpoint:    aws.String(serverURL),
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("test", "test", ""),
+	})
+}
+
+//awsEndpoint returns the config overriding
+//the endpoint of a service if it is set
+func awsEndpoint(endpoint string) *aws.Config {
+	if endpoint == "" {
+		return &aws.Config{}
+	}
+	return &aws.Config{Endpoint: aws.String(endpoint)}
+}
+
+//getAWSClients creates the AWS IAM, Secrets Manager and SSM
+//clients the credentials use and attaches them to the configuration
+func getAWSClients(cfg *Config) error {
+	iamUsed := cfg.uses("aws-iam")
+	secretsManagerUsed := cfg.uses("aws-secrets-manager")
+	ssmUsed := cfg.uses("aws-ssm")
+	if !iamUsed && !secretsManagerUsed && !ssmUsed {
+		return nil
+	}
+	sess, err := getAWSSession()
+	if err != nil {
+		return err
+	}
+	if iamUsed {
+		cfg.AWSIAMClient = awsiam.New(sess)
+	}
+	if secretsManagerUsed {
+		cfg.AWSSecretsManagerClient = secretsmanager.New(sess, awsEndpoint(cfg.AWSSecretsManagerEndpoint))
+	}
+	if ssmUsed {
+		cfg.AWSSSMClient = ssm.New(sess, awsEndpoint(cfg.AWSSSMEndpoint))
+	}
+	return nil
+}
+
+//getAzureGraphClient creates a http client that authenticates
+//with the client credentials flow and attaches it to the configuration
+func getAzureGraphClient(cfg *Config) {
+	if cfg.AzureGraphURL == "" {
+		cfg.AzureGraphURL = "https://graph.microsoft.com"
+	}
+	if cfg.AzureTenantID == "" {
+		cfg.AzureTenantID = helpers.GetEnv("AZURE_TENANT_ID", "")
+	}
+	tokenURL := cfg.AzureTokenURL
+	if tokenURL == "" {
+		tokenURL = fmt.Sprintf(
+			"https://login.microsoftonline.com/%s/oauth2/v2.0/token",
+			cfg.AzureTenantID,
+		)
+	}
+	// the token is only requested once the client is used
+	credentials := clientcredentials.Config{
+		ClientID:     helpers.GetEnv("AZURE_CLIENT_ID", ""),
+		ClientSecret: helpers.GetEnv("AZURE_CLIENT_SECRET", ""),
+		TokenURL:     tokenURL,
+		Scopes:       []string{strings.TrimSuffix(cfg.AzureGraphURL, "/") + "/.default"},
+	}
+	cfg.AzureGraphClient = credentials.Client(cfg.Ctx)
+}
+
+//getAzureDevOpsClient creates a http client that authenticates
+//with a personal access token and attaches it to the configuration
+func getAzureDevOpsClient(cfg *Config) {
+	if cfg.AzureDevOpsURL == "" {
+		cfg.AzureDevOpsURL = "https://dev.azure.com"
+	}
+	cfg.AzureDevOpsClient = &http.Client{
+		Timeout: 30 * time.Second,
+		// the user name is ignored for personal access tokens
+		Transport: &httpapi.BasicAuthTransport{
+			Password: helpers.GetEnv("AZURE_DEVOPS_EXT_PAT", ""),
+			Base:     http.DefaultTransport,
+		},
+	}
+}
+
+//getKubernetesClient creates a kubernetes client from the kubeconfig
+//or in-cluster config and attaches it to the configuration,
+//no client is attached when neither can be found
+func getKubernetesClient(cfg *Config) error {
+	isTest := helpers.GetEnv("TEST", "")
+	if isTest == "true" {
+		// If test check for test URL
+		// this should point to a test server
+		serverURL := helpers.GetEnv("KUBERNETES_TEST_SERVER_URL", "")
+		c, err := kubernetes.NewForConfig(&rest.Config{Host: serverURL})
+		if err != nil {
+			return err
+		}
+		cfg.KubernetesClient = c
+		return nil
+	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = cfg.Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: cfg.KubeContext}
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		rules,
+		overrides,
+	).ClientConfig()
+	if clientcmd.IsEmptyConfig(err) && cfg.Kubeconfig == "" {
+		// only a problem if a credential uses kubernetes
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed loading kubeconfig: %v", err)
+	}
+	c, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	cfg.KubernetesClient = c
+	return nil
+}
+
 //getGoogleIAMClient creates a client and
 //attaches it to the configuration
 func getGoogleIAMClient(cfg *Config) error {
@@ -101,3 +775,46 @@ func getGoogleIAMClient(cfg *Config) error {
 	cfg.GoogleIAMClient = c
 	return nil
 }
+
+//getGoogleSecretManagerClient creates a secret
+//manager client and attaches it to the configuration
+func getGoogleSecretManagerClient(cfg *Config) error {
+	opts := []option.ClientOption{}
+	isTest := helpers.GetEnv("TEST", "")
+	if isTest == "true" {
+		// If test check for test URL
+		// this should point to a test server
+		opts = append(opts,
+			option.WithEndpoint(helpers.GetEnv("GOOGLE_SECRET_MANAGER_TEST_SERVER_URL", "")),
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithInsecure()),
+		)
+	}
+	c, err := secretmanager.NewClient(cfg.Ctx, opts...)
+	if err != nil {
+		return err
+	}
+	cfg.GoogleSecretManagerClient = c
+	return nil
+}
+
+//getGoogleStorageService creates a storage
+//service and attaches it to the configuration
+func getGoogleStorageService(cfg *Config) error {
+	opts := []option.ClientOption{}
+	isTest := helpers.GetEnv("TEST", "")
+	if isTest == "true" {
+		// If test check for test URL
+		// this should point to a test server
+		opts = append(opts,
+			option.WithEndpoint(helpers.GetEnv("GOOGLE_STORAGE_TEST_SERVER_URL", "")),
+			option.WithoutAuthentication(),
+		)
+	}
+	s, err := storage.NewService(cfg.Ctx, opts...)
+	if err != nil {
+		return err
+	}
+	cfg.GoogleStorageService = s
+	return nil
+}
@@ -1,13 +1,23 @@
 package config
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"testing"
+	"time"
 
+	"github.com/Spazzy757/credentials-rotator/pkg/test"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v2"
+	"k8s.io/client-go/kubernetes"
 )
 
 func TestConfigLoad(t *testing.T) {
@@ -42,12 +52,20 @@ func TestConfigLoad(t *testing.T) {
 		assertions.Equal(cfg.Credentials[0].Variable, "TEST_VARIABLE")
 		assertions.Equal(cfg.Credentials[0].ServiceAccount, "test@example.com")
 		assertions.Equal(gitlabClientUrl.Host, "gitlab.com")
+		assertions.Equal(cfg.GithubClient.BaseURL.Host, "api.github.com")
 	})
 	t.Run("loading file returns test configuration", func(t *testing.T) {
 		assertions := require.New(t)
 		os.Setenv("GITLAB_TEST_SERVER_URL", "http://example.com")
+		os.Setenv("GITHUB_TEST_SERVER_URL", "http://github.example.com")
+		os.Setenv("AWS_TEST_SERVER_URL", "http://aws.example.com")
+		os.Setenv("GOOGLE_STORAGE_TEST_SERVER_URL", "http://storage.example.com/storage/v1/")
+		os.Setenv("KUBERNETES_TEST_SERVER_URL", "http://kubernetes.example.com")
+		os.Setenv("GOOGLE_SECRET_MANAGER_TEST_SERVER_URL", "localhost:8085")
 		os.Setenv("TEST", "true")
 		testConfig := Config{
+			AWSSecretsManagerEndpoint: "http://secretsmanager.example.com",
+			AWSSSMEndpoint:            "http://ssm.example.com",
 			Credentials: []Credential{
 				Credential{
 					Type:           "test",
@@ -55,6 +73,24 @@ func TestConfigLoad(t *testing.T) {
 					Variable:       "TEST_VARIABLE",
 					ServiceAccount: "test@example.com",
 				},
+				Credential{
+					Name:     "aws",
+					Source:   "aws-iam",
+					AWSUser:  "deployer",
+					Variable: "TEST_VARIABLE",
+					Destinations: []Credential{
+						Credential{Type: "aws-secrets-manager"},
+						Credential{Type: "aws-ssm"},
+						Credential{Type: "google-secret-manager"},
+					},
+				},
+				Credential{
+					Name:           "hmac",
+					Source:         "google-hmac",
+					ServiceAccount: "hmac@example.com",
+					Type:           "test",
+					Variable:       "TEST_VARIABLE",
+				},
 			},
 		}
 		configBytes, err := yaml.Marshal(testConfig)
@@ -71,6 +107,48 @@ func TestConfigLoad(t *testing.T) {
 		assertions.Equal(cfg.Credentials[0].Variable, "TEST_VARIABLE")
 		assertions.Equal(cfg.Credentials[0].ServiceAccount, "test@example.com")
 		assertions.Equal(gitlabClientUrl.Host, "example.com")
+		assertions.Equal(cfg.GithubClient.BaseURL.Host, "github.example.com")
+		awsClient, ok := cfg.AWSIAMClient.(*iam.IAM)
+		assertions.True(ok)
+		assertions.Equal("http://aws.example.com", awsClient.Endpoint)
+		secretsManagerClient, ok := cfg.AWSSecretsManagerClient.(*secretsmanager.SecretsManager)
+		assertions.True(ok)
+		assertions.Equal("http://secretsmanager.example.com", secretsManagerClient.Endpoint)
+		ssmClient, ok := cfg.AWSSSMClient.(*ssm.SSM)
+		assertions.True(ok)
+		assertions.Equal("http://ssm.example.com", ssmClient.Endpoint)
+		assertions.Equal("http://storage.example.com/storage/v1/", cfg.GoogleStorageService.BasePath)
+		assertions.Equal("localhost:8085", cfg.GoogleSecretManagerClient.Connection().Target())
+		kubernetesClient, ok := cfg.KubernetesClient.(*kubernetes.Clientset)
+		assertions.True(ok)
+		assertions.Equal(
+			"kubernetes.example.com",
+			kubernetesClient.CoreV1().RESTClient().Get().URL().Host,
+		)
+	})
+	t.Run("clients are only created for the sources and destinations in use", func(t *testing.T) {
+		assertions := require.New(t)
+		configBytes := []byte(`
+credentials:
+- type: gitlab
+  source: aws-iam
+  aws_user: deployer
+  project_id: "1234"
+  variable: TEST_VARIABLE
+`)
+		tmpDir := os.TempDir()
+		ioutil.WriteFile(path.Join(tmpDir, "config.yaml"), configBytes, 0644)
+		defer os.RemoveAll(path.Join(tmpDir, "config.yaml"))
+		cfg := Config{}
+		err := cfg.LoadConfig(path.Join(tmpDir, "config.yaml"))
+		assertions.NoError(err)
+		assertions.NotNil(cfg.AWSIAMClient)
+		assertions.Nil(cfg.AWSSecretsManagerClient)
+		assertions.Nil(cfg.AWSSSMClient)
+		assertions.Nil(cfg.AzureGraphClient)
+		assertions.Nil(cfg.GoogleIAMClient)
+		assertions.Nil(cfg.GoogleSecretManagerClient)
+		assertions.Nil(cfg.GoogleStorageService)
 	})
 	t.Run("loading invalid file", func(t *testing.T) {
 		assertions := require.New(t)
@@ -83,6 +161,142 @@ func TestConfigLoad(t *testing.T) {
 		assertions.Error(err)
 		assertions.Equal(cfg.Credentials, []Credential(nil))
 	})
+	t.Run("credentials default to the global durations", func(t *testing.T) {
+		assertions := require.New(t)
+		configBytes := []byte(`
+revoke_after: 24h
+max_age: 720h
+credentials:
+- type: gitlab
+  variable: TEST_VARIABLE
+- type: gitlab
+  variable: TEST_VARIABLE
+  revoke_after: 1h
+  max_age: 168h
+`)
+		tmpDir := os.TempDir()
+		ioutil.WriteFile(path.Join(tmpDir, "config.yaml"), configBytes, 0644)
+		defer os.RemoveAll(path.Join(tmpDir, "config.yaml"))
+		cfg := Config{}
+		err := cfg.LoadConfig(path.Join(tmpDir, "config.yaml"))
+		assertions.NoError(err)
+		assertions.Equal(24*time.Hour, cfg.Credentials[0].GracePeriod())
+		assertions.Equal(time.Hour, cfg.Credentials[1].GracePeriod())
+		assertions.Equal(720*time.Hour, cfg.Credentials[0].MaxKeyAge())
+		assertions.Equal(168*time.Hour, cfg.Credentials[1].MaxKeyAge())
+		assertions.Equal("rotator-state.yaml", cfg.StateFile)
+		assertions.NotNil(cfg.State)
+	})
+	t.Run("destinations default to the credentials variable", func(t *testing.T) {
+		assertions := require.New(t)
+		configBytes := []byte(`
+credentials:
+- variable: TEST_VARIABLE
+  destinations:
+  - type: gitlab
+    project_id: "1234"
+  - type: github
+    repository: owner/repo
+    variable: OTHER_VARIABLE
+`)
+		tmpDir := os.TempDir()
+		ioutil.WriteFile(path.Join(tmpDir, "config.yaml"), configBytes, 0644)
+		defer os.RemoveAll(path.Join(tmpDir, "config.yaml"))
+		cfg := Config{}
+		err := cfg.LoadConfig(path.Join(tmpDir, "config.yaml"))
+		assertions.NoError(err)
+		targets := cfg.Credentials[0].Targets()
+		assertions.Len(targets, 2)
+		assertions.Equal("TEST_VARIABLE", targets[0].Variable)
+		assertions.Equal("OTHER_VARIABLE", targets[1].Variable)
+		assertions.Equal(
+			"gitlab 1234/TEST_VARIABLE, github owner/repo/OTHER_VARIABLE",
+			cfg.Credentials[0].String(),
+		)
+	})
+	t.Run("destinations default to the credentials google project", func(t *testing.T) {
+		assertions := require.New(t)
+		configBytes := []byte(`
+credentials:
+- variable: TEST_VARIABLE
+  google_project_id: project-1
+  destinations:
+  - type: google-secret-manager
+  - type: google-secret-manager
+    google_project_id: project-2
+`)
+		tmpDir := os.TempDir()
+		ioutil.WriteFile(path.Join(tmpDir, "config.yaml"), configBytes, 0644)
+		defer os.RemoveAll(path.Join(tmpDir, "config.yaml"))
+		cfg := Config{}
+		err := cfg.LoadConfig(path.Join(tmpDir, "config.yaml"))
+		assertions.NoError(err)
+		targets := cfg.Credentials[0].Targets()
+		assertions.Equal("project-1", targets[0].GoogleProjectID)
+		assertions.Equal("project-2", targets[1].GoogleProjectID)
+	})
+	t.Run("credentials sharing a source account are rejected", func(t *testing.T) {
+		assertions := require.New(t)
+		configBytes := []byte(`
+credentials:
+- type: gitlab
+  project_id: "1234"
+  variable: TEST_VARIABLE
+  google_project_id: project-1
+  service_account: deployer@project-1.iam.gserviceaccount.com
+- type: github
+  repository: owner/repo
+  variable: TEST_VARIABLE
+  google_project_id: project-1
+  service_account: deployer@project-1.iam.gserviceaccount.com
+- type: gitlab
+  source: google-hmac
+  project_id: "1234"
+  variable: HMAC_VARIABLE
+  google_project_id: project-1
+  service_account: deployer@project-1.iam.gserviceaccount.com
+`)
+		tmpDir := os.TempDir()
+		ioutil.WriteFile(path.Join(tmpDir, "config.yaml"), configBytes, 0644)
+		defer os.RemoveAll(path.Join(tmpDir, "config.yaml"))
+		cfg := Config{}
+		err := cfg.LoadConfig(path.Join(tmpDir, "config.yaml"))
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "gitlab 1234/TEST_VARIABLE and github owner/repo/TEST_VARIABLE")
+		assertions.Contains(err.Error(), "destinations")
+
+		// other sources of the same account have their own keys
+		cfg = Config{Credentials: []Credential{
+			{Source: "google", ServiceAccount: "deployer"},
+			{Source: "google-hmac", ServiceAccount: "deployer"},
+		}}
+		assertions.NoError(validate(&cfg))
+	})
+	t.Run("selected repositories need selected visibility", func(t *testing.T) {
+		assertions := require.New(t)
+		for _, visibility := range []string{"all", "private"} {
+			cfg := Config{Credentials: []Credential{{
+				Type:                       "github",
+				GithubOrg:                  "my-org",
+				GithubVisibility:           visibility,
+				GithubSelectedRepositories: []string{"repo-a"},
+				Variable:                   "TEST_VARIABLE",
+			}}}
+			err := validate(&cfg)
+			assertions.Error(err)
+			assertions.Contains(err.Error(), "github_visibility selected")
+		}
+		for _, visibility := range []string{"", "selected"} {
+			cfg := Config{Credentials: []Credential{{
+				Type:                       "github",
+				GithubOrg:                  "my-org",
+				GithubVisibility:           visibility,
+				GithubSelectedRepositories: []string{"repo-a"},
+				Variable:                   "TEST_VARIABLE",
+			}}}
+			assertions.NoError(validate(&cfg))
+		}
+	})
 	t.Run("loading non existant file", func(t *testing.T) {
 		assertions := require.New(t)
 		cfg := Config{}
@@ -91,3 +305,310 @@ func TestConfigLoad(t *testing.T) {
 		assertions.Equal(cfg.Credentials, []Credential(nil))
 	})
 }
+
+func TestGitlabConnections(t *testing.T) {
+	t.Run("credentials use the client of their connection", func(t *testing.T) {
+		assertions := require.New(t)
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v4/user" {
+					return
+				}
+				assertions.Equal("file-token", r.Header.Get("PRIVATE-TOKEN"))
+				fmt.Fprint(w, `{"username": "root"}`)
+			},
+		))
+		defer server.Close()
+		tmpDir := os.TempDir()
+		tokenFile := path.Join(tmpDir, "gitlab-token")
+		ioutil.WriteFile(tokenFile, []byte("file-token\n"), 0600)
+		defer os.RemoveAll(tokenFile)
+		testConfig := Config{
+			GitlabConnections: map[string]GitlabConnection{
+				"self-managed": GitlabConnection{
+					BaseURL:   server.URL,
+					TokenFile: tokenFile,
+					Timeout:   5 * time.Second,
+				},
+			},
+			Credentials: []Credential{
+				Credential{
+					Type:             "gitlab",
+					GitlabConnection: "self-managed",
+					ProjectID:        "1234",
+					Variable:         "TEST_VARIABLE",
+				},
+				Credential{
+					Type:      "gitlab",
+					ProjectID: "1234",
+					Variable:  "TEST_VARIABLE",
+				},
+			},
+		}
+		configBytes, err := yaml.Marshal(testConfig)
+		assertions.NoError(err)
+		ioutil.WriteFile(path.Join(tmpDir, "config.yaml"), configBytes, 0644)
+		defer os.RemoveAll(path.Join(tmpDir, "config.yaml"))
+
+		cfg := Config{}
+		err = cfg.LoadConfig(path.Join(tmpDir, "config.yaml"))
+		assertions.NoError(err)
+
+		client, err := cfg.GitlabClientFor(&cfg.Credentials[0])
+		assertions.NoError(err)
+		assertions.Equal(server.URL+"/api/v4/", client.BaseURL().String())
+		_, _, err = client.Users.CurrentUser()
+		assertions.NoError(err)
+
+		client, err = cfg.GitlabClientFor(&cfg.Credentials[1])
+		assertions.NoError(err)
+		assertions.Equal(cfg.GitlabClient, client)
+	})
+	t.Run("unknown connection returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		testConfig := Config{
+			Credentials: []Credential{
+				Credential{
+					Type:             "gitlab",
+					GitlabConnection: "missing",
+					ProjectID:        "1234",
+					Variable:         "TEST_VARIABLE",
+				},
+			},
+		}
+		configBytes, err := yaml.Marshal(testConfig)
+		assertions.NoError(err)
+		tmpDir := os.TempDir()
+		ioutil.WriteFile(path.Join(tmpDir, "config.yaml"), configBytes, 0644)
+		defer os.RemoveAll(path.Join(tmpDir, "config.yaml"))
+
+		cfg := Config{}
+		err = cfg.LoadConfig(path.Join(tmpDir, "config.yaml"))
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "unknown gitlab connection missing")
+	})
+	t.Run("invalid CA file returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		tmpDir := os.TempDir()
+		caFile := path.Join(tmpDir, "gitlab-ca.pem")
+		ioutil.WriteFile(caFile, []byte("not a certificate"), 0600)
+		defer os.RemoveAll(caFile)
+		conn := GitlabConnection{
+			BaseURL: "https://gitlab.example.com",
+			CAFile:  caFile,
+		}
+		_, err := conn.httpClient()
+		assertions.Error(err)
+	})
+}
+
+func TestAzureGraphClient(t *testing.T) {
+	t.Run("client authenticates with the overridden token endpoint", func(t *testing.T) {
+		assertions := require.New(t)
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/token" {
+					assertions.Equal("client_credentials", r.FormValue("grant_type"))
+					clientID, _, _ := r.BasicAuth()
+					assertions.Equal("client-id", clientID)
+					w.Header().Set("Content-Type", "application/json")
+					fmt.Fprint(w, `{"access_token": "graph-token", "token_type": "Bearer"}`)
+					return
+				}
+				assertions.Equal("Bearer graph-token", r.Header.Get("Authorization"))
+			},
+		))
+		defer server.Close()
+		os.Setenv("AZURE_CLIENT_ID", "client-id")
+		os.Setenv("AZURE_CLIENT_SECRET", "client-secret")
+		defer os.Unsetenv("AZURE_CLIENT_ID")
+		defer os.Unsetenv("AZURE_CLIENT_SECRET")
+		cfg := Config{
+			Ctx:           context.Background(),
+			AzureGraphURL: server.URL,
+			AzureTokenURL: server.URL + "/token",
+		}
+		getAzureGraphClient(&cfg)
+		resp, err := cfg.AzureGraphClient.Get(server.URL + "/v1.0/applications")
+		assertions.NoError(err)
+		assertions.Equal(http.StatusOK, resp.StatusCode)
+	})
+	t.Run("tenant defaults to the env variable", func(t *testing.T) {
+		assertions := require.New(t)
+		os.Setenv("AZURE_TENANT_ID", "env-tenant")
+		defer os.Unsetenv("AZURE_TENANT_ID")
+		cfg := Config{Ctx: context.Background()}
+		getAzureGraphClient(&cfg)
+		assertions.Equal("env-tenant", cfg.AzureTenantID)
+		assertions.Equal("https://graph.microsoft.com", cfg.AzureGraphURL)
+
+		cfg = Config{Ctx: context.Background(), AzureTenantID: "config-tenant"}
+		getAzureGraphClient(&cfg)
+		assertions.Equal("config-tenant", cfg.AzureTenantID)
+	})
+}
+
+func TestAzureDevOpsClient(t *testing.T) {
+	t.Run("personal access token is sent with basic auth", func(t *testing.T) {
+		assertions := require.New(t)
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				_, token, ok := r.BasicAuth()
+				assertions.True(ok)
+				assertions.Equal("devops-pat", token)
+			},
+		))
+		defer server.Close()
+		os.Setenv("AZURE_DEVOPS_EXT_PAT", "devops-pat")
+		defer os.Unsetenv("AZURE_DEVOPS_EXT_PAT")
+		cfg := Config{}
+		getAzureDevOpsClient(&cfg)
+		assertions.Equal("https://dev.azure.com", cfg.AzureDevOpsURL)
+		resp, err := cfg.AzureDevOpsClient.Get(server.URL + "/organization/_apis/projects")
+		assertions.NoError(err)
+		assertions.Equal(http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestBitbucketClient(t *testing.T) {
+	t.Run("access token is preferred", func(t *testing.T) {
+		assertions := require.New(t)
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				assertions.Equal("Bearer bitbucket-token", r.Header.Get("Authorization"))
+			},
+		))
+		defer server.Close()
+		os.Setenv("BITBUCKET_TOKEN", "bitbucket-token")
+		os.Setenv("BITBUCKET_USERNAME", "deployer")
+		defer os.Unsetenv("BITBUCKET_TOKEN")
+		defer os.Unsetenv("BITBUCKET_USERNAME")
+		cfg := Config{BitbucketURL: server.URL}
+		getBitbucketClient(&cfg)
+		assertions.Equal(server.URL, cfg.BitbucketURL)
+		resp, err := cfg.BitbucketClient.Get(server.URL + "/repositories")
+		assertions.NoError(err)
+		assertions.Equal(http.StatusOK, resp.StatusCode)
+	})
+	t.Run("app password is sent with basic auth", func(t *testing.T) {
+		assertions := require.New(t)
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				username, password, ok := r.BasicAuth()
+				assertions.True(ok)
+				assertions.Equal("deployer", username)
+				assertions.Equal("app-password", password)
+			},
+		))
+		defer server.Close()
+		os.Setenv("BITBUCKET_USERNAME", "deployer")
+		os.Setenv("BITBUCKET_APP_PASSWORD", "app-password")
+		defer os.Unsetenv("BITBUCKET_USERNAME")
+		defer os.Unsetenv("BITBUCKET_APP_PASSWORD")
+		cfg := Config{}
+		getBitbucketClient(&cfg)
+		assertions.Equal("https://api.bitbucket.org/2.0", cfg.BitbucketURL)
+		resp, err := cfg.BitbucketClient.Get(server.URL + "/repositories")
+		assertions.NoError(err)
+		assertions.Equal(http.StatusOK, resp.StatusCode)
+	})
+	t.Run("no client without credentials", func(t *testing.T) {
+		assertions := require.New(t)
+		os.Setenv("BITBUCKET_USERNAME", "deployer")
+		defer os.Unsetenv("BITBUCKET_USERNAME")
+		cfg := Config{}
+		getBitbucketClient(&cfg)
+		assertions.Nil(cfg.BitbucketClient)
+	})
+}
+
+func TestVaultClient(t *testing.T) {
+	t.Run("token is read from the environment", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, _ := test.SetupVaultTestServer(t)
+		defer server.Close()
+		os.Setenv("VAULT_TOKEN", mock.Token)
+		defer os.Unsetenv("VAULT_TOKEN")
+		cfg := Config{Vault: VaultConnection{Address: server.URL}}
+		err := getVaultClient(&cfg)
+		assertions.NoError(err)
+		resp, err := cfg.VaultClient.Get(server.URL + "/v1/kv/missing")
+		assertions.NoError(err)
+		assertions.Equal(http.StatusNotFound, resp.StatusCode)
+		assertions.Equal(0, mock.Logins)
+	})
+	t.Run("approle logs in once", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, _ := test.SetupVaultTestServer(t)
+		defer server.Close()
+		mock.RoleID = "role-id"
+		mock.SecretID = "secret-id"
+		os.Setenv("VAULT_SECRET_ID", "secret-id")
+		defer os.Unsetenv("VAULT_SECRET_ID")
+		cfg := Config{Vault: VaultConnection{
+			Address:    server.URL,
+			AuthMethod: "approle",
+			RoleID:     "role-id",
+		}}
+		err := getVaultClient(&cfg)
+		assertions.NoError(err)
+		for i := 0; i < 2; i++ {
+			resp, err := cfg.VaultClient.Get(server.URL + "/v1/kv/missing")
+			assertions.NoError(err)
+			assertions.Equal(http.StatusNotFound, resp.StatusCode)
+		}
+		assertions.Equal(1, mock.Logins)
+	})
+	t.Run("kubernetes logs in with the service account token", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, _ := test.SetupVaultTestServer(t)
+		defer server.Close()
+		mock.Role = "rotator"
+		mock.JWT = "service-account-token"
+		jwtFile := path.Join(t.TempDir(), "token")
+		ioutil.WriteFile(jwtFile, []byte("service-account-token\n"), 0600)
+		cfg := Config{Vault: VaultConnection{
+			Address:    server.URL,
+			AuthMethod: "kubernetes",
+			Role:       "rotator",
+			JWTFile:    jwtFile,
+		}}
+		err := getVaultClient(&cfg)
+		assertions.NoError(err)
+		resp, err := cfg.VaultClient.Get(server.URL + "/v1/kv/missing")
+		assertions.NoError(err)
+		assertions.Equal(http.StatusNotFound, resp.StatusCode)
+		assertions.Equal(1, mock.Logins)
+	})
+	t.Run("failed login returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		_, server, _ := test.SetupVaultTestServer(t)
+		defer server.Close()
+		cfg := Config{Vault: VaultConnection{
+			Address:    server.URL,
+			AuthMethod: "approle",
+			RoleID:     "wrong-role",
+		}}
+		err := getVaultClient(&cfg)
+		assertions.NoError(err)
+		_, err = cfg.VaultClient.Get(server.URL + "/v1/kv/missing")
+		assertions.Error(err)
+	})
+	t.Run("unknown auth method returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		cfg := Config{Vault: VaultConnection{
+			Address:    "http://vault.example.com",
+			AuthMethod: "ldap",
+		}}
+		err := getVaultClient(&cfg)
+		assertions.Error(err)
+	})
+	t.Run("no client without an address", func(t *testing.T) {
+		assertions := require.New(t)
+		os.Unsetenv("VAULT_ADDR")
+		cfg := Config{}
+		err := getVaultClient(&cfg)
+		assertions.NoError(err)
+		assertions.Nil(cfg.VaultClient)
+	})
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/helpers"
+	"github.com/xanzy/go-gitlab"
+)
+
+//GitlabConnection a named Gitlab instance
+//that credentials can be written to
+type GitlabConnection struct {
+	// The URL of the Gitlab instance
+	// e.g https://gitlab.example.com
+	BaseURL string `yaml:"base_url"`
+
+	// Name of the environment variable holding
+	// the token, defaults to GITLAB_TOKEN
+	TokenEnv string `yaml:"token_env,omitempty"`
+
+	// File the token is read from, takes
+	// precedence over token_env
+	TokenFile string `yaml:"token_file,omitempty"`
+
+	// PEM bundle of extra CAs used to verify
+	// the instances certificate
+	CAFile string `yaml:"ca_file,omitempty"`
+
+	// How long a single request can take
+	// e.g 30s, no timeout when not set
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+
+	// How long connecting to the instance can take
+	// e.g 5s, defaults to 30s
+	DialTimeout time.Duration `yaml:"dial_timeout,omitempty"`
+}
+
+//token returns the token of the connection
+//from the token file or environment variable
+func (g *GitlabConnection) token() (string, error) {
+	if g.TokenFile != "" {
+		token, err := ioutil.ReadFile(g.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed reading token file: %v", err)
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+	tokenEnv := g.TokenEnv
+	if tokenEnv == "" {
+		tokenEnv = "GITLAB_TOKEN"
+	}
+	return helpers.GetEnv(tokenEnv, ""), nil
+}
+
+//httpClient returns a http client using the
+//CA bundle and timeouts of the connection
+func (g *GitlabConnection) httpClient() (*http.Client, error) {
+	dialTimeout := g.DialTimeout
+	if dialTimeout == 0 {
+		dialTimeout = 30 * time.Second
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	if g.CAFile != "" {
+		bundle, err := ioutil.ReadFile(g.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading CA file: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", g.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   g.Timeout,
+	}, nil
+}
+
+//GitlabClientFor returns the client of the gitlab connection
+//the credential references, or the default client if it doesn't
+func (c *Config) GitlabClientFor(cred *Credential) (*gitlab.Client, error) {
+	if cred.GitlabConnection == "" {
+		return c.GitlabClient, nil
+	}
+	client, ok := c.GitlabClients[cred.GitlabConnection]
+	if !ok {
+		return nil, fmt.Errorf("unknown gitlab connection %q", cred.GitlabConnection)
+	}
+	return client, nil
+}
+
+//getGitlabClients creates a client for every named gitlab
+//connection and attaches them to the configuration
+func getGitlabClients(cfg *Config) error {
+	cfg.GitlabClients = map[string]*gitlab.Client{}
+	for name, conn := range cfg.GitlabConnections {
+		if conn.BaseURL == "" {
+			return fmt.Errorf("gitlab connection %s has no base_url", name)
+		}
+		token, err := conn.token()
+		if err != nil {
+			return fmt.Errorf("gitlab connection %s: %v", name, err)
+		}
+		httpClient, err := conn.httpClient()
+		if err != nil {
+			return fmt.Errorf("gitlab connection %s: %v", name, err)
+		}
+		client, err := gitlab.NewClient(
+			token,
+			gitlab.WithBaseURL(conn.BaseURL),
+			gitlab.WithHTTPClient(httpClient),
+		)
+		if err != nil {
+			return fmt.Errorf("gitlab connection %s: %v", name, err)
+		}
+		cfg.GitlabClients[name] = client
+	}
+	// catch typos before anything gets rotated
+	for i := range cfg.Credentials {
+		for _, target := range cfg.Credentials[i].Targets() {
+			if target.GitlabConnection == "" {
+				continue
+			}
+			if _, ok := cfg.GitlabConnections[target.GitlabConnection]; !ok {
+				return fmt.Errorf(
+					"credential %s references unknown gitlab connection %s",
+					target.String(),
+					target.GitlabConnection,
+				)
+			}
+		}
+	}
+	return nil
+}
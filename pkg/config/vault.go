@@ -0,0 +1,213 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/helpers"
+)
+
+//VaultConnection the Vault server credentials are
+//written to and how to authenticate with it
+type VaultConnection struct {
+	// The address of the Vault server
+	// e.g https://vault.example.com:8200, defaults to VAULT_ADDR
+	Address string `yaml:"address,omitempty"`
+
+	// The Vault Enterprise namespace to use
+	Namespace string `yaml:"namespace,omitempty"`
+
+	// How to authenticate with Vault, one of
+	// token, approle or kubernetes, defaults to token
+	AuthMethod string `yaml:"auth_method,omitempty"`
+
+	// The path the auth method is mounted at,
+	// defaults to the name of the auth method
+	AuthMount string `yaml:"auth_mount,omitempty"`
+
+	// Name of the environment variable holding
+	// the token, defaults to VAULT_TOKEN
+	TokenEnv string `yaml:"token_env,omitempty"`
+
+	// File the token is read from, takes
+	// precedence over token_env
+	TokenFile string `yaml:"token_file,omitempty"`
+
+	// The role ID used with the approle auth method
+	RoleID string `yaml:"role_id,omitempty"`
+
+	// Name of the environment variable holding the
+	// approle secret ID, defaults to VAULT_SECRET_ID
+	SecretIDEnv string `yaml:"secret_id_env,omitempty"`
+
+	// File the approle secret ID is read
+	// from, takes precedence over secret_id_env
+	SecretIDFile string `yaml:"secret_id_file,omitempty"`
+
+	// The role used with the kubernetes auth method
+	Role string `yaml:"role,omitempty"`
+
+	// The service account token used with the kubernetes auth method
+	// defaults to /var/run/secrets/kubernetes.io/serviceaccount/token
+	JWTFile string `yaml:"jwt_file,omitempty"`
+
+	// How long a single request can take
+	// e.g 30s, defaults to 30s
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+//readSecret returns the contents of the file
+//or the environment variable when no file is set
+func readSecret(file string, env string, defaultEnv string) (string, error) {
+	if file != "" {
+		secret, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed reading %s: %v", file, err)
+		}
+		return strings.TrimSpace(string(secret)), nil
+	}
+	if env == "" {
+		env = defaultEnv
+	}
+	return helpers.GetEnv(env, ""), nil
+}
+
+//loginBody returns the body of the login
+//request of the auth method
+func (v *VaultConnection) loginBody() (map[string]string, error) {
+	switch v.AuthMethod {
+	case "approle":
+		secretID, err := readSecret(v.SecretIDFile, v.SecretIDEnv, "VAULT_SECRET_ID")
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"role_id": v.RoleID, "secret_id": secretID}, nil
+	case "kubernetes":
+		jwtFile := v.JWTFile
+		if jwtFile == "" {
+			jwtFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+		}
+		jwt, err := readSecret(jwtFile, "", "")
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"role": v.Role, "jwt": jwt}, nil
+	}
+	return nil, fmt.Errorf("unknown vault auth method %q", v.AuthMethod)
+}
+
+//login returns a Vault token using the auth method of the connection
+func (v *VaultConnection) login(client *http.Client) (string, error) {
+	if v.AuthMethod == "" || v.AuthMethod == "token" {
+		return readSecret(v.TokenFile, v.TokenEnv, "VAULT_TOKEN")
+	}
+	body, err := v.loginBody()
+	if err != nil {
+		return "", err
+	}
+	mount := v.AuthMount
+	if mount == "" {
+		mount = v.AuthMethod
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(
+		http.MethodPost,
+		fmt.Sprintf("%s/v1/auth/%s/login", strings.TrimSuffix(v.Address, "/"), mount),
+		bytes.NewReader(data),
+	)
+	if err != nil {
+		return "", err
+	}
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault %s login failed: %d", v.AuthMethod, resp.StatusCode)
+	}
+	login := struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&login)
+	if err != nil {
+		return "", err
+	}
+	return login.Auth.ClientToken, nil
+}
+
+//vaultTransport logs in to Vault on the first request
+//and adds the token and namespace to every request
+type vaultTransport struct {
+	connection *VaultConnection
+	base       http.RoundTripper
+
+	mu    sync.Mutex
+	token string
+}
+
+func (t *vaultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	if t.token == "" {
+		// a run is short enough that the token doesn't need renewing
+		token, err := t.connection.login(&http.Client{Transport: t.base})
+		if err != nil {
+			t.mu.Unlock()
+			return nil, err
+		}
+		t.token = token
+	}
+	token := t.token
+	t.mu.Unlock()
+
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Vault-Token", token)
+	if t.connection.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", t.connection.Namespace)
+	}
+	return t.base.RoundTrip(req)
+}
+
+//getVaultClient creates a http client that authenticates with
+//Vault and attaches it to the configuration, no client is
+//attached when there is no Vault address
+func getVaultClient(cfg *Config) error {
+	if cfg.Vault.Address == "" {
+		cfg.Vault.Address = helpers.GetEnv("VAULT_ADDR", "")
+	}
+	if cfg.Vault.Address == "" {
+		// only a problem if a credential uses vault
+		return nil
+	}
+	switch cfg.Vault.AuthMethod {
+	case "", "token", "approle", "kubernetes":
+	default:
+		return fmt.Errorf("unknown vault auth method %q", cfg.Vault.AuthMethod)
+	}
+	timeout := cfg.Vault.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	cfg.VaultClient = &http.Client{
+		Timeout: timeout,
+		Transport: &vaultTransport{
+			connection: &cfg.Vault,
+			base:       http.DefaultTransport,
+		},
+	}
+	return nil
+}
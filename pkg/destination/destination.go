@@ -0,0 +1,153 @@
+package destination
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+)
+
+//ErrReadNotSupported is returned by destinations
+//that don't allow values to be read back e.g secrets
+var ErrReadNotSupported = errors.New("reading values is not supported")
+
+//ErrNotFound is returned when reading a value that
+//doesn't exist yet but will be created when written
+var ErrNotFound = errors.New("value not found")
+
+//Destination is where the rotated credential is written
+//e.g a CI/CD variable on a Gitlab project
+type Destination interface {
+	// Write sets the value on the destination
+	Write(ctx context.Context, cred *config.Credential, value string) error
+
+	// Read returns the value currently on the destination
+	Read(ctx context.Context, cred *config.Credential) (string, error)
+
+	// Delete removes the value from the destination
+	Delete(ctx context.Context, cred *config.Credential) error
+}
+
+//Describer is implemented by destinations that can describe
+//what they writes to, it is used when planning a run
+type Describer interface {
+	Describe(cred *config.Credential) string
+}
+
+//Describe returns the description of the destination
+//falling back to its type name
+func Describe(dst Destination, cred *config.Credential) string {
+	if describer, ok := dst.(Describer); ok {
+		return describer.Describe(cred)
+	}
+	return cred.Type
+}
+
+//Checker is implemented by destinations that can make sure
+//a credential can be written before anything is rotated
+//e.g that the token has the permissions it needs
+type Checker interface {
+	Check(ctx context.Context, cred *config.Credential) error
+}
+
+//Check runs the destinations check if it has one
+func Check(ctx context.Context, dst Destination, cred *config.Credential) error {
+	if checker, ok := dst.(Checker); ok {
+		return checker.Check(ctx, cred)
+	}
+	return nil
+}
+
+//VersionWriter is implemented by destinations that keep
+//a version of every value written e.g Vault KV v2 secrets
+type VersionWriter interface {
+	WriteVersion(ctx context.Context, cred *config.Credential, value string) (string, error)
+}
+
+//Write sets the value on the destination and returns
+//the version written if the destination keeps versions
+func Write(ctx context.Context, dst Destination, cred *config.Credential, value string) (string, error) {
+	if writer, ok := dst.(VersionWriter); ok {
+		return writer.WriteVersion(ctx, cred, value)
+	}
+	return "", dst.Write(ctx, cred, value)
+}
+
+//Pruner is implemented by destinations that keep old values
+//next to the current one e.g secret versions, old values are
+//disabled once they were replaced longer than the grace period ago
+type Pruner interface {
+	Prune(ctx context.Context, cred *config.Credential, gracePeriod time.Duration) error
+}
+
+//Prune disables the old values of the destination if it keeps them
+func Prune(
+	ctx context.Context,
+	dst Destination,
+	cred *config.Credential,
+	gracePeriod time.Duration,
+) error {
+	if pruner, ok := dst.(Pruner); ok {
+		return pruner.Prune(ctx, cred, gracePeriod)
+	}
+	return nil
+}
+
+//Metadata about the key that is being written, destinations
+//can record it next to the value e.g as annotations
+type Metadata struct {
+	// The ID of the key on its source
+	KeyID string
+
+	// When the key was rotated
+	RotatedAt time.Time
+}
+
+type metadataKey struct{}
+
+//WithMetadata returns a context carrying the metadata of the key being written
+func WithMetadata(ctx context.Context, metadata Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, metadata)
+}
+
+//MetadataFrom returns the metadata of the key being written if it is set
+func MetadataFrom(ctx context.Context) (Metadata, bool) {
+	metadata, ok := ctx.Value(metadataKey{}).(Metadata)
+	return metadata, ok
+}
+
+//Factory creates a Destination using the clients on the configuration
+type Factory func(cfg *config.Config) (Destination, error)
+
+var registry = map[string]Factory{}
+
+//Register makes a destination available under a type name,
+//it is meant to be called from the init of the implementing package
+func Register(name string, factory Factory) {
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("destination %q registered twice", name))
+	}
+	registry[name] = factory
+}
+
+//New creates the destination registered under the type name
+func New(name string, cfg *config.Config) (Destination, error) {
+	factory, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown destination type %q", name)
+	}
+	return factory(cfg)
+}
+
+//Types returns the names of all registered destinations
+func Types() []string {
+	names := []string{}
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,147 @@
+package destination
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDestination struct{}
+
+func (d *fakeDestination) Write(ctx context.Context, cred *config.Credential, value string) error {
+	return nil
+}
+
+func (d *fakeDestination) Read(ctx context.Context, cred *config.Credential) (string, error) {
+	return "", ErrReadNotSupported
+}
+
+func (d *fakeDestination) Delete(ctx context.Context, cred *config.Credential) error {
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	Register("fake", func(cfg *config.Config) (Destination, error) {
+		return &fakeDestination{}, nil
+	})
+	t.Run("registered destination is created", func(t *testing.T) {
+		assertions := require.New(t)
+		dst, err := New("fake", &config.Config{})
+		assertions.NoError(err)
+		assertions.IsType(&fakeDestination{}, dst)
+		assertions.Contains(Types(), "fake")
+	})
+	t.Run("unknown destination returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		_, err := New("unknown", &config.Config{})
+		assertions.Error(err)
+	})
+	t.Run("registering twice panics", func(t *testing.T) {
+		assertions := require.New(t)
+		assertions.Panics(func() {
+			Register("fake", func(cfg *config.Config) (Destination, error) {
+				return &fakeDestination{}, nil
+			})
+		})
+	})
+}
+
+type checkedDestination struct {
+	fakeDestination
+	err error
+}
+
+func (d *checkedDestination) Check(ctx context.Context, cred *config.Credential) error {
+	return d.err
+}
+
+func TestCheck(t *testing.T) {
+	t.Run("destinations without checks pass", func(t *testing.T) {
+		assertions := require.New(t)
+		err := Check(context.Background(), &fakeDestination{}, &config.Credential{})
+		assertions.NoError(err)
+	})
+	t.Run("failed check returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		dst := &checkedDestination{err: errors.New("missing permissions")}
+		err := Check(context.Background(), dst, &config.Credential{})
+		assertions.EqualError(err, "missing permissions")
+	})
+}
+
+type versionedDestination struct {
+	fakeDestination
+}
+
+func (d *versionedDestination) WriteVersion(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+) (string, error) {
+	return "3", nil
+}
+
+func TestWrite(t *testing.T) {
+	t.Run("destinations without versions return no version", func(t *testing.T) {
+		assertions := require.New(t)
+		version, err := Write(context.Background(), &fakeDestination{}, &config.Credential{}, "value")
+		assertions.NoError(err)
+		assertions.Equal("", version)
+	})
+	t.Run("versioned destination returns the version", func(t *testing.T) {
+		assertions := require.New(t)
+		version, err := Write(context.Background(), &versionedDestination{}, &config.Credential{}, "value")
+		assertions.NoError(err)
+		assertions.Equal("3", version)
+	})
+}
+
+type prunedDestination struct {
+	fakeDestination
+	gracePeriod time.Duration
+}
+
+func (d *prunedDestination) Prune(
+	ctx context.Context,
+	cred *config.Credential,
+	gracePeriod time.Duration,
+) error {
+	d.gracePeriod = gracePeriod
+	return nil
+}
+
+func TestPrune(t *testing.T) {
+	t.Run("destinations without old values are skipped", func(t *testing.T) {
+		assertions := require.New(t)
+		err := Prune(context.Background(), &fakeDestination{}, &config.Credential{}, time.Hour)
+		assertions.NoError(err)
+	})
+	t.Run("pruner gets the grace period", func(t *testing.T) {
+		assertions := require.New(t)
+		dst := &prunedDestination{}
+		err := Prune(context.Background(), dst, &config.Credential{}, time.Hour)
+		assertions.NoError(err)
+		assertions.Equal(time.Hour, dst.gracePeriod)
+	})
+}
+
+func TestMetadata(t *testing.T) {
+	t.Run("metadata is carried by the context", func(t *testing.T) {
+		assertions := require.New(t)
+		rotatedAt := time.Now()
+		ctx := WithMetadata(context.Background(), Metadata{KeyID: "key-1", RotatedAt: rotatedAt})
+		metadata, ok := MetadataFrom(ctx)
+		assertions.True(ok)
+		assertions.Equal("key-1", metadata.KeyID)
+		assertions.Equal(rotatedAt, metadata.RotatedAt)
+	})
+	t.Run("missing metadata", func(t *testing.T) {
+		assertions := require.New(t)
+		_, ok := MetadataFrom(context.Background())
+		assertions.False(ok)
+	})
+}
@@ -0,0 +1,59 @@
+package file
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+)
+
+func init() {
+	destination.Register("file", NewFileDestination)
+}
+
+//FileDestination writes credentials to a file on disk
+type FileDestination struct{}
+
+//NewFileDestination creates a FileDestination
+func NewFileDestination(cfg *config.Config) (destination.Destination, error) {
+	return &FileDestination{}, nil
+}
+
+//Write replaces the contents of the file with the value
+func (d *FileDestination) Write(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+) error {
+	return WriteFile(cred, value)
+}
+
+//Read returns the contents of the file
+func (d *FileDestination) Read(
+	ctx context.Context,
+	cred *config.Credential,
+) (string, error) {
+	return ReadFile(cred)
+}
+
+//Delete removes the file
+func (d *FileDestination) Delete(
+	ctx context.Context,
+	cred *config.Credential,
+) error {
+	return RemoveFile(cred)
+}
+
+//Check makes sure the file can be written
+func (d *FileDestination) Check(
+	ctx context.Context,
+	cred *config.Credential,
+) error {
+	return CheckFile(cred)
+}
+
+//Describe returns the path of the file that is written to
+func (d *FileDestination) Describe(cred *config.Credential) string {
+	return fmt.Sprintf("file %s", cred.Variable)
+}
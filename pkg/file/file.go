@@ -0,0 +1,106 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+)
+
+//DefaultMode is the permissions of files written
+//when the credential doesn't set file_mode
+const DefaultMode os.FileMode = 0600
+
+//Mode returns the permissions of the credentials file
+func Mode(cred *config.Credential) (os.FileMode, error) {
+	if cred.FileMode == "" {
+		return DefaultMode, nil
+	}
+	mode, err := strconv.ParseUint(cred.FileMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid file mode %q, expected octal permissions e.g 0600", cred.FileMode)
+	}
+	return os.FileMode(mode), nil
+}
+
+//WriteAtomic writes the data to a temporary file next to
+//the path and renames it over the path, readers see
+//either the old or the new contents but never a partial file
+func WriteAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	// clean up the temporary file if anything fails before the rename
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+//WriteFile writes the value to the credentials file
+func WriteFile(cred *config.Credential, value string) error {
+	mode, err := Mode(cred)
+	if err != nil {
+		return err
+	}
+	return WriteAtomic(cred.Variable, []byte(value), mode)
+}
+
+//ReadFile returns the contents of the credentials file,
+//if the file doesn't exist destination.ErrNotFound is returned
+func ReadFile(cred *config.Credential) (string, error) {
+	data, err := ioutil.ReadFile(cred.Variable)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("file %s: %w", cred.Variable, destination.ErrNotFound)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+//RemoveFile removes the credentials file,
+//a file that doesn't exist is already removed
+func RemoveFile(cred *config.Credential) error {
+	err := os.Remove(cred.Variable)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+//CheckFile makes sure the file mode is valid
+//and the directory of the file exists
+func CheckFile(cred *config.Credential) error {
+	if _, err := Mode(cred); err != nil {
+		return err
+	}
+	dir := filepath.Dir(cred.Variable)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package file
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFile(t *testing.T) {
+	t.Run("file gets written with the default mode", func(t *testing.T) {
+		assertions := require.New(t)
+		path := filepath.Join(t.TempDir(), "credentials.json")
+		cred := config.Credential{Variable: path}
+
+		err := WriteFile(&cred, "ABCDBC")
+		assertions.NoError(err)
+
+		data, err := ioutil.ReadFile(path)
+		assertions.NoError(err)
+		assertions.Equal("ABCDBC", string(data))
+		info, err := os.Stat(path)
+		assertions.NoError(err)
+		assertions.Equal(os.FileMode(0600), info.Mode().Perm())
+	})
+	t.Run("existing file gets replaced with the mode", func(t *testing.T) {
+		assertions := require.New(t)
+		dir := t.TempDir()
+		path := filepath.Join(dir, "credentials.json")
+		assertions.NoError(ioutil.WriteFile(path, []byte("old value"), 0600))
+		cred := config.Credential{Variable: path, FileMode: "0640"}
+
+		err := WriteFile(&cred, "ABCDBC")
+		assertions.NoError(err)
+
+		data, err := ioutil.ReadFile(path)
+		assertions.NoError(err)
+		assertions.Equal("ABCDBC", string(data))
+		info, err := os.Stat(path)
+		assertions.NoError(err)
+		assertions.Equal(os.FileMode(0640), info.Mode().Perm())
+		// the temporary file is renamed over the file
+		entries, err := ioutil.ReadDir(dir)
+		assertions.NoError(err)
+		assertions.Len(entries, 1)
+	})
+	t.Run("invalid mode returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		path := filepath.Join(t.TempDir(), "credentials.json")
+		cred := config.Credential{Variable: path, FileMode: "rw-r--r--"}
+
+		err := WriteFile(&cred, "ABCDBC")
+		assertions.Error(err)
+		_, err = os.Stat(path)
+		assertions.True(errors.Is(err, os.ErrNotExist))
+	})
+	t.Run("missing directory returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		path := filepath.Join(t.TempDir(), "missing", "credentials.json")
+		cred := config.Credential{Variable: path}
+
+		err := WriteFile(&cred, "ABCDBC")
+		assertions.Error(err)
+	})
+}
+
+func TestReadFile(t *testing.T) {
+	t.Run("contents of the file are returned", func(t *testing.T) {
+		assertions := require.New(t)
+		path := filepath.Join(t.TempDir(), "credentials.json")
+		assertions.NoError(ioutil.WriteFile(path, []byte("ABCDBC"), 0600))
+
+		value, err := ReadFile(&config.Credential{Variable: path})
+		assertions.NoError(err)
+		assertions.Equal("ABCDBC", value)
+	})
+	t.Run("missing file is not found", func(t *testing.T) {
+		assertions := require.New(t)
+		path := filepath.Join(t.TempDir(), "credentials.json")
+
+		_, err := ReadFile(&config.Credential{Variable: path})
+		assertions.True(errors.Is(err, destination.ErrNotFound))
+	})
+}
+
+func TestRemoveFile(t *testing.T) {
+	t.Run("file gets removed", func(t *testing.T) {
+		assertions := require.New(t)
+		path := filepath.Join(t.TempDir(), "credentials.json")
+		assertions.NoError(ioutil.WriteFile(path, []byte("ABCDBC"), 0600))
+
+		err := RemoveFile(&config.Credential{Variable: path})
+		assertions.NoError(err)
+		_, err = os.Stat(path)
+		assertions.True(errors.Is(err, os.ErrNotExist))
+	})
+	t.Run("missing file is ignored", func(t *testing.T) {
+		assertions := require.New(t)
+		path := filepath.Join(t.TempDir(), "credentials.json")
+
+		err := RemoveFile(&config.Credential{Variable: path})
+		assertions.NoError(err)
+	})
+}
+
+func TestCheckFile(t *testing.T) {
+	t.Run("existing directory passes", func(t *testing.T) {
+		assertions := require.New(t)
+		path := filepath.Join(t.TempDir(), "credentials.json")
+
+		err := CheckFile(&config.Credential{Variable: path, FileMode: "0644"})
+		assertions.NoError(err)
+	})
+	t.Run("missing directory fails", func(t *testing.T) {
+		assertions := require.New(t)
+		path := filepath.Join(t.TempDir(), "missing", "credentials.json")
+
+		err := CheckFile(&config.Credential{Variable: path})
+		assertions.Error(err)
+	})
+	t.Run("invalid mode fails", func(t *testing.T) {
+		assertions := require.New(t)
+		path := filepath.Join(t.TempDir(), "credentials.json")
+
+		err := CheckFile(&config.Credential{Variable: path, FileMode: "999"})
+		assertions.Error(err)
+	})
+}
@@ -0,0 +1,69 @@
+package github
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/google/go-github/v35/github"
+)
+
+func init() {
+	destination.Register("github", NewSecretDestination)
+}
+
+//SecretDestination writes credentials to
+//a Github repositories Actions secrets
+type SecretDestination struct {
+	client *github.Client
+}
+
+//NewSecretDestination creates a SecretDestination from the configuration
+func NewSecretDestination(cfg *config.Config) (destination.Destination, error) {
+	if cfg.GithubClient == nil {
+		return nil, fmt.Errorf("github client is not configured")
+	}
+	return &SecretDestination{client: cfg.GithubClient}, nil
+}
+
+//Write encrypts the value and sets it as the Actions secret
+func (d *SecretDestination) Write(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+) error {
+	return UpdateSecret(ctx, d.client, cred, value)
+}
+
+//Read is not supported as Github never returns secret values
+func (d *SecretDestination) Read(
+	ctx context.Context,
+	cred *config.Credential,
+) (string, error) {
+	return "", destination.ErrReadNotSupported
+}
+
+//Delete removes the Actions secret
+func (d *SecretDestination) Delete(
+	ctx context.Context,
+	cred *config.Credential,
+) error {
+	return DeleteSecret(ctx, d.client, cred)
+}
+
+//Describe returns the Actions secret that is written to
+func (d *SecretDestination) Describe(cred *config.Credential) string {
+	switch {
+	case cred.GithubOrg != "":
+		return fmt.Sprintf("secret %s in org %s", cred.Variable, cred.GithubOrg)
+	case cred.GithubEnvironment != "":
+		return fmt.Sprintf(
+			"secret %s in environment %s of repository %s",
+			cred.Variable,
+			cred.GithubEnvironment,
+			cred.Repository,
+		)
+	}
+	return fmt.Sprintf("secret %s in repository %s", cred.Variable, cred.Repository)
+}
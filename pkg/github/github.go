@@ -0,0 +1,197 @@
+package github
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/google/go-github/v35/github"
+	"golang.org/x/crypto/nacl/box"
+)
+
+//UpdateSecret encrypts the value and sets it as the
+//Actions secret that is in the cred struct, the secret is
+//set on the org or environment if the cred has one
+func UpdateSecret(
+	ctx context.Context,
+	client *github.Client,
+	cred *config.Credential,
+	value string,
+) error {
+	switch {
+	case cred.GithubOrg != "":
+		return updateOrgSecret(ctx, client, cred, value)
+	case cred.GithubEnvironment != "":
+		return updateEnvSecret(ctx, client, cred, value)
+	}
+	return updateRepoSecret(ctx, client, cred, value)
+}
+
+//DeleteSecret deletes the Actions secret
+//that is in the cred struct
+func DeleteSecret(
+	ctx context.Context,
+	client *github.Client,
+	cred *config.Credential,
+) error {
+	if cred.GithubOrg != "" {
+		_, err := client.Actions.DeleteOrgSecret(ctx, cred.GithubOrg, cred.Variable)
+		return err
+	}
+	owner, repo, err := splitRepository(cred.Repository)
+	if err != nil {
+		return err
+	}
+	if cred.GithubEnvironment != "" {
+		repoID, err := getRepositoryID(ctx, client, owner, repo)
+		if err != nil {
+			return err
+		}
+		_, err = client.Actions.DeleteEnvSecret(ctx, repoID, cred.GithubEnvironment, cred.Variable)
+		return err
+	}
+	_, err = client.Actions.DeleteRepoSecret(ctx, owner, repo, cred.Variable)
+	return err
+}
+
+//updateRepoSecret sets a repository level secret
+func updateRepoSecret(
+	ctx context.Context,
+	client *github.Client,
+	cred *config.Credential,
+	value string,
+) error {
+	owner, repo, err := splitRepository(cred.Repository)
+	if err != nil {
+		return err
+	}
+	publicKey, _, err := client.Actions.GetRepoPublicKey(ctx, owner, repo)
+	if err != nil {
+		return err
+	}
+	secret, err := encryptSecret(publicKey, cred.Variable, value)
+	if err != nil {
+		return err
+	}
+	_, err = client.Actions.CreateOrUpdateRepoSecret(ctx, owner, repo, secret)
+	return err
+}
+
+//updateEnvSecret sets a secret on one of the repositories environments
+func updateEnvSecret(
+	ctx context.Context,
+	client *github.Client,
+	cred *config.Credential,
+	value string,
+) error {
+	owner, repo, err := splitRepository(cred.Repository)
+	if err != nil {
+		return err
+	}
+	repoID, err := getRepositoryID(ctx, client, owner, repo)
+	if err != nil {
+		return err
+	}
+	publicKey, _, err := client.Actions.GetEnvPublicKey(ctx, repoID, cred.GithubEnvironment)
+	if err != nil {
+		return err
+	}
+	secret, err := encryptSecret(publicKey, cred.Variable, value)
+	if err != nil {
+		return err
+	}
+	_, err = client.Actions.CreateOrUpdateEnvSecret(ctx, repoID, cred.GithubEnvironment, secret)
+	return err
+}
+
+//updateOrgSecret sets an organization level secret
+//that is visible to the configured repositories
+func updateOrgSecret(
+	ctx context.Context,
+	client *github.Client,
+	cred *config.Credential,
+	value string,
+) error {
+	publicKey, _, err := client.Actions.GetOrgPublicKey(ctx, cred.GithubOrg)
+	if err != nil {
+		return err
+	}
+	secret, err := encryptSecret(publicKey, cred.Variable, value)
+	if err != nil {
+		return err
+	}
+	secret.Visibility = cred.GithubVisibility
+	if secret.Visibility == "" {
+		secret.Visibility = "private"
+		if len(cred.GithubSelectedRepositories) > 0 {
+			secret.Visibility = "selected"
+		}
+	}
+	if secret.Visibility == "selected" {
+		for _, repo := range cred.GithubSelectedRepositories {
+			repoID, err := getRepositoryID(ctx, client, cred.GithubOrg, repo)
+			if err != nil {
+				return err
+			}
+			secret.SelectedRepositoryIDs = append(
+				secret.SelectedRepositoryIDs,
+				int64(repoID),
+			)
+		}
+	}
+	_, err = client.Actions.CreateOrUpdateOrgSecret(ctx, cred.GithubOrg, secret)
+	return err
+}
+
+//getRepositoryID looks up the numeric ID of a repository
+func getRepositoryID(
+	ctx context.Context,
+	client *github.Client,
+	owner string,
+	repo string,
+) (int, error) {
+	repository, _, err := client.Repositories.Get(ctx, owner, repo)
+	if err != nil {
+		return 0, err
+	}
+	return int(repository.GetID()), nil
+}
+
+//encryptSecret encrypts the value using a libsodium
+//sealed box as required by the Github secrets API
+func encryptSecret(
+	publicKey *github.PublicKey,
+	name string,
+	value string,
+) (*github.EncryptedSecret, error) {
+	decoded, err := base64.StdEncoding.DecodeString(publicKey.GetKey())
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding public key: %v", err)
+	}
+	if len(decoded) != 32 {
+		return nil, fmt.Errorf("invalid public key length %d", len(decoded))
+	}
+	var recipient [32]byte
+	copy(recipient[:], decoded)
+	sealed, err := box.SealAnonymous(nil, []byte(value), &recipient, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &github.EncryptedSecret{
+		Name:           name,
+		KeyID:          publicKey.GetKeyID(),
+		EncryptedValue: base64.StdEncoding.EncodeToString(sealed),
+	}, nil
+}
+
+//splitRepository splits owner/repo into its parts
+func splitRepository(repository string) (string, string, error) {
+	parts := strings.Split(repository, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("repository %q should be in the form owner/repo", repository)
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,269 @@
+package github
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/Spazzy757/credentials-rotator/pkg/test"
+	"github.com/google/go-github/v35/github"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/nacl/box"
+)
+
+func TestUpdateSecret(t *testing.T) {
+	t.Run("secret gets encrypted and updated", func(t *testing.T) {
+		assertions := require.New(t)
+		publicKey, privateKey, err := box.GenerateKey(rand.Reader)
+		assertions.NoError(err)
+		mux, server, client := test.SetupGithubTestServer(t)
+		defer server.Close()
+		mux.HandleFunc("/repos/owner/repo/actions/secrets/public-key",
+			func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, `{"key_id": "1234", "key": "%s"}`,
+					base64.StdEncoding.EncodeToString(publicKey[:]),
+				)
+			},
+		)
+		var secret github.EncryptedSecret
+		mux.HandleFunc("/repos/owner/repo/actions/secrets/TEST_SECRET",
+			func(w http.ResponseWriter, r *http.Request) {
+				assertions.Equal(http.MethodPut, r.Method)
+				err := json.NewDecoder(r.Body).Decode(&secret)
+				assertions.NoError(err)
+				w.WriteHeader(http.StatusCreated)
+			},
+		)
+		creds := config.Credential{
+			Repository: "owner/repo",
+			Variable:   "TEST_SECRET",
+		}
+
+		err = UpdateSecret(context.Background(), client, &creds, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("1234", secret.KeyID)
+		sealed, err := base64.StdEncoding.DecodeString(secret.EncryptedValue)
+		assertions.NoError(err)
+		value, ok := box.OpenAnonymous(nil, sealed, publicKey, privateKey)
+		assertions.True(ok)
+		assertions.Equal("ABCDBC", string(value))
+	})
+	t.Run("updating secret fails", func(t *testing.T) {
+		assertions := require.New(t)
+		mux, server, client := test.SetupGithubTestServer(t)
+		defer server.Close()
+		mux.HandleFunc("/repos/owner/repo/actions/secrets/public-key",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			},
+		)
+		creds := config.Credential{
+			Repository: "owner/repo",
+			Variable:   "TEST_SECRET",
+		}
+
+		err := UpdateSecret(context.Background(), client, &creds, "ABCDBC")
+		assertions.Error(err)
+	})
+	t.Run("invalid repository fails", func(t *testing.T) {
+		assertions := require.New(t)
+		_, server, client := test.SetupGithubTestServer(t)
+		defer server.Close()
+		creds := config.Credential{
+			Repository: "repo",
+			Variable:   "TEST_SECRET",
+		}
+
+		err := UpdateSecret(context.Background(), client, &creds, "ABCDBC")
+		assertions.Error(err)
+	})
+}
+
+//handlePublicKey serves a public key on the path
+func handlePublicKey(mux *http.ServeMux, path string, publicKey *[32]byte) {
+	mux.HandleFunc(path,
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"key_id": "1234", "key": "%s"}`,
+				base64.StdEncoding.EncodeToString(publicKey[:]),
+			)
+		},
+	)
+}
+
+//handleRepository serves a repository with the ID
+func handleRepository(mux *http.ServeMux, path string, id int) {
+	mux.HandleFunc(path,
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"id": %d}`, id)
+		},
+	)
+}
+
+func TestUpdateEnvSecret(t *testing.T) {
+	t.Run("environment secret gets encrypted and updated", func(t *testing.T) {
+		assertions := require.New(t)
+		publicKey, privateKey, err := box.GenerateKey(rand.Reader)
+		assertions.NoError(err)
+		mux, server, client := test.SetupGithubTestServer(t)
+		defer server.Close()
+		handleRepository(mux, "/repos/owner/repo", 42)
+		handlePublicKey(mux, "/repositories/42/environments/production/secrets/public-key", publicKey)
+		var secret github.EncryptedSecret
+		mux.HandleFunc("/repositories/42/environments/production/secrets/TEST_SECRET",
+			func(w http.ResponseWriter, r *http.Request) {
+				assertions.Equal(http.MethodPut, r.Method)
+				err := json.NewDecoder(r.Body).Decode(&secret)
+				assertions.NoError(err)
+				w.WriteHeader(http.StatusCreated)
+			},
+		)
+		creds := config.Credential{
+			Repository:        "owner/repo",
+			GithubEnvironment: "production",
+			Variable:          "TEST_SECRET",
+		}
+
+		err = UpdateSecret(context.Background(), client, &creds, "ABCDBC")
+		assertions.NoError(err)
+		sealed, err := base64.StdEncoding.DecodeString(secret.EncryptedValue)
+		assertions.NoError(err)
+		value, ok := box.OpenAnonymous(nil, sealed, publicKey, privateKey)
+		assertions.True(ok)
+		assertions.Equal("ABCDBC", string(value))
+	})
+	t.Run("deletes the environment secret", func(t *testing.T) {
+		assertions := require.New(t)
+		mux, server, client := test.SetupGithubTestServer(t)
+		defer server.Close()
+		handleRepository(mux, "/repos/owner/repo", 42)
+		mux.HandleFunc("/repositories/42/environments/staging/secrets/TEST_SECRET",
+			func(w http.ResponseWriter, r *http.Request) {
+				assertions.Equal(http.MethodDelete, r.Method)
+				w.WriteHeader(http.StatusNoContent)
+			},
+		)
+		creds := config.Credential{
+			Repository:        "owner/repo",
+			GithubEnvironment: "staging",
+			Variable:          "TEST_SECRET",
+		}
+
+		err := DeleteSecret(context.Background(), client, &creds)
+		assertions.NoError(err)
+	})
+}
+
+func TestUpdateOrgSecret(t *testing.T) {
+	t.Run("org secret is visible to the selected repositories", func(t *testing.T) {
+		assertions := require.New(t)
+		publicKey, privateKey, err := box.GenerateKey(rand.Reader)
+		assertions.NoError(err)
+		mux, server, client := test.SetupGithubTestServer(t)
+		defer server.Close()
+		handleRepository(mux, "/repos/org/repo-a", 1)
+		handleRepository(mux, "/repos/org/repo-b", 2)
+		handlePublicKey(mux, "/orgs/org/actions/secrets/public-key", publicKey)
+		var secret github.EncryptedSecret
+		mux.HandleFunc("/orgs/org/actions/secrets/TEST_SECRET",
+			func(w http.ResponseWriter, r *http.Request) {
+				assertions.Equal(http.MethodPut, r.Method)
+				err := json.NewDecoder(r.Body).Decode(&secret)
+				assertions.NoError(err)
+				w.WriteHeader(http.StatusCreated)
+			},
+		)
+		creds := config.Credential{
+			GithubOrg:                  "org",
+			GithubSelectedRepositories: []string{"repo-a", "repo-b"},
+			Variable:                   "TEST_SECRET",
+		}
+
+		err = UpdateSecret(context.Background(), client, &creds, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("selected", secret.Visibility)
+		assertions.Equal(github.SelectedRepoIDs{1, 2}, secret.SelectedRepositoryIDs)
+		sealed, err := base64.StdEncoding.DecodeString(secret.EncryptedValue)
+		assertions.NoError(err)
+		value, ok := box.OpenAnonymous(nil, sealed, publicKey, privateKey)
+		assertions.True(ok)
+		assertions.Equal("ABCDBC", string(value))
+	})
+	t.Run("org secret defaults to private", func(t *testing.T) {
+		assertions := require.New(t)
+		publicKey, _, err := box.GenerateKey(rand.Reader)
+		assertions.NoError(err)
+		mux, server, client := test.SetupGithubTestServer(t)
+		defer server.Close()
+		handlePublicKey(mux, "/orgs/org/actions/secrets/public-key", publicKey)
+		var secret github.EncryptedSecret
+		mux.HandleFunc("/orgs/org/actions/secrets/TEST_SECRET",
+			func(w http.ResponseWriter, r *http.Request) {
+				err := json.NewDecoder(r.Body).Decode(&secret)
+				assertions.NoError(err)
+				w.WriteHeader(http.StatusCreated)
+			},
+		)
+		creds := config.Credential{
+			GithubOrg: "org",
+			Variable:  "TEST_SECRET",
+		}
+
+		err = UpdateSecret(context.Background(), client, &creds, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("private", secret.Visibility)
+		assertions.Empty(secret.SelectedRepositoryIDs)
+	})
+	t.Run("missing selected repository fails", func(t *testing.T) {
+		assertions := require.New(t)
+		publicKey, _, err := box.GenerateKey(rand.Reader)
+		assertions.NoError(err)
+		mux, server, client := test.SetupGithubTestServer(t)
+		defer server.Close()
+		handlePublicKey(mux, "/orgs/org/actions/secrets/public-key", publicKey)
+		creds := config.Credential{
+			GithubOrg:                  "org",
+			GithubSelectedRepositories: []string{"missing"},
+			Variable:                   "TEST_SECRET",
+		}
+
+		err = UpdateSecret(context.Background(), client, &creds, "ABCDBC")
+		assertions.Error(err)
+	})
+}
+
+func TestSecretDestination(t *testing.T) {
+	t.Run("deletes the secret", func(t *testing.T) {
+		assertions := require.New(t)
+		mux, server, client := test.SetupGithubTestServer(t)
+		defer server.Close()
+		mux.HandleFunc("/repos/owner/repo/actions/secrets/TEST_SECRET",
+			func(w http.ResponseWriter, r *http.Request) {
+				assertions.Equal(http.MethodDelete, r.Method)
+				w.WriteHeader(http.StatusNoContent)
+			},
+		)
+		dst, err := NewSecretDestination(&config.Config{GithubClient: client})
+		assertions.NoError(err)
+		creds := config.Credential{
+			Repository: "owner/repo",
+			Variable:   "TEST_SECRET",
+		}
+		err = dst.Delete(context.Background(), &creds)
+		assertions.NoError(err)
+	})
+	t.Run("reading is not supported", func(t *testing.T) {
+		assertions := require.New(t)
+		_, server, client := test.SetupGithubTestServer(t)
+		defer server.Close()
+		dst, err := NewSecretDestination(&config.Config{GithubClient: client})
+		assertions.NoError(err)
+		_, err = dst.Read(context.Background(), &config.Credential{})
+		assertions.Equal(destination.ErrReadNotSupported, err)
+	})
+}
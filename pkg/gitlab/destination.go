@@ -0,0 +1,233 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+)
+
+func init() {
+	destination.Register("gitlab", NewVariableDestination)
+	destination.Register("gitlab-group", NewGroupVariableDestination)
+	destination.Register("gitlab-instance", NewInstanceVariableDestination)
+}
+
+//describeConnection returns the gitlab connection
+//of the credential to append to descriptions
+func describeConnection(cred *config.Credential) string {
+	if cred.GitlabConnection == "" {
+		return ""
+	}
+	return fmt.Sprintf(" on %s", cred.GitlabConnection)
+}
+
+//VariableDestination writes credentials to
+//a Gitlab projects CI/CD variables
+type VariableDestination struct {
+	cfg *config.Config
+}
+
+//NewVariableDestination creates a VariableDestination from the configuration
+func NewVariableDestination(cfg *config.Config) (destination.Destination, error) {
+	if cfg.GitlabClient == nil {
+		return nil, fmt.Errorf("gitlab client is not configured")
+	}
+	return &VariableDestination{cfg: cfg}, nil
+}
+
+//Write updates the CI/CD variable with the value
+func (d *VariableDestination) Write(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+) error {
+	client, err := d.cfg.GitlabClientFor(cred)
+	if err != nil {
+		return err
+	}
+	return UpdateVariable(client, cred, value)
+}
+
+//Read returns the current value of the CI/CD variable
+func (d *VariableDestination) Read(
+	ctx context.Context,
+	cred *config.Credential,
+) (string, error) {
+	client, err := d.cfg.GitlabClientFor(cred)
+	if err != nil {
+		return "", err
+	}
+	return GetVariable(client, cred)
+}
+
+//Delete removes the CI/CD variable
+func (d *VariableDestination) Delete(
+	ctx context.Context,
+	cred *config.Credential,
+) error {
+	client, err := d.cfg.GitlabClientFor(cred)
+	if err != nil {
+		return err
+	}
+	return RemoveVariable(client, cred)
+}
+
+//Describe returns the CI/CD variable that is written to
+func (d *VariableDestination) Describe(cred *config.Credential) string {
+	if cred.EnvironmentScope != "" {
+		return fmt.Sprintf(
+			"variable %s (scope %s) in project %s%s",
+			cred.Variable,
+			cred.EnvironmentScope,
+			cred.ProjectID,
+			describeConnection(cred),
+		)
+	}
+	return fmt.Sprintf(
+		"variable %s in project %s%s",
+		cred.Variable,
+		cred.ProjectID,
+		describeConnection(cred),
+	)
+}
+
+//GroupVariableDestination writes credentials to a Gitlab
+//groups CI/CD variables, shared by every project in the group
+type GroupVariableDestination struct {
+	cfg *config.Config
+}
+
+//NewGroupVariableDestination creates a GroupVariableDestination from the configuration
+func NewGroupVariableDestination(cfg *config.Config) (destination.Destination, error) {
+	if cfg.GitlabClient == nil {
+		return nil, fmt.Errorf("gitlab client is not configured")
+	}
+	return &GroupVariableDestination{cfg: cfg}, nil
+}
+
+//Write updates the group CI/CD variable with the value
+func (d *GroupVariableDestination) Write(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+) error {
+	client, err := d.cfg.GitlabClientFor(cred)
+	if err != nil {
+		return err
+	}
+	return UpdateGroupVariable(client, cred, value)
+}
+
+//Read returns the current value of the group CI/CD variable
+func (d *GroupVariableDestination) Read(
+	ctx context.Context,
+	cred *config.Credential,
+) (string, error) {
+	client, err := d.cfg.GitlabClientFor(cred)
+	if err != nil {
+		return "", err
+	}
+	return GetGroupVariable(client, cred)
+}
+
+//Delete removes the group CI/CD variable
+func (d *GroupVariableDestination) Delete(
+	ctx context.Context,
+	cred *config.Credential,
+) error {
+	client, err := d.cfg.GitlabClientFor(cred)
+	if err != nil {
+		return err
+	}
+	return RemoveGroupVariable(client, cred)
+}
+
+//Describe returns the group CI/CD variable that is written to
+func (d *GroupVariableDestination) Describe(cred *config.Credential) string {
+	if cred.EnvironmentScope != "" {
+		return fmt.Sprintf(
+			"variable %s (scope %s) in group %s%s",
+			cred.Variable,
+			cred.EnvironmentScope,
+			cred.GroupID,
+			describeConnection(cred),
+		)
+	}
+	return fmt.Sprintf(
+		"variable %s in group %s%s",
+		cred.Variable,
+		cred.GroupID,
+		describeConnection(cred),
+	)
+}
+
+//InstanceVariableDestination writes credentials to the instance
+//CI/CD variables of a self-managed Gitlab, which are shared by every project
+type InstanceVariableDestination struct {
+	cfg *config.Config
+}
+
+//NewInstanceVariableDestination creates an InstanceVariableDestination from the configuration
+func NewInstanceVariableDestination(cfg *config.Config) (destination.Destination, error) {
+	if cfg.GitlabClient == nil {
+		return nil, fmt.Errorf("gitlab client is not configured")
+	}
+	return &InstanceVariableDestination{cfg: cfg}, nil
+}
+
+//Check makes sure the token of the credentials
+//gitlab connection belongs to an admin
+func (d *InstanceVariableDestination) Check(
+	ctx context.Context,
+	cred *config.Credential,
+) error {
+	client, err := d.cfg.GitlabClientFor(cred)
+	if err != nil {
+		return err
+	}
+	return checkAdmin(client)
+}
+
+//Write updates the instance CI/CD variable with the value
+func (d *InstanceVariableDestination) Write(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+) error {
+	client, err := d.cfg.GitlabClientFor(cred)
+	if err != nil {
+		return err
+	}
+	return UpdateInstanceVariable(client, cred, value)
+}
+
+//Read returns the current value of the instance CI/CD variable
+func (d *InstanceVariableDestination) Read(
+	ctx context.Context,
+	cred *config.Credential,
+) (string, error) {
+	client, err := d.cfg.GitlabClientFor(cred)
+	if err != nil {
+		return "", err
+	}
+	return GetInstanceVariable(client, cred)
+}
+
+//Delete removes the instance CI/CD variable
+func (d *InstanceVariableDestination) Delete(
+	ctx context.Context,
+	cred *config.Credential,
+) error {
+	client, err := d.cfg.GitlabClientFor(cred)
+	if err != nil {
+		return err
+	}
+	return RemoveInstanceVariable(client, cred)
+}
+
+//Describe returns the instance CI/CD variable that is written to
+func (d *InstanceVariableDestination) Describe(cred *config.Credential) string {
+	return fmt.Sprintf("instance variable %s%s", cred.Variable, describeConnection(cred))
+}
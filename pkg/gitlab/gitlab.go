@@ -1,27 +1,212 @@
 package gitlab
 
 import (
+	"fmt"
+	"net/http"
+
 	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	retryablehttp "github.com/hashicorp/go-retryablehttp"
+	log "github.com/sirupsen/logrus"
 	"github.com/xanzy/go-gitlab"
 )
 
+//variableAttributes are the settings of a
+//CI/CD variable that are managed by the rotator
+type variableAttributes struct {
+	VariableType gitlab.VariableTypeValue
+
+	// unset flags are left as they are
+	Protected *bool
+	Masked    *bool
+
+	EnvironmentScope string
+}
+
+//desiredAttributes returns the attributes
+//the variable should have for the cred
+func desiredAttributes(cred *config.Credential) variableAttributes {
+	variableType := gitlab.FileVariableType
+	if cred.VariableType != "" {
+		variableType = gitlab.VariableTypeValue(cred.VariableType)
+	}
+	return variableAttributes{
+		VariableType:     variableType,
+		Protected:        cred.Protected,
+		Masked:           cred.Masked,
+		EnvironmentScope: cred.EnvironmentScope,
+	}
+}
+
+//drift returns a description of each attribute of an
+//existing variable that differs from the desired attributes
+func (a variableAttributes) drift(
+	variableType gitlab.VariableTypeValue,
+	protected bool,
+	masked bool,
+) []string {
+	drifted := []string{}
+	if variableType != a.VariableType {
+		drifted = append(drifted, fmt.Sprintf(
+			"variable_type is %s instead of %s",
+			variableType,
+			a.VariableType,
+		))
+	}
+	if a.Protected != nil && protected != *a.Protected {
+		drifted = append(drifted, fmt.Sprintf(
+			"protected is %t instead of %t",
+			protected,
+			*a.Protected,
+		))
+	}
+	if a.Masked != nil && masked != *a.Masked {
+		drifted = append(drifted, fmt.Sprintf(
+			"masked is %t instead of %t",
+			masked,
+			*a.Masked,
+		))
+	}
+	return drifted
+}
+
+//withEnvironmentScope filters the request to the variable
+//with the environment scope, variables can share a key
+//as long as their environment scopes differ
+func withEnvironmentScope(scope string) gitlab.RequestOptionFunc {
+	return func(req *retryablehttp.Request) error {
+		if scope == "" {
+			return nil
+		}
+		query := req.URL.Query()
+		query.Set("filter[environment_scope]", scope)
+		req.URL.RawQuery = query.Encode()
+		return nil
+	}
+}
+
 //UpdateVariable takes a string and updates the
 //specified CI/CD variable that is in the
-//cred struct
+//cred struct, the variable is created if it is missing
+//and any attributes that drifted are corrected
 func UpdateVariable(
 	client *gitlab.Client,
 	cred *config.Credential,
 	value string,
 ) error {
+	attributes := desiredAttributes(cred)
+	existing, resp, err := client.ProjectVariables.GetVariable(
+		cred.ProjectID,
+		cred.Variable,
+		withEnvironmentScope(cred.EnvironmentScope),
+	)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return createVariable(client, cred, attributes, value)
+	}
+	if err != nil {
+		return err
+	}
+	drift := attributes.drift(existing.VariableType, existing.Protected, existing.Masked)
+	for _, drifted := range drift {
+		log.WithFields(log.Fields{
+			"project_id":        cred.ProjectID,
+			"variable":          cred.Variable,
+			"environment_scope": cred.EnvironmentScope,
+			"drift":             drifted,
+		}).Warn("correcting variable attribute")
+	}
+
 	opts := &gitlab.UpdateProjectVariableOptions{
 		Value:        gitlab.String(value),
-		VariableType: gitlab.VariableType("file"),
+		VariableType: gitlab.VariableType(attributes.VariableType),
+		Protected:    attributes.Protected,
+		Masked:       attributes.Masked,
 	}
 
-	_, _, err := client.ProjectVariables.UpdateVariable(
+	_, _, err = client.ProjectVariables.UpdateVariable(
 		cred.ProjectID,
 		cred.Variable,
 		opts,
+		withEnvironmentScope(cred.EnvironmentScope),
+	)
+	return err
+}
+
+//createVariable creates the CI/CD variable
+//that is in the cred struct
+func createVariable(
+	client *gitlab.Client,
+	cred *config.Credential,
+	attributes variableAttributes,
+	value string,
+) error {
+	opts := &gitlab.CreateProjectVariableOptions{
+		Key:          gitlab.String(cred.Variable),
+		Value:        gitlab.String(value),
+		VariableType: gitlab.VariableType(attributes.VariableType),
+		Protected:    attributes.Protected,
+		Masked:       attributes.Masked,
+	}
+	if attributes.EnvironmentScope != "" {
+		opts.EnvironmentScope = gitlab.String(attributes.EnvironmentScope)
+	}
+
+	_, _, err := client.ProjectVariables.CreateVariable(
+		cred.ProjectID,
+		opts,
+	)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"project_id":        cred.ProjectID,
+		"variable":          cred.Variable,
+		"environment_scope": cred.EnvironmentScope,
+	}).Info("created missing variable")
+	return nil
+}
+
+//GetVariable returns the value of the CI/CD
+//variable that is in the cred struct, if the project
+//exists but the variable doesn't destination.ErrNotFound is returned
+func GetVariable(
+	client *gitlab.Client,
+	cred *config.Credential,
+) (string, error) {
+	variable, resp, err := client.ProjectVariables.GetVariable(
+		cred.ProjectID,
+		cred.Variable,
+		withEnvironmentScope(cred.EnvironmentScope),
+	)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		// a missing project also returns a not found
+		_, _, err = client.Projects.GetProject(cred.ProjectID, nil)
+		if err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf(
+			"variable %s in project %s: %w",
+			cred.Variable,
+			cred.ProjectID,
+			destination.ErrNotFound,
+		)
+	}
+	if err != nil {
+		return "", err
+	}
+	return variable.Value, nil
+}
+
+//RemoveVariable deletes the CI/CD
+//variable that is in the cred struct
+func RemoveVariable(
+	client *gitlab.Client,
+	cred *config.Credential,
+) error {
+	_, err := client.ProjectVariables.RemoveVariable(
+		cred.ProjectID,
+		cred.Variable,
+		withEnvironmentScope(cred.EnvironmentScope),
 	)
 	return err
 }
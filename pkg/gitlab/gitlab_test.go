@@ -1,14 +1,19 @@
 package gitlab
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"testing"
 
 	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
 	"github.com/Spazzy757/credentials-rotator/pkg/test"
 	"github.com/stretchr/testify/require"
+	"github.com/xanzy/go-gitlab"
 )
 
 func TestUpdateVariable(t *testing.T) {
@@ -57,3 +62,244 @@ func TestUpdateVariable(t *testing.T) {
 		assertions.Error(err)
 	})
 }
+
+func TestCreateMissingVariable(t *testing.T) {
+	t.Run("missing variable gets created", func(t *testing.T) {
+		assertions := require.New(t)
+		mux, server, client := test.SetupGitlabTestServer(t)
+		defer server.Close()
+		mux.HandleFunc("/api/v4/projects/12345/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				assertions.Equal(http.MethodGet, r.Method)
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"message": "404 Variable Not Found"}`)
+			},
+		)
+		created := map[string]interface{}{}
+		mux.HandleFunc("/api/v4/projects/12345/variables",
+			func(w http.ResponseWriter, r *http.Request) {
+				assertions.Equal(http.MethodPost, r.Method)
+				err := json.NewDecoder(r.Body).Decode(&created)
+				assertions.NoError(err)
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, `{"key": "TEST_VARIABLE"}`)
+			},
+		)
+		creds := config.Credential{
+			ProjectID: "12345",
+			Variable:  "TEST_VARIABLE",
+		}
+
+		err := UpdateVariable(client, &creds, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("TEST_VARIABLE", created["key"])
+		assertions.Equal("ABCDBC", created["value"])
+		assertions.Equal("file", created["variable_type"])
+	})
+	t.Run("drifted attributes are corrected", func(t *testing.T) {
+		assertions := require.New(t)
+		mux, server, client := test.SetupGitlabTestServer(t)
+		defer server.Close()
+		updated := map[string]interface{}{}
+		mux.HandleFunc("/api/v4/projects/12345/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut {
+					err := json.NewDecoder(r.Body).Decode(&updated)
+					assertions.NoError(err)
+				}
+				fmt.Fprint(w, `{
+					"key": "TEST_VARIABLE",
+					"value": "old value",
+					"variable_type": "env_var"
+				}`)
+			},
+		)
+		creds := config.Credential{
+			ProjectID: "12345",
+			Variable:  "TEST_VARIABLE",
+		}
+
+		err := UpdateVariable(client, &creds, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("file", updated["variable_type"])
+	})
+}
+
+func TestVariableSettings(t *testing.T) {
+	t.Run("environment scope selects the variable", func(t *testing.T) {
+		assertions := require.New(t)
+		mux, server, client := test.SetupGitlabTestServer(t)
+		defer server.Close()
+		updated := map[string]interface{}{}
+		mux.HandleFunc("/api/v4/projects/12345/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				assertions.Equal(
+					"production/*",
+					r.URL.Query().Get("filter[environment_scope]"),
+				)
+				if r.Method == http.MethodPut {
+					err := json.NewDecoder(r.Body).Decode(&updated)
+					assertions.NoError(err)
+				}
+				fmt.Fprint(w, `{
+					"key": "TEST_VARIABLE",
+					"value": "old value",
+					"variable_type": "env_var",
+					"protected": false,
+					"masked": false,
+					"environment_scope": "production/*"
+				}`)
+			},
+		)
+		creds := config.Credential{
+			ProjectID:        "12345",
+			Variable:         "TEST_VARIABLE",
+			EnvironmentScope: "production/*",
+			VariableType:     "env_var",
+			Protected:        gitlab.Bool(true),
+		}
+
+		err := UpdateVariable(client, &creds, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("env_var", updated["variable_type"])
+		assertions.Equal(true, updated["protected"])
+		// masked isn't configured so it is left as it is
+		_, hasMasked := updated["masked"]
+		assertions.False(hasMasked)
+	})
+	t.Run("missing variable is created with the settings", func(t *testing.T) {
+		assertions := require.New(t)
+		mux, server, client := test.SetupGitlabTestServer(t)
+		defer server.Close()
+		mux.HandleFunc("/api/v4/projects/12345/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+		)
+		created := map[string]interface{}{}
+		mux.HandleFunc("/api/v4/projects/12345/variables",
+			func(w http.ResponseWriter, r *http.Request) {
+				err := json.NewDecoder(r.Body).Decode(&created)
+				assertions.NoError(err)
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, `{"key": "TEST_VARIABLE"}`)
+			},
+		)
+		creds := config.Credential{
+			ProjectID:        "12345",
+			Variable:         "TEST_VARIABLE",
+			EnvironmentScope: "staging/*",
+			Protected:        gitlab.Bool(true),
+			Masked:           gitlab.Bool(false),
+		}
+
+		err := UpdateVariable(client, &creds, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("staging/*", created["environment_scope"])
+		assertions.Equal(true, created["protected"])
+		assertions.Equal(false, created["masked"])
+		assertions.Equal("file", created["variable_type"])
+	})
+}
+
+func TestDrift(t *testing.T) {
+	t.Run("reports differing flags", func(t *testing.T) {
+		assertions := require.New(t)
+		attributes := desiredAttributes(&config.Credential{
+			Protected: gitlab.Bool(true),
+			Masked:    gitlab.Bool(true),
+		})
+		drifted := attributes.drift(gitlab.FileVariableType, false, false)
+		assertions.Equal([]string{
+			"protected is false instead of true",
+			"masked is false instead of true",
+		}, drifted)
+	})
+	t.Run("reports differing attributes", func(t *testing.T) {
+		assertions := require.New(t)
+		attributes := desiredAttributes(&config.Credential{})
+		drifted := attributes.drift(gitlab.EnvVariableType, false, false)
+		assertions.Equal([]string{"variable_type is env_var instead of file"}, drifted)
+	})
+	t.Run("matching attributes have no drift", func(t *testing.T) {
+		assertions := require.New(t)
+		attributes := desiredAttributes(&config.Credential{})
+		drifted := attributes.drift(gitlab.FileVariableType, false, false)
+		assertions.Empty(drifted)
+	})
+}
+
+func TestVariableDestination(t *testing.T) {
+	t.Run("reads the variable value", func(t *testing.T) {
+		assertions := require.New(t)
+		mux, server, client := test.SetupGitlabTestServer(t)
+		defer server.Close()
+		mux.HandleFunc("/api/v4/projects/12345/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				assertions.Equal(http.MethodGet, r.Method)
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprint(w, `{
+					"key": "TEST_VARIABLE",
+					"value": "current value",
+					"variable_type": "file"
+				}`)
+			},
+		)
+		dst, err := NewVariableDestination(&config.Config{GitlabClient: client})
+		assertions.NoError(err)
+		creds := config.Credential{
+			ProjectID: "12345",
+			Variable:  "TEST_VARIABLE",
+		}
+		value, err := dst.Read(context.Background(), &creds)
+		assertions.NoError(err)
+		assertions.Equal("current value", value)
+	})
+	t.Run("missing variable returns not found", func(t *testing.T) {
+		assertions := require.New(t)
+		mux, server, client := test.SetupGitlabTestServer(t)
+		defer server.Close()
+		mux.HandleFunc("/api/v4/projects/12345/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+		)
+		mux.HandleFunc("/api/v4/projects/12345",
+			func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"id": 12345}`)
+			},
+		)
+		dst, err := NewVariableDestination(&config.Config{GitlabClient: client})
+		assertions.NoError(err)
+		creds := config.Credential{
+			ProjectID: "12345",
+			Variable:  "TEST_VARIABLE",
+		}
+		_, err = dst.Read(context.Background(), &creds)
+		assertions.True(errors.Is(err, destination.ErrNotFound))
+	})
+	t.Run("deletes the variable", func(t *testing.T) {
+		assertions := require.New(t)
+		mux, server, client := test.SetupGitlabTestServer(t)
+		defer server.Close()
+		mux.HandleFunc("/api/v4/projects/12345/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				assertions.Equal(http.MethodDelete, r.Method)
+				w.WriteHeader(http.StatusNoContent)
+			},
+		)
+		dst, err := NewVariableDestination(&config.Config{GitlabClient: client})
+		assertions.NoError(err)
+		creds := config.Credential{
+			ProjectID: "12345",
+			Variable:  "TEST_VARIABLE",
+		}
+		err = dst.Delete(context.Background(), &creds)
+		assertions.NoError(err)
+	})
+	t.Run("missing client returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		_, err := NewVariableDestination(&config.Config{})
+		assertions.Error(err)
+	})
+}
@@ -0,0 +1,137 @@
+package gitlab
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	log "github.com/sirupsen/logrus"
+	"github.com/xanzy/go-gitlab"
+)
+
+//UpdateGroupVariable takes a string and updates the
+//specified group CI/CD variable that is in the
+//cred struct, the variable is created if it is missing
+//and any attributes that drifted are corrected
+func UpdateGroupVariable(
+	client *gitlab.Client,
+	cred *config.Credential,
+	value string,
+) error {
+	attributes := desiredAttributes(cred)
+	existing, resp, err := client.GroupVariables.GetVariable(
+		cred.GroupID,
+		cred.Variable,
+		withEnvironmentScope(cred.EnvironmentScope),
+	)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return createGroupVariable(client, cred, attributes, value)
+	}
+	if err != nil {
+		return err
+	}
+	drift := attributes.drift(existing.VariableType, existing.Protected, existing.Masked)
+	for _, drifted := range drift {
+		log.WithFields(log.Fields{
+			"group_id":          cred.GroupID,
+			"variable":          cred.Variable,
+			"environment_scope": cred.EnvironmentScope,
+			"drift":             drifted,
+		}).Warn("correcting variable attribute")
+	}
+
+	opts := &gitlab.UpdateGroupVariableOptions{
+		Value:        gitlab.String(value),
+		VariableType: gitlab.VariableType(attributes.VariableType),
+		Protected:    attributes.Protected,
+		Masked:       attributes.Masked,
+	}
+
+	_, _, err = client.GroupVariables.UpdateVariable(
+		cred.GroupID,
+		cred.Variable,
+		opts,
+		withEnvironmentScope(cred.EnvironmentScope),
+	)
+	return err
+}
+
+//createGroupVariable creates the group CI/CD
+//variable that is in the cred struct
+func createGroupVariable(
+	client *gitlab.Client,
+	cred *config.Credential,
+	attributes variableAttributes,
+	value string,
+) error {
+	opts := &gitlab.CreateGroupVariableOptions{
+		Key:          gitlab.String(cred.Variable),
+		Value:        gitlab.String(value),
+		VariableType: gitlab.VariableType(attributes.VariableType),
+		Protected:    attributes.Protected,
+		Masked:       attributes.Masked,
+	}
+	if attributes.EnvironmentScope != "" {
+		opts.EnvironmentScope = gitlab.String(attributes.EnvironmentScope)
+	}
+
+	_, _, err := client.GroupVariables.CreateVariable(
+		cred.GroupID,
+		opts,
+	)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"group_id":          cred.GroupID,
+		"variable":          cred.Variable,
+		"environment_scope": cred.EnvironmentScope,
+	}).Info("created missing variable")
+	return nil
+}
+
+//GetGroupVariable returns the value of the group CI/CD
+//variable that is in the cred struct, if the group
+//exists but the variable doesn't destination.ErrNotFound is returned
+func GetGroupVariable(
+	client *gitlab.Client,
+	cred *config.Credential,
+) (string, error) {
+	variable, resp, err := client.GroupVariables.GetVariable(
+		cred.GroupID,
+		cred.Variable,
+		withEnvironmentScope(cred.EnvironmentScope),
+	)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		// a missing group also returns a not found
+		_, _, err = client.Groups.GetGroup(cred.GroupID)
+		if err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf(
+			"variable %s in group %s: %w",
+			cred.Variable,
+			cred.GroupID,
+			destination.ErrNotFound,
+		)
+	}
+	if err != nil {
+		return "", err
+	}
+	return variable.Value, nil
+}
+
+//RemoveGroupVariable deletes the group CI/CD
+//variable that is in the cred struct
+func RemoveGroupVariable(
+	client *gitlab.Client,
+	cred *config.Credential,
+) error {
+	_, err := client.GroupVariables.RemoveVariable(
+		cred.GroupID,
+		cred.Variable,
+		withEnvironmentScope(cred.EnvironmentScope),
+	)
+	return err
+}
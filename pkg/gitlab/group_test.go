@@ -0,0 +1,146 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/Spazzy757/credentials-rotator/pkg/test"
+	"github.com/stretchr/testify/require"
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestUpdateGroupVariable(t *testing.T) {
+	t.Run("group variable gets updated by full path", func(t *testing.T) {
+		assertions := require.New(t)
+		mux, server, client := test.SetupGitlabTestServer(t)
+		defer server.Close()
+		updated := map[string]interface{}{}
+		mux.HandleFunc("/",
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut {
+					// full paths are url encoded so the group is a single path segment
+					assertions.Equal(
+						"/api/v4/groups/my-group%2Fsub-group/variables/TEST_VARIABLE",
+						r.URL.EscapedPath(),
+					)
+					err := json.NewDecoder(r.Body).Decode(&updated)
+					assertions.NoError(err)
+				}
+				fmt.Fprint(w, `{
+					"key": "TEST_VARIABLE",
+					"value": "old value",
+					"variable_type": "file",
+					"protected": false
+				}`)
+			},
+		)
+		creds := config.Credential{
+			GroupID:   "my-group/sub-group",
+			Variable:  "TEST_VARIABLE",
+			Protected: gitlab.Bool(true),
+		}
+
+		err := UpdateGroupVariable(client, &creds, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("ABCDBC", updated["value"])
+		assertions.Equal(true, updated["protected"])
+	})
+	t.Run("missing group variable gets created", func(t *testing.T) {
+		assertions := require.New(t)
+		mux, server, client := test.SetupGitlabTestServer(t)
+		defer server.Close()
+		mux.HandleFunc("/api/v4/groups/1234/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+		)
+		created := map[string]interface{}{}
+		mux.HandleFunc("/api/v4/groups/1234/variables",
+			func(w http.ResponseWriter, r *http.Request) {
+				assertions.Equal(http.MethodPost, r.Method)
+				err := json.NewDecoder(r.Body).Decode(&created)
+				assertions.NoError(err)
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, `{"key": "TEST_VARIABLE"}`)
+			},
+		)
+		creds := config.Credential{
+			GroupID:          "1234",
+			Variable:         "TEST_VARIABLE",
+			EnvironmentScope: "production/*",
+		}
+
+		err := UpdateGroupVariable(client, &creds, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("TEST_VARIABLE", created["key"])
+		assertions.Equal("production/*", created["environment_scope"])
+	})
+	t.Run("updating group variable fails", func(t *testing.T) {
+		assertions := require.New(t)
+		mux, server, client := test.SetupGitlabTestServer(t)
+		defer server.Close()
+		mux.HandleFunc("/api/v4/groups/1234/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			},
+		)
+		creds := config.Credential{
+			GroupID:  "1234",
+			Variable: "TEST_VARIABLE",
+		}
+
+		err := UpdateGroupVariable(client, &creds, "ABCDBC")
+		assertions.Error(err)
+	})
+}
+
+func TestGroupVariableDestination(t *testing.T) {
+	t.Run("missing group variable returns not found", func(t *testing.T) {
+		assertions := require.New(t)
+		mux, server, client := test.SetupGitlabTestServer(t)
+		defer server.Close()
+		mux.HandleFunc("/api/v4/groups/1234/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+		)
+		mux.HandleFunc("/api/v4/groups/1234",
+			func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"id": 1234}`)
+			},
+		)
+		dst, err := NewGroupVariableDestination(&config.Config{GitlabClient: client})
+		assertions.NoError(err)
+		creds := config.Credential{
+			GroupID:  "1234",
+			Variable: "TEST_VARIABLE",
+		}
+		_, err = dst.Read(context.Background(), &creds)
+		assertions.True(errors.Is(err, destination.ErrNotFound))
+	})
+	t.Run("deletes the group variable", func(t *testing.T) {
+		assertions := require.New(t)
+		mux, server, client := test.SetupGitlabTestServer(t)
+		defer server.Close()
+		mux.HandleFunc("/api/v4/groups/1234/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				assertions.Equal(http.MethodDelete, r.Method)
+				w.WriteHeader(http.StatusNoContent)
+			},
+		)
+		dst, err := NewGroupVariableDestination(&config.Config{GitlabClient: client})
+		assertions.NoError(err)
+		creds := config.Credential{
+			GroupID:  "1234",
+			Variable: "TEST_VARIABLE",
+		}
+		err = dst.Delete(context.Background(), &creds)
+		assertions.NoError(err)
+	})
+}
@@ -0,0 +1,120 @@
+package gitlab
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	log "github.com/sirupsen/logrus"
+	"github.com/xanzy/go-gitlab"
+)
+
+//checkAdmin makes sure the user of the token is an administrator
+//as instance variables can only be managed through the admin API
+func checkAdmin(client *gitlab.Client) error {
+	user, _, err := client.Users.CurrentUser()
+	if err != nil {
+		return fmt.Errorf("failed looking up the gitlab token's user: %v", err)
+	}
+	if !user.IsAdmin {
+		return fmt.Errorf(
+			"gitlab user %s is not an administrator, instance variables need an admin token",
+			user.Username,
+		)
+	}
+	return nil
+}
+
+//UpdateInstanceVariable takes a string and updates the
+//specified instance CI/CD variable that is in the
+//cred struct, the variable is created if it is missing
+//and any attributes that drifted are corrected
+func UpdateInstanceVariable(
+	client *gitlab.Client,
+	cred *config.Credential,
+	value string,
+) error {
+	attributes := desiredAttributes(cred)
+	existing, resp, err := client.InstanceVariables.GetVariable(cred.Variable)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return createInstanceVariable(client, cred, attributes, value)
+	}
+	if err != nil {
+		return err
+	}
+	drift := attributes.drift(existing.VariableType, existing.Protected, existing.Masked)
+	for _, drifted := range drift {
+		log.WithFields(log.Fields{
+			"variable": cred.Variable,
+			"drift":    drifted,
+		}).Warn("correcting variable attribute")
+	}
+
+	opts := &gitlab.UpdateInstanceVariableOptions{
+		Value:        gitlab.String(value),
+		VariableType: gitlab.VariableType(attributes.VariableType),
+		Protected:    attributes.Protected,
+		Masked:       attributes.Masked,
+	}
+
+	_, _, err = client.InstanceVariables.UpdateVariable(cred.Variable, opts)
+	return err
+}
+
+//createInstanceVariable creates the instance CI/CD
+//variable that is in the cred struct
+func createInstanceVariable(
+	client *gitlab.Client,
+	cred *config.Credential,
+	attributes variableAttributes,
+	value string,
+) error {
+	opts := &gitlab.CreateInstanceVariableOptions{
+		Key:          gitlab.String(cred.Variable),
+		Value:        gitlab.String(value),
+		VariableType: gitlab.VariableType(attributes.VariableType),
+		Protected:    attributes.Protected,
+		Masked:       attributes.Masked,
+	}
+
+	_, _, err := client.InstanceVariables.CreateVariable(opts)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"variable": cred.Variable,
+	}).Info("created missing variable")
+	return nil
+}
+
+//GetInstanceVariable returns the value of the instance CI/CD
+//variable that is in the cred struct, if the variable
+//doesn't exist destination.ErrNotFound is returned
+func GetInstanceVariable(
+	client *gitlab.Client,
+	cred *config.Credential,
+) (string, error) {
+	variable, resp, err := client.InstanceVariables.GetVariable(cred.Variable)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf(
+			"instance variable %s: %w",
+			cred.Variable,
+			destination.ErrNotFound,
+		)
+	}
+	if err != nil {
+		return "", err
+	}
+	return variable.Value, nil
+}
+
+//RemoveInstanceVariable deletes the instance CI/CD
+//variable that is in the cred struct
+func RemoveInstanceVariable(
+	client *gitlab.Client,
+	cred *config.Credential,
+) error {
+	_, err := client.InstanceVariables.RemoveVariable(cred.Variable)
+	return err
+}
@@ -0,0 +1,112 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/Spazzy757/credentials-rotator/pkg/test"
+	"github.com/stretchr/testify/require"
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestUpdateInstanceVariable(t *testing.T) {
+	t.Run("instance variable gets updated", func(t *testing.T) {
+		assertions := require.New(t)
+		mux, server, client := test.SetupGitlabTestServer(t)
+		defer server.Close()
+		updated := map[string]interface{}{}
+		mux.HandleFunc("/api/v4/admin/ci/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPut {
+					err := json.NewDecoder(r.Body).Decode(&updated)
+					assertions.NoError(err)
+				}
+				fmt.Fprint(w, `{
+					"key": "TEST_VARIABLE",
+					"value": "old value",
+					"variable_type": "env_var",
+					"masked": false
+				}`)
+			},
+		)
+		creds := config.Credential{
+			Variable: "TEST_VARIABLE",
+			Masked:   gitlab.Bool(true),
+		}
+
+		err := UpdateInstanceVariable(client, &creds, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("ABCDBC", updated["value"])
+		assertions.Equal("file", updated["variable_type"])
+		assertions.Equal(true, updated["masked"])
+	})
+	t.Run("missing instance variable gets created", func(t *testing.T) {
+		assertions := require.New(t)
+		mux, server, client := test.SetupGitlabTestServer(t)
+		defer server.Close()
+		mux.HandleFunc("/api/v4/admin/ci/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+		)
+		created := map[string]interface{}{}
+		mux.HandleFunc("/api/v4/admin/ci/variables",
+			func(w http.ResponseWriter, r *http.Request) {
+				assertions.Equal(http.MethodPost, r.Method)
+				err := json.NewDecoder(r.Body).Decode(&created)
+				assertions.NoError(err)
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, `{"key": "TEST_VARIABLE"}`)
+			},
+		)
+		creds := config.Credential{
+			Variable: "TEST_VARIABLE",
+		}
+
+		err := UpdateInstanceVariable(client, &creds, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("TEST_VARIABLE", created["key"])
+		assertions.Equal("ABCDBC", created["value"])
+	})
+}
+
+func TestInstanceVariableDestination(t *testing.T) {
+	t.Run("non admin token fails", func(t *testing.T) {
+		assertions := require.New(t)
+		mux, server, client := test.SetupGitlabTestServer(t)
+		defer server.Close()
+		mux.HandleFunc("/api/v4/user",
+			func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"username": "developer", "is_admin": false}`)
+			},
+		)
+		dst, err := NewInstanceVariableDestination(&config.Config{GitlabClient: client})
+		assertions.NoError(err)
+		err = destination.Check(context.Background(), dst, &config.Credential{})
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "not an administrator")
+	})
+	t.Run("missing instance variable returns not found", func(t *testing.T) {
+		assertions := require.New(t)
+		mux, server, client := test.SetupGitlabTestServer(t)
+		defer server.Close()
+		mux.HandleFunc("/api/v4/admin/ci/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+		)
+		dst, err := NewInstanceVariableDestination(&config.Config{GitlabClient: client})
+		assertions.NoError(err)
+		creds := config.Credential{
+			Variable: "TEST_VARIABLE",
+		}
+		_, err = dst.Read(context.Background(), &creds)
+		assertions.True(errors.Is(err, destination.ErrNotFound))
+	})
+}
@@ -0,0 +1,91 @@
+package google
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+)
+
+func init() {
+	destination.Register("google-secret-manager", NewSecretManagerDestination)
+}
+
+//SecretManagerDestination writes credentials as
+//versions of a Google Secret Manager secret
+type SecretManagerDestination struct {
+	client *secretmanager.Client
+}
+
+//NewSecretManagerDestination creates a SecretManagerDestination from the configuration
+func NewSecretManagerDestination(cfg *config.Config) (destination.Destination, error) {
+	if cfg.GoogleSecretManagerClient == nil {
+		return nil, fmt.Errorf("google secret manager client is not configured")
+	}
+	return &SecretManagerDestination{client: cfg.GoogleSecretManagerClient}, nil
+}
+
+//Write adds the value as a new version of the secret
+func (d *SecretManagerDestination) Write(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+) error {
+	_, err := d.WriteVersion(ctx, cred, value)
+	return err
+}
+
+//WriteVersion adds the value as a new version
+//of the secret and returns the version number
+func (d *SecretManagerDestination) WriteVersion(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+) (string, error) {
+	return AddSecretVersion(ctx, d.client, cred, value)
+}
+
+//Read returns the value of the latest version of the secret
+func (d *SecretManagerDestination) Read(
+	ctx context.Context,
+	cred *config.Credential,
+) (string, error) {
+	return GetSecretValue(ctx, d.client, cred)
+}
+
+//Delete deletes the secret
+func (d *SecretManagerDestination) Delete(
+	ctx context.Context,
+	cred *config.Credential,
+) error {
+	return DeleteSecret(ctx, d.client, cred)
+}
+
+//Prune disables the versions of the secret that
+//were replaced longer than the grace period ago
+func (d *SecretManagerDestination) Prune(
+	ctx context.Context,
+	cred *config.Credential,
+	gracePeriod time.Duration,
+) error {
+	return DisableOldSecretVersions(ctx, d.client, cred, gracePeriod)
+}
+
+//Check makes sure the project of the secret is set
+func (d *SecretManagerDestination) Check(
+	ctx context.Context,
+	cred *config.Credential,
+) error {
+	if cred.GoogleSecretProject == "" && cred.GoogleProjectID == "" {
+		return fmt.Errorf("google_secret_project or google_project_id is required")
+	}
+	return nil
+}
+
+//Describe returns the secret that is written to
+func (d *SecretManagerDestination) Describe(cred *config.Credential) string {
+	return fmt.Sprintf("secret manager secret %s", secretName(cred))
+}
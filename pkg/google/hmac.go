@@ -0,0 +1,82 @@
+package google
+
+import (
+	"context"
+
+	storage "google.golang.org/api/storage/v1"
+)
+
+// States of an HMAC key
+const (
+	HMACKeyActive   = "ACTIVE"
+	HMACKeyInactive = "INACTIVE"
+)
+
+//CreateHMACKey creates a new HMAC key for a service account
+func CreateHMACKey(
+	ctx context.Context,
+	project string,
+	serviceAccount string,
+	service *storage.Service,
+) (*storage.HmacKey, error) {
+	return service.Projects.HmacKeys.Create(project, serviceAccount).Context(ctx).Do()
+}
+
+//ListHMACKeys returns the HMAC keys of a service
+//account that haven't been deleted
+func ListHMACKeys(
+	ctx context.Context,
+	project string,
+	serviceAccount string,
+	service *storage.Service,
+) ([]*storage.HmacKeyMetadata, error) {
+	keys := []*storage.HmacKeyMetadata{}
+	err := service.Projects.HmacKeys.List(project).
+		ServiceAccountEmail(serviceAccount).
+		ShowDeletedKeys(false).
+		Pages(ctx, func(page *storage.HmacKeysMetadata) error {
+			keys = append(keys, page.Items...)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+//DeactivateHMACKey marks an HMAC key as inactive,
+//it stops working but can be activated again
+func DeactivateHMACKey(
+	ctx context.Context,
+	project string,
+	accessID string,
+	service *storage.Service,
+) error {
+	_, err := service.Projects.HmacKeys.Update(
+		project,
+		accessID,
+		&storage.HmacKeyMetadata{State: HMACKeyInactive},
+	).Context(ctx).Do()
+	return err
+}
+
+//DeleteHMACKey deletes an HMAC key, active keys
+//can't be deleted so they are deactivated first
+func DeleteHMACKey(
+	ctx context.Context,
+	project string,
+	accessID string,
+	service *storage.Service,
+) error {
+	key, err := service.Projects.HmacKeys.Get(project, accessID).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	if key.State == HMACKeyActive {
+		err = DeactivateHMACKey(ctx, project, accessID, service)
+		if err != nil {
+			return err
+		}
+	}
+	return service.Projects.HmacKeys.Delete(project, accessID).Context(ctx).Do()
+}
@@ -0,0 +1,94 @@
+package google
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHMACKeySource(t *testing.T) {
+	cred := &config.Credential{
+		GoogleProjectID: "test-0000000",
+		ServiceAccount:  "test@test-0000000.iam.gserviceaccount.com",
+	}
+	t.Run("issued key has the access id and secret as fields", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, service := test.SetupHMACTestServer(t)
+		defer server.Close()
+		src := &HMACKeySource{service: service}
+
+		key, err := src.Issue(context.Background(), cred)
+		assertions.NoError(err)
+		assertions.Equal("GOOG1NEW1", key.ID)
+		assertions.Equal("GOOG1NEW1", key.Fields[FieldAccessID])
+		assertions.Equal("secret-1", key.Fields[FieldSecret])
+		assertions.Equal(
+			"[Credentials]\ngs_access_key_id = GOOG1NEW1\ngs_secret_access_key = secret-1\n",
+			string(key.Value),
+		)
+		assertions.Len(mock.Keys, 1)
+		assertions.Equal(cred.ServiceAccount, mock.Keys[0].ServiceAccount)
+	})
+	t.Run("keys of the service account are listed", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, service := test.SetupHMACTestServer(t)
+		defer server.Close()
+		created := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+		mock.Keys = []test.MockHMACKey{
+			{AccessID: "GOOG1OLD", State: "ACTIVE", ServiceAccount: cred.ServiceAccount, TimeCreated: created},
+			{AccessID: "GOOG1OTHER", State: "ACTIVE", ServiceAccount: "other", TimeCreated: created},
+		}
+		src := &HMACKeySource{service: service}
+
+		keys, err := src.List(context.Background(), cred)
+		assertions.NoError(err)
+		assertions.Len(keys, 1)
+		assertions.Equal("GOOG1OLD", keys[0].ID)
+		assertions.True(created.Equal(keys[0].CreatedAt))
+	})
+	t.Run("keys are deactivated and then deleted", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, service := test.SetupHMACTestServer(t)
+		defer server.Close()
+		mock.Keys = []test.MockHMACKey{
+			{AccessID: "GOOG1OLD", State: "ACTIVE", ServiceAccount: cred.ServiceAccount},
+		}
+		src := &HMACKeySource{service: service}
+
+		err := src.Deactivate(context.Background(), cred, "GOOG1OLD")
+		assertions.NoError(err)
+		assertions.Equal(HMACKeyInactive, mock.Keys[0].State)
+		err = src.Revoke(context.Background(), cred, "GOOG1OLD")
+		assertions.NoError(err)
+		assertions.Empty(mock.Keys)
+	})
+	t.Run("active keys are deactivated before being deleted", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, service := test.SetupHMACTestServer(t)
+		defer server.Close()
+		mock.Keys = []test.MockHMACKey{
+			{AccessID: "GOOG1OLD", State: "ACTIVE", ServiceAccount: cred.ServiceAccount},
+		}
+		src := &HMACKeySource{service: service}
+
+		err := src.Revoke(context.Background(), cred, "GOOG1OLD")
+		assertions.NoError(err)
+		assertions.Empty(mock.Keys)
+	})
+	t.Run("failing api returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, service := test.SetupHMACTestServer(t)
+		defer server.Close()
+		mock.ErrStatus = http.StatusForbidden
+		src := &HMACKeySource{service: service}
+
+		_, err := src.Issue(context.Background(), cred)
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "403")
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"path"
 
 	iam "cloud.google.com/go/iam/admin/apiv1"
 	adminpb "google.golang.org/genproto/googleapis/iam/admin/v1"
@@ -31,7 +32,7 @@ func CreateKey(
 	return resp, nil
 }
 
-//ListKeys returns all the keys under a service account
+//ListKeys returns all the user managed keys under a service account
 func ListKeys(
 	ctx context.Context,
 	project string,
@@ -45,6 +46,9 @@ func ListKeys(
 	)
 	request := &adminpb.ListServiceAccountKeysRequest{
 		Name: formatted,
+		KeyTypes: []adminpb.ListServiceAccountKeysRequest_KeyType{
+			adminpb.ListServiceAccountKeysRequest_USER_MANAGED,
+		},
 	}
 	resp, err := client.ListServiceAccountKeys(ctx, request)
 	if err != nil {
@@ -73,3 +77,9 @@ func DeleteKey(
 	err := client.DeleteServiceAccountKey(ctx, request)
 	return err
 }
+
+//KeyID returns the key ID from a key's full resource name
+//e.g projects/p/serviceAccounts/sa/keys/<id>
+func KeyID(name string) string {
+	return path.Base(name)
+}
@@ -10,11 +10,13 @@ import (
 	"testing"
 
 	iam "cloud.google.com/go/iam/admin/apiv1"
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
 	"github.com/Spazzy757/credentials-rotator/pkg/test"
 	"github.com/golang/protobuf/ptypes"
 	emptypb "github.com/golang/protobuf/ptypes/empty"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/api/option"
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
 	adminpb "google.golang.org/genproto/googleapis/iam/admin/v1"
 	status "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc"
@@ -31,7 +33,8 @@ var _ status.Status
 var clientOpt option.ClientOption
 
 var (
-	mockIam test.MockIamServer
+	mockIam           test.MockIamServer
+	mockSecretManager test.MockSecretManagerServer
 )
 
 //TestMain Setups the mock GRPC Server
@@ -40,6 +43,7 @@ func TestMain(m *testing.M) {
 
 	serv := grpc.NewServer()
 	adminpb.RegisterIAMServer(serv, &mockIam)
+	secretmanagerpb.RegisterSecretManagerServiceServer(serv, &mockSecretManager)
 
 	lis, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
@@ -168,3 +172,66 @@ func TestDeleteKey(t *testing.T) {
 		assertions.Error(err)
 	})
 }
+
+func TestKeyID(t *testing.T) {
+	t.Run("returns the key id from the resource name", func(t *testing.T) {
+		assertions := require.New(t)
+		keyID := KeyID("projects/project-1/serviceAccounts/test@example.com/keys/abc123")
+		assertions.Equal("abc123", keyID)
+	})
+}
+
+func TestKeySource(t *testing.T) {
+	t.Run("issue returns the created key", func(t *testing.T) {
+		assertions := require.New(t)
+		ctx := context.Background()
+		client, err := iam.NewIamClient(ctx, clientOpt)
+		assertions.NoError(err)
+		mockIam.Err = nil
+		mockIam.Reqs = nil
+		mockIam.Resps = append(mockIam.Resps[:0], &adminpb.ServiceAccountKey{
+			Name:           "projects/project-1/serviceAccounts/test@example.com/keys/abc123",
+			PrivateKeyData: []byte("private key"),
+		})
+		src, err := NewKeySource(&config.Config{GoogleIAMClient: client})
+		assertions.NoError(err)
+		cred := config.Credential{
+			GoogleProjectID: "project-1",
+			ServiceAccount:  "test@example.com",
+		}
+		key, err := src.Issue(ctx, &cred)
+		assertions.NoError(err)
+		assertions.Equal("abc123", key.ID)
+		assertions.Equal([]byte("private key"), key.Value)
+	})
+	t.Run("list returns key ids", func(t *testing.T) {
+		assertions := require.New(t)
+		ctx := context.Background()
+		client, err := iam.NewIamClient(ctx, clientOpt)
+		assertions.NoError(err)
+		mockIam.Err = nil
+		mockIam.Reqs = nil
+		mockIam.Resps = append(mockIam.Resps[:0], &adminpb.ListServiceAccountKeysResponse{
+			Keys: []*adminpb.ServiceAccountKey{
+				&adminpb.ServiceAccountKey{
+					Name: "projects/project-1/serviceAccounts/test@example.com/keys/abc123",
+				},
+			},
+		})
+		src, err := NewKeySource(&config.Config{GoogleIAMClient: client})
+		assertions.NoError(err)
+		cred := config.Credential{
+			GoogleProjectID: "project-1",
+			ServiceAccount:  "test@example.com",
+		}
+		keys, err := src.List(ctx, &cred)
+		assertions.NoError(err)
+		assertions.Len(keys, 1)
+		assertions.Equal("abc123", keys[0].ID)
+	})
+	t.Run("missing client returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		_, err := NewKeySource(&config.Config{})
+		assertions.Error(err)
+	})
+}
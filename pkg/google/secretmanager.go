@@ -0,0 +1,221 @@
+package google
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/iterator"
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// Labels set on the secrets that are written to
+const (
+	LabelManagedBy = "managed-by"
+	LabelKeyID     = "rotated-key-id"
+)
+
+//managedBy is the value of the managed-by label
+const managedBy = "credentials-rotator"
+
+//secretName returns the name of the credentials secret, the
+//project defaults to the project of the service account
+func secretName(cred *config.Credential) string {
+	project := cred.GoogleSecretProject
+	if project == "" {
+		project = cred.GoogleProjectID
+	}
+	return fmt.Sprintf("projects/%s/secrets/%s", project, cred.Variable)
+}
+
+//labelValue makes a key ID usable as a label value, which can
+//only have lowercase letters, digits, _ and - and be 63 characters long
+func labelValue(value string) string {
+	value = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return '-'
+	}, value)
+	if len(value) > 63 {
+		return value[:63]
+	}
+	return value
+}
+
+//labelSecret makes sure the credentials secret exists and
+//labels it with the ID of the key that is being written
+func labelSecret(
+	ctx context.Context,
+	client *secretmanager.Client,
+	cred *config.Credential,
+) error {
+	name := secretName(cred)
+	labels := map[string]string{LabelManagedBy: managedBy}
+	metadata, hasMetadata := destination.MetadataFrom(ctx)
+	if hasMetadata {
+		labels[LabelKeyID] = labelValue(metadata.KeyID)
+	}
+	secret, err := client.GetSecret(ctx, &secretmanagerpb.GetSecretRequest{Name: name})
+	if status.Code(err) == codes.NotFound {
+		_, err = client.CreateSecret(ctx, &secretmanagerpb.CreateSecretRequest{
+			Parent:   path.Dir(path.Dir(name)),
+			SecretId: path.Base(name),
+			Secret: &secretmanagerpb.Secret{
+				Replication: &secretmanagerpb.Replication{
+					Replication: &secretmanagerpb.Replication_Automatic_{
+						Automatic: &secretmanagerpb.Replication_Automatic{},
+					},
+				},
+				Labels: labels,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"secret": name,
+		}).Info("created missing secret")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !hasMetadata {
+		return nil
+	}
+	// keep the labels that were set on the secret by others
+	for key, value := range secret.Labels {
+		if _, ok := labels[key]; !ok {
+			labels[key] = value
+		}
+	}
+	_, err = client.UpdateSecret(ctx, &secretmanagerpb.UpdateSecretRequest{
+		Secret:     &secretmanagerpb.Secret{Name: name, Labels: labels},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"labels"}},
+	})
+	return err
+}
+
+//AddSecretVersion adds the value as a new version of the credentials
+//secret and returns the version number, the secret is created if it
+//is missing and labeled with the ID of the key
+func AddSecretVersion(
+	ctx context.Context,
+	client *secretmanager.Client,
+	cred *config.Credential,
+	value string,
+) (string, error) {
+	err := labelSecret(ctx, client, cred)
+	if err != nil {
+		return "", err
+	}
+	version, err := client.AddSecretVersion(ctx, &secretmanagerpb.AddSecretVersionRequest{
+		Parent:  secretName(cred),
+		Payload: &secretmanagerpb.SecretPayload{Data: []byte(value)},
+	})
+	if err != nil {
+		return "", err
+	}
+	return path.Base(version.Name), nil
+}
+
+//GetSecretValue returns the value of the latest version of the
+//credentials secret, if it doesn't exist destination.ErrNotFound is returned
+func GetSecretValue(
+	ctx context.Context,
+	client *secretmanager.Client,
+	cred *config.Credential,
+) (string, error) {
+	resp, err := client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{
+		Name: secretName(cred) + "/versions/latest",
+	})
+	if status.Code(err) == codes.NotFound {
+		return "", fmt.Errorf("secret %s: %w", secretName(cred), destination.ErrNotFound)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(resp.Payload.GetData()), nil
+}
+
+//DeleteSecret deletes the credentials secret and all its versions
+func DeleteSecret(
+	ctx context.Context,
+	client *secretmanager.Client,
+	cred *config.Credential,
+) error {
+	err := client.DeleteSecret(ctx, &secretmanagerpb.DeleteSecretRequest{
+		Name: secretName(cred),
+	})
+	if status.Code(err) == codes.NotFound {
+		return nil
+	}
+	return err
+}
+
+//DisableOldSecretVersions disables the enabled versions of the
+//credentials secret that were replaced by a newer version
+//longer than the grace period ago, the newest version is kept
+func DisableOldSecretVersions(
+	ctx context.Context,
+	client *secretmanager.Client,
+	cred *config.Credential,
+	gracePeriod time.Duration,
+) error {
+	versions := []*secretmanagerpb.SecretVersion{}
+	it := client.ListSecretVersions(ctx, &secretmanagerpb.ListSecretVersionsRequest{
+		Parent: secretName(cred),
+	})
+	for {
+		version, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].CreateTime.AsTime().After(versions[j].CreateTime.AsTime())
+	})
+	now := time.Now()
+	for i := 1; i < len(versions); i++ {
+		if versions[i].State != secretmanagerpb.SecretVersion_ENABLED {
+			continue
+		}
+		// a version is in use until the version after it was added
+		replacedAt := versions[i-1].CreateTime.AsTime()
+		if now.Sub(replacedAt) < gracePeriod {
+			continue
+		}
+		_, err := client.DisableSecretVersion(ctx, &secretmanagerpb.DisableSecretVersionRequest{
+			Name: versions[i].Name,
+		})
+		if err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"secret":  secretName(cred),
+			"version": path.Base(versions[i].Name),
+		}).Info("disabled old secret version")
+	}
+	return nil
+}
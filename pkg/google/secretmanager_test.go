@@ -0,0 +1,221 @@
+package google
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/stretchr/testify/require"
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func secretManagerClient(t *testing.T) *secretmanager.Client {
+	mockSecretManager.Reset()
+	client, err := secretmanager.NewClient(context.Background(), clientOpt)
+	require.NoError(t, err)
+	return client
+}
+
+func TestAddSecretVersion(t *testing.T) {
+	cred := &config.Credential{
+		GoogleProjectID: "project-1",
+		Variable:        "deployer-key",
+	}
+	name := "projects/project-1/secrets/deployer-key"
+	t.Run("missing secret gets created with the key label", func(t *testing.T) {
+		assertions := require.New(t)
+		client := secretManagerClient(t)
+		ctx := destination.WithMetadata(context.Background(), destination.Metadata{
+			KeyID:     "ABCDEF123",
+			RotatedAt: time.Now(),
+		})
+
+		version, err := AddSecretVersion(ctx, client, cred, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("1", version)
+		secret := mockSecretManager.Secrets[name]
+		assertions.NotNil(secret)
+		assertions.NotNil(secret.Replication.GetAutomatic())
+		assertions.Equal(map[string]string{
+			LabelManagedBy: "credentials-rotator",
+			LabelKeyID:     "abcdef123",
+		}, secret.Labels)
+		assertions.Equal("ABCDBC", string(mockSecretManager.Payloads[name+"/versions/1"]))
+	})
+	t.Run("existing secret gets a new version and keeps its labels", func(t *testing.T) {
+		assertions := require.New(t)
+		client := secretManagerClient(t)
+		mockSecretManager.Secrets[name] = &secretmanagerpb.Secret{
+			Name:   name,
+			Labels: map[string]string{"team": "platform", LabelKeyID: "old-key"},
+		}
+		mockSecretManager.Versions[name] = []*secretmanagerpb.SecretVersion{
+			{Name: name + "/versions/1", State: secretmanagerpb.SecretVersion_ENABLED},
+		}
+		ctx := destination.WithMetadata(context.Background(), destination.Metadata{
+			KeyID: "new-key",
+		})
+
+		version, err := AddSecretVersion(ctx, client, cred, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("2", version)
+		assertions.Equal(map[string]string{
+			"team":         "platform",
+			LabelManagedBy: "credentials-rotator",
+			LabelKeyID:     "new-key",
+		}, mockSecretManager.Secrets[name].Labels)
+	})
+	t.Run("secret project overrides the service account project", func(t *testing.T) {
+		assertions := require.New(t)
+		client := secretManagerClient(t)
+		other := *cred
+		other.GoogleSecretProject = "secrets-project"
+
+		_, err := AddSecretVersion(context.Background(), client, &other, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Contains(mockSecretManager.Secrets, "projects/secrets-project/secrets/deployer-key")
+	})
+}
+
+func TestGetSecretValue(t *testing.T) {
+	cred := &config.Credential{
+		GoogleProjectID: "project-1",
+		Variable:        "deployer-key",
+	}
+	t.Run("value of the latest version gets returned", func(t *testing.T) {
+		assertions := require.New(t)
+		client := secretManagerClient(t)
+		_, err := AddSecretVersion(context.Background(), client, cred, "old value")
+		assertions.NoError(err)
+		_, err = AddSecretVersion(context.Background(), client, cred, "ABCDBC")
+		assertions.NoError(err)
+
+		value, err := GetSecretValue(context.Background(), client, cred)
+		assertions.NoError(err)
+		assertions.Equal("ABCDBC", value)
+	})
+	t.Run("missing secret returns not found", func(t *testing.T) {
+		assertions := require.New(t)
+		client := secretManagerClient(t)
+
+		_, err := GetSecretValue(context.Background(), client, cred)
+		assertions.True(errors.Is(err, destination.ErrNotFound))
+	})
+}
+
+func TestDisableOldSecretVersions(t *testing.T) {
+	cred := &config.Credential{
+		GoogleProjectID: "project-1",
+		Variable:        "deployer-key",
+	}
+	name := "projects/project-1/secrets/deployer-key"
+	setup := func(t *testing.T) *secretmanager.Client {
+		client := secretManagerClient(t)
+		now := time.Now()
+		mockSecretManager.Secrets[name] = &secretmanagerpb.Secret{Name: name}
+		mockSecretManager.Versions[name] = []*secretmanagerpb.SecretVersion{
+			{
+				Name:       name + "/versions/1",
+				CreateTime: timestamppb.New(now.Add(-72 * time.Hour)),
+				State:      secretmanagerpb.SecretVersion_ENABLED,
+			},
+			{
+				Name:       name + "/versions/2",
+				CreateTime: timestamppb.New(now.Add(-48 * time.Hour)),
+				State:      secretmanagerpb.SecretVersion_ENABLED,
+			},
+			{
+				Name:       name + "/versions/3",
+				CreateTime: timestamppb.New(now.Add(-time.Hour)),
+				State:      secretmanagerpb.SecretVersion_ENABLED,
+			},
+		}
+		return client
+	}
+	states := func() []secretmanagerpb.SecretVersion_State {
+		states := []secretmanagerpb.SecretVersion_State{}
+		for _, version := range mockSecretManager.Versions[name] {
+			states = append(states, version.State)
+		}
+		return states
+	}
+	t.Run("versions replaced before the grace period get disabled", func(t *testing.T) {
+		assertions := require.New(t)
+		client := setup(t)
+
+		err := DisableOldSecretVersions(context.Background(), client, cred, 24*time.Hour)
+		assertions.NoError(err)
+		assertions.Equal([]secretmanagerpb.SecretVersion_State{
+			secretmanagerpb.SecretVersion_DISABLED,
+			secretmanagerpb.SecretVersion_ENABLED,
+			secretmanagerpb.SecretVersion_ENABLED,
+		}, states())
+	})
+	t.Run("without a grace period every old version gets disabled", func(t *testing.T) {
+		assertions := require.New(t)
+		client := setup(t)
+
+		err := DisableOldSecretVersions(context.Background(), client, cred, 0)
+		assertions.NoError(err)
+		assertions.Equal([]secretmanagerpb.SecretVersion_State{
+			secretmanagerpb.SecretVersion_DISABLED,
+			secretmanagerpb.SecretVersion_DISABLED,
+			secretmanagerpb.SecretVersion_ENABLED,
+		}, states())
+	})
+	t.Run("missing secret is ignored", func(t *testing.T) {
+		assertions := require.New(t)
+		client := secretManagerClient(t)
+
+		err := DisableOldSecretVersions(context.Background(), client, cred, 0)
+		assertions.NoError(err)
+	})
+}
+
+func TestSecretManagerDestination(t *testing.T) {
+	t.Run("missing client returns an error", func(t *testing.T) {
+		assertions := require.New(t)
+		_, err := NewSecretManagerDestination(&config.Config{})
+		assertions.Error(err)
+	})
+	t.Run("destination writes versions and deletes the secret", func(t *testing.T) {
+		assertions := require.New(t)
+		client := secretManagerClient(t)
+		dst, err := NewSecretManagerDestination(&config.Config{
+			GoogleSecretManagerClient: client,
+		})
+		assertions.NoError(err)
+		cred := &config.Credential{GoogleProjectID: "project-1", Variable: "deployer-key"}
+
+		version, err := destination.Write(context.Background(), dst, cred, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("1", version)
+		assertions.Equal(
+			"secret manager secret projects/project-1/secrets/deployer-key",
+			destination.Describe(dst, cred),
+		)
+		err = dst.Delete(context.Background(), cred)
+		assertions.NoError(err)
+		assertions.Empty(mockSecretManager.Secrets)
+	})
+	t.Run("secret without a project fails the check", func(t *testing.T) {
+		assertions := require.New(t)
+		dst, err := NewSecretManagerDestination(&config.Config{
+			GoogleSecretManagerClient: secretManagerClient(t),
+		})
+		assertions.NoError(err)
+		err = destination.Check(context.Background(), dst, &config.Credential{Variable: "deployer-key"})
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "google_project_id")
+		err = destination.Check(context.Background(), dst, &config.Credential{
+			GoogleSecretProject: "project-1",
+			Variable:            "deployer-key",
+		})
+		assertions.NoError(err)
+	})
+}
@@ -0,0 +1,186 @@
+package google
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	iam "cloud.google.com/go/iam/admin/apiv1"
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/source"
+	storage "google.golang.org/api/storage/v1"
+)
+
+func init() {
+	source.Register("google", NewKeySource)
+	source.Register("google-hmac", NewHMACKeySource)
+}
+
+// Fields of an issued HMAC key that can be written to separate variables
+const (
+	FieldAccessID = "access_id"
+	FieldSecret   = "secret"
+)
+
+//KeySource issues Google Cloud service account keys
+type KeySource struct {
+	client *iam.IamClient
+}
+
+//NewKeySource creates a KeySource from the configuration
+func NewKeySource(cfg *config.Config) (source.Source, error) {
+	if cfg.GoogleIAMClient == nil {
+		return nil, fmt.Errorf("google iam client is not configured")
+	}
+	return &KeySource{client: cfg.GoogleIAMClient}, nil
+}
+
+//Issue creates a new key on the credentials service account
+func (s *KeySource) Issue(
+	ctx context.Context,
+	cred *config.Credential,
+) (*source.Key, error) {
+	key, err := CreateKey(ctx, cred.GoogleProjectID, cred.ServiceAccount, s.client)
+	if err != nil {
+		return nil, err
+	}
+	return &source.Key{
+		ID:        KeyID(key.Name),
+		Value:     key.PrivateKeyData,
+		CreatedAt: key.ValidAfterTime.AsTime(),
+	}, nil
+}
+
+//List returns the user managed keys on the credentials service account
+func (s *KeySource) List(
+	ctx context.Context,
+	cred *config.Credential,
+) ([]source.Key, error) {
+	resp, err := ListKeys(ctx, cred.GoogleProjectID, cred.ServiceAccount, s.client)
+	if err != nil {
+		return nil, err
+	}
+	keys := []source.Key{}
+	for _, key := range resp.Keys {
+		keys = append(keys, source.Key{
+			ID:        KeyID(key.Name),
+			CreatedAt: key.ValidAfterTime.AsTime(),
+		})
+	}
+	return keys, nil
+}
+
+//Revoke deletes a key from the credentials service account
+func (s *KeySource) Revoke(
+	ctx context.Context,
+	cred *config.Credential,
+	keyID string,
+) error {
+	return DeleteKey(ctx, cred.GoogleProjectID, cred.ServiceAccount, keyID, s.client)
+}
+
+//Describe returns the service account keys are issued for
+func (s *KeySource) Describe(cred *config.Credential) string {
+	return fmt.Sprintf(
+		"service account %s in project %s",
+		cred.ServiceAccount,
+		cred.GoogleProjectID,
+	)
+}
+
+//HMACKeySource issues Google Cloud Storage HMAC keys for service accounts
+type HMACKeySource struct {
+	service *storage.Service
+}
+
+//NewHMACKeySource creates an HMACKeySource from the configuration
+func NewHMACKeySource(cfg *config.Config) (source.Source, error) {
+	if cfg.GoogleStorageService == nil {
+		return nil, fmt.Errorf("google storage service is not configured")
+	}
+	return &HMACKeySource{service: cfg.GoogleStorageService}, nil
+}
+
+//Issue creates a new HMAC key for the credentials service account,
+//the key is a boto configuration with the access ID and secret
+//which are also available as fields
+func (s *HMACKeySource) Issue(
+	ctx context.Context,
+	cred *config.Credential,
+) (*source.Key, error) {
+	key, err := CreateHMACKey(ctx, cred.GoogleProjectID, cred.ServiceAccount, s.service)
+	if err != nil {
+		return nil, err
+	}
+	createdAt, err := time.Parse(time.RFC3339, key.Metadata.TimeCreated)
+	if err != nil {
+		return nil, err
+	}
+	// the whole key is a boto configuration so
+	// it is usable without field_variables
+	botoConfig := fmt.Sprintf(
+		"[Credentials]\ngs_access_key_id = %s\ngs_secret_access_key = %s\n",
+		key.Metadata.AccessId,
+		key.Secret,
+	)
+	return &source.Key{
+		ID:    key.Metadata.AccessId,
+		Value: []byte(botoConfig),
+		Fields: map[string]string{
+			FieldAccessID: key.Metadata.AccessId,
+			FieldSecret:   key.Secret,
+		},
+		CreatedAt: createdAt,
+	}, nil
+}
+
+//List returns the HMAC keys of the credentials service account
+func (s *HMACKeySource) List(
+	ctx context.Context,
+	cred *config.Credential,
+) ([]source.Key, error) {
+	metadata, err := ListHMACKeys(ctx, cred.GoogleProjectID, cred.ServiceAccount, s.service)
+	if err != nil {
+		return nil, err
+	}
+	keys := []source.Key{}
+	for _, key := range metadata {
+		createdAt, err := time.Parse(time.RFC3339, key.TimeCreated)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, source.Key{
+			ID:        key.AccessId,
+			CreatedAt: createdAt,
+		})
+	}
+	return keys, nil
+}
+
+//Deactivate marks an HMAC key as inactive while
+//it waits for its grace period to pass
+func (s *HMACKeySource) Deactivate(
+	ctx context.Context,
+	cred *config.Credential,
+	keyID string,
+) error {
+	return DeactivateHMACKey(ctx, cred.GoogleProjectID, keyID, s.service)
+}
+
+//Revoke deletes an HMAC key of the credentials service account
+func (s *HMACKeySource) Revoke(
+	ctx context.Context,
+	cred *config.Credential,
+	keyID string,
+) error {
+	return DeleteHMACKey(ctx, cred.GoogleProjectID, keyID, s.service)
+}
+
+//Describe returns the service account HMAC keys are issued for
+func (s *HMACKeySource) Describe(cred *config.Credential) string {
+	return fmt.Sprintf(
+		"HMAC keys of service account %s in project %s",
+		cred.ServiceAccount,
+		cred.GoogleProjectID,
+	)
+}
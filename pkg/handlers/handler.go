@@ -1,41 +1,713 @@
 package handlers
 
 import (
-	iam "cloud.google.com/go/iam/admin/apiv1"
+	"fmt"
+	"sort"
+	"time"
+
 	"github.com/Spazzy757/credentials-rotator/pkg/config"
-	"github.com/Spazzy757/credentials-rotator/pkg/gitlab"
-	"github.com/Spazzy757/credentials-rotator/pkg/google"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/Spazzy757/credentials-rotator/pkg/source"
+	"github.com/Spazzy757/credentials-rotator/pkg/state"
+	log "github.com/sirupsen/logrus"
 )
 
 //ConfigHandler
-//based on type of cred it will run different scenarios
-func ConfigHandler(cfg *config.Config) error {
-	var err error
-	for _, cred := range cfg.Credentials {
-		switch cred.Type {
-		case "gitlab":
-			err = gitlabHandler(cfg, &cred, cfg.GoogleIAMClient)
+//rotates each credential from its source to its destination,
+//every credential is processed even if an earlier one failed,
+//credentials that fail the preflight are failed without rotating
+func ConfigHandler(cfg *config.Config) (Results, error) {
+	results := Results{}
+	errs := &MultiError{}
+	failed := Preflight(cfg)
+	for i := range cfg.Credentials {
+		cred := &cfg.Credentials[i]
+		if err, ok := failed[cred]; ok {
+			results = append(results, Result{
+				Credential: cred,
+				Status:     StatusFailure,
+				Err:        err,
+			})
+			errs.Errors = append(errs.Errors, &CredentialError{
+				Credential: cred,
+				Err:        err,
+			})
+			continue
+		}
+		status, destinations, err := credentialHandler(cfg, cred)
+		result := Result{
+			Credential:   cred,
+			Status:       status,
+			Destinations: destinations,
+		}
+		if err != nil {
+			result.Status = StatusFailure
+			result.Err = err
+			errs.Errors = append(errs.Errors, &CredentialError{
+				Credential: cred,
+				Err:        err,
+			})
+		}
+		results = append(results, result)
+	}
+	err := revokeDueKeys(cfg)
+	if err != nil {
+		errs.Errors = append(errs.Errors, err)
+	}
+	// the state needs to be saved even if something failed
+	// so keys pending revocation aren't forgotten
+	err = cfg.State.Save()
+	if err != nil {
+		errs.Errors = append(errs.Errors, fmt.Errorf("failed saving state: %v", err))
+	}
+	return results, errs.ErrorOrNil()
+}
+
+//Preflight
+//creates the source and destination of every credential
+//before anything is rotated, so a misconfigured credential
+//or missing permissions fail before any key is issued,
+//returns the error of each credential that failed
+func Preflight(cfg *config.Config) map[*config.Credential]error {
+	failed := map[*config.Credential]error{}
+	for i := range cfg.Credentials {
+		cred := &cfg.Credentials[i]
+		err := preflightCredential(cfg, cred)
+		if err != nil {
+			failed[cred] = fmt.Errorf("preflight failed: %v", err)
+		}
+	}
+	return failed
+}
+
+//preflightCredential
+//creates the source and destinations of the credential
+//and runs the destinations checks
+func preflightCredential(cfg *config.Config, cred *config.Credential) error {
+	_, err := source.New(cred.Source, cfg)
+	if err != nil {
+		return err
+	}
+	targets, err := newTargets(cfg, cred)
+	if err != nil {
+		return err
+	}
+	for _, t := range targets {
+		err = destination.Check(cfg.Ctx, t.dst, t.cred)
+		if err != nil {
+			return fmt.Errorf("%s: %v", t.cred, err)
+		}
+	}
+	return nil
+}
+
+//target is a destination the key of a credential is written to
+type target struct {
+	cred *config.Credential
+	dst  destination.Destination
+}
+
+//newTargets
+//creates the destinations the key of the credential is written to
+func newTargets(cfg *config.Config, cred *config.Credential) ([]target, error) {
+	targets := []target{}
+	for _, targetCred := range cred.Targets() {
+		dst, err := destination.New(targetCred.Type, cfg)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target{cred: targetCred, dst: dst})
+	}
+	return targets, nil
+}
+
+//credentialHandler
+//looks up the source and destinations of the credential and
+//rotates it, credentials whose current key is younger
+//than the max age are skipped
+func credentialHandler(
+	cfg *config.Config,
+	cred *config.Credential,
+) (Status, []DestinationResult, error) {
+	src, err := source.New(cred.Source, cfg)
+	if err != nil {
+		return StatusFailure, nil, err
+	}
+	targets, err := newTargets(cfg, cred)
+	if err != nil {
+		return StatusFailure, nil, err
+	}
+	if cfg.Force || cred.MaxKeyAge() == 0 {
+		destinations, err := rotate(cfg, cred, src, targets)
+		return StatusSuccess, destinations, err
+	}
+	keys, err := src.List(cfg.Ctx, cred)
+	if err != nil {
+		return StatusFailure, nil, err
+	}
+	current, due := rotationDue(cfg, cred, src, keys, time.Now())
+	if due {
+		destinations, err := rotate(cfg, cred, src, targets)
+		return StatusSuccess, destinations, err
+	}
+	log.WithFields(log.Fields{
+		"credential": cred.String(),
+		"key":        current.ID,
+		"created_at": current.CreatedAt.Format(time.RFC3339),
+		"max_age":    cred.MaxKeyAge().String(),
+	}).Info("key not due for rotation")
+	// keys pending revocation still need to be
+	// cleaned up when the rotation is skipped
+	err = revokeOldKeys(cfg, cred, src, current.ID)
+	if err != nil {
+		return StatusSkipped, nil, err
+	}
+	return StatusSkipped, nil, pruneTargets(cfg, cred, targets)
+}
+
+//rotationDue
+//checks if the key the credential was last rotated to is older
+//than the max age or didn't reach every destination, returns the
+//key so it can be kept when skipping
+func rotationDue(
+	cfg *config.Config,
+	cred *config.Credential,
+	src source.Source,
+	keys []source.Key,
+	now time.Time,
+) (source.Key, bool) {
+	maxAge := cred.MaxKeyAge()
+	if cfg.Force || maxAge == 0 {
+		return source.Key{}, true
+	}
+	if _, incomplete := cfg.State.IncompleteRotation(rotationKey(cred, src)); incomplete {
+		return source.Key{}, true
+	}
+	current, ok := currentKey(cfg, cred, src, keys)
+	if !ok {
+		return current, true
+	}
+	return current, now.Sub(current.CreatedAt) >= maxAge
+}
+
+//currentKey
+//returns the key every destination of the credential was last
+//written with, credentials that weren't rotated with a state yet
+//use the newest key that isn't orphaned or pending revocation
+func currentKey(
+	cfg *config.Config,
+	cred *config.Credential,
+	src source.Source,
+	keys []source.Key,
+) (source.Key, bool) {
+	if current, ok := cfg.State.CurrentKey(rotationKey(cred, src)); ok {
+		for _, key := range keys {
+			if key.ID == current.KeyID {
+				return key, true
+			}
+		}
+		// the key was deleted outside of the rotator
+		return source.Key{}, false
+	}
+	inUse := []source.Key{}
+	for _, key := range keys {
+		_, pending := cfg.State.PendingRevocation(cred.Source, key.ID)
+		if !pending && !cfg.State.IsOrphanedKey(cred.Source, key.ID) {
+			inUse = append(inUse, key)
+		}
+	}
+	return source.Newest(inUse)
+}
+
+//rotate
+//issues a new key, writes it to every destination
+//and then revokes the old keys
+func rotate(
+	cfg *config.Config,
+	cred *config.Credential,
+	src source.Source,
+	targets []target,
+) ([]DestinationResult, error) {
+	err := revokeTrackedKeys(cfg, cred, src)
+	if err != nil {
+		return nil, err
+	}
+	key, err := src.Issue(cfg.Ctx, cred)
+	if err != nil {
+		return nil, err
+	}
+	// keys the source revoked itself no longer need revoking
+	for _, keyID := range key.Revoked {
+		cfg.State.RemovePendingRevocation(cred.Source, keyID)
+		cfg.State.RemoveOrphanedKey(cred.Source, keyID)
+	}
+	destinations, err := writeTargets(cfg, key, targets)
+	failed := []string{}
+	for _, d := range destinations {
+		if d.Err != nil {
+			failed = append(failed, d.Destination.String())
+		}
+	}
+	switch {
+	case len(failed) == len(destinations):
+		return destinations, rollback(cfg, cred, src, key, err)
+	case len(failed) > 0:
+		// the key is in use by the destinations that were written
+		// so it is kept, the old keys are kept as well until
+		// a later run gets a new key to every destination
+		cfg.State.SetIncompleteRotation(state.IncompleteRotation{
+			Credential:         rotationKey(cred, src),
+			KeyID:              key.ID,
+			FailedDestinations: failed,
+		})
+		log.WithFields(log.Fields{
+			"credential": cred.String(),
+			"key":        key.ID,
+			"failed":     failed,
+		}).Warn("key not written to every destination, old keys are kept")
+		return destinations, err
+	}
+	cfg.State.RemoveIncompleteRotation(rotationKey(cred, src))
+	cfg.State.SetCurrentKey(state.CurrentKey{
+		Credential: rotationKey(cred, src),
+		KeyID:      key.ID,
+	})
+	// only clean up once the new key has been written
+	// otherwise the destination would be left without a valid key
+	err = revokeOldKeys(cfg, cred, src, key.ID)
+	if err != nil {
+		return destinations, err
+	}
+	return destinations, pruneTargets(cfg, cred, targets)
+}
+
+//rotationKey
+//identifies the rotations of a credential in the state by where its
+//keys are issued, as credentials without a name can share one
+func rotationKey(cred *config.Credential, src source.Source) string {
+	return fmt.Sprintf("%s %s", cred.Source, source.Describe(src, cred))
+}
+
+//revokeTrackedKeys
+//revokes the keys the state knows are no longer needed before a
+//new key is issued, so sources with a limit on the number of keys
+//e.g AWS have room for the new key
+func revokeTrackedKeys(
+	cfg *config.Config,
+	cred *config.Credential,
+	src source.Source,
+) error {
+	now := time.Now()
+	_, hasIncomplete := cfg.State.IncompleteRotation(rotationKey(cred, src))
+	_, limited := src.(source.Limiter)
+	if !(hasIncomplete && limited) && !tracksKeys(cfg, cred, now) {
+		return nil
+	}
+	keys, err := src.List(cfg.Ctx, cred)
+	if err != nil {
+		return err
+	}
+	for _, keyID := range trackedRevocations(cfg, cred, src, keys, now) {
+		err = src.Revoke(cfg.Ctx, cred, keyID)
+		if err != nil {
+			return err
+		}
+		cfg.State.RemovePendingRevocation(cred.Source, keyID)
+		cfg.State.RemoveOrphanedKey(cred.Source, keyID)
+		log.WithFields(log.Fields{
+			"credential": cred.String(),
+			"source":     cred.Source,
+			"key":        keyID,
+		}).Info("deleted key")
+	}
+	return nil
+}
+
+//trackedRevocations
+//decides which keys are revoked before a new key is issued, orphaned
+//keys and keys past their grace period. The key of an incomplete
+//rotation is still in use so it waits for the grace period like any
+//other old key, unless the source has no room left for the new key
+func trackedRevocations(
+	cfg *config.Config,
+	cred *config.Credential,
+	src source.Source,
+	keys []source.Key,
+	now time.Time,
+) []string {
+	revoked := []string{}
+	remaining := []source.Key{}
+	for _, key := range keys {
+		pending, isPending := cfg.State.PendingRevocation(cred.Source, key.ID)
+		if cfg.State.IsOrphanedKey(cred.Source, key.ID) || (isPending && pending.IsDue(now)) {
+			revoked = append(revoked, key.ID)
+			continue
+		}
+		remaining = append(remaining, key)
+	}
+	incomplete, hasIncomplete := cfg.State.IncompleteRotation(rotationKey(cred, src))
+	limiter, limited := src.(source.Limiter)
+	if !hasIncomplete || !limited || len(remaining) < limiter.KeyLimit() {
+		return revoked
+	}
+	// sources that deactivate keys make room by
+	// deleting a deactivated key themselves e.g AWS
+	if _, deactivates := src.(source.Deactivator); deactivates {
+		for _, key := range remaining {
+			if _, isPending := cfg.State.PendingRevocation(cred.Source, key.ID); isPending {
+				return revoked
+			}
+		}
+	}
+	for _, key := range remaining {
+		if key.ID == incomplete.KeyID {
+			revoked = append(revoked, key.ID)
+		}
+	}
+	return revoked
+}
+
+//tracksKeys
+//checks if the state has orphaned keys or keys past their
+//grace period from the source of the credential
+func tracksKeys(cfg *config.Config, cred *config.Credential, now time.Time) bool {
+	for _, o := range cfg.State.OrphanedKeys {
+		if o.Source == cred.Source {
+			return true
+		}
+	}
+	for _, p := range cfg.State.DueRevocations(now) {
+		if p.Source == cred.Source {
+			return true
 		}
 	}
-	return err
+	return false
 }
 
-//gitlabHandler
-//handler for the gitlab scenario
-func gitlabHandler(
+//writeTargets
+//writes the key to every destination even if an earlier
+//one failed, the error of each destination is returned
+func writeTargets(
+	cfg *config.Config,
+	key *source.Key,
+	targets []target,
+) ([]DestinationResult, error) {
+	destinations := []DestinationResult{}
+	errs := &MultiError{}
+	for _, t := range targets {
+		result := DestinationResult{Destination: t.cred, Status: StatusSuccess}
+		version, err := writeKey(cfg, key, t)
+		result.Version = version
+		if err != nil {
+			result.Status = StatusFailure
+			result.Err = err
+			errs.Errors = append(errs.Errors, &DestinationError{
+				Destination: t.cred,
+				Err:         err,
+			})
+		}
+		destinations = append(destinations, result)
+	}
+	// a single destination keeps its error as it is
+	if len(targets) == 1 {
+		return destinations, destinations[0].Err
+	}
+	return destinations, errs.ErrorOrNil()
+}
+
+//pruneTargets
+//disables the old values of destinations that keep them
+//once the grace period of the credential has passed
+func pruneTargets(cfg *config.Config, cred *config.Credential, targets []target) error {
+	for _, t := range targets {
+		for _, w := range keyWrites(t.cred) {
+			err := destination.Prune(cfg.Ctx, t.dst, w.cred, cred.GracePeriod())
+			if err != nil {
+				return fmt.Errorf("%s: %v", t.cred, err)
+			}
+		}
+	}
+	return nil
+}
+
+//rollback
+//revokes a key that was issued but never written to the destination
+//so unused keys don't pile up, if the key can't be revoked it is
+//saved as orphaned and cleaned up on a later run
+func rollback(
 	cfg *config.Config,
 	cred *config.Credential,
-	client *iam.IamClient,
+	src source.Source,
+	key *source.Key,
+	writeErr error,
 ) error {
-	key, err := google.CreateKey(
-		cfg.Ctx,
-		cred.GoogleProjectID,
-		cred.ServiceAccount,
-		client,
-	)
+	err := src.Revoke(cfg.Ctx, cred, key.ID)
+	if err != nil {
+		cfg.State.AddOrphanedKey(state.OrphanedKey{
+			Source:     cred.Source,
+			KeyID:      key.ID,
+			Credential: cred.String(),
+		})
+		log.WithFields(log.Fields{
+			"credential": cred.String(),
+			"source":     cred.Source,
+			"key":        key.ID,
+			"error":      err.Error(),
+		}).Error("failed revoking unused key, saved for later cleanup")
+		return fmt.Errorf("%v (rollback failed: %v)", writeErr, err)
+	}
+	log.WithFields(log.Fields{
+		"credential": cred.String(),
+		"source":     cred.Source,
+		"key":        key.ID,
+	}).Warn("revoked unused key after writing to destination failed")
+	return writeErr
+}
+
+//keyWrite is a value of the key written to a destination
+type keyWrite struct {
+	cred *config.Credential
+
+	// the field of the key that is written,
+	// the whole key is written when empty
+	field string
+}
+
+//keyWrites
+//returns the writes for every field variable of the destination
+//or a single write of the whole key when it has none
+func keyWrites(cred *config.Credential) []keyWrite {
+	if len(cred.FieldVariables) == 0 {
+		return []keyWrite{keyWrite{cred: cred}}
+	}
+	fields := []string{}
+	for field := range cred.FieldVariables {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	writes := []keyWrite{}
+	for _, field := range fields {
+		fieldCred := *cred
+		fieldCred.Variable = cred.FieldVariables[field]
+		writes = append(writes, keyWrite{cred: &fieldCred, field: field})
+	}
+	return writes
+}
+
+//writeKey
+//writes the key or its fields to the destination and
+//returns the version of the last write if it has one
+func writeKey(cfg *config.Config, key *source.Key, t target) (string, error) {
+	ctx := destination.WithMetadata(cfg.Ctx, destination.Metadata{
+		KeyID:     key.ID,
+		RotatedAt: time.Now(),
+	})
+	version := ""
+	for _, w := range keyWrites(t.cred) {
+		value := string(key.Value)
+		if w.field != "" {
+			fieldValue, ok := key.Fields[w.field]
+			if !ok {
+				return "", fmt.Errorf("key has no field %s", w.field)
+			}
+			value = fieldValue
+		}
+		written, err := destination.Write(ctx, t.dst, w.cred, value)
+		if err != nil {
+			return "", err
+		}
+		version = written
+	}
+	return version, nil
+}
+
+//revocation is what should happen to an old key
+type revocation struct {
+	keyID string
+
+	// revoke the key now, otherwise it is
+	// marked as pending revocation
+	revoke bool
+
+	// when a pending key can be revoked
+	revokeAt time.Time
+}
+
+//planRevocations
+//decides which of the keys other than the current key are revoked
+//now and which are kept until the grace period has passed
+func planRevocations(
+	cfg *config.Config,
+	cred *config.Credential,
+	keys []source.Key,
+	currentID string,
+	now time.Time,
+) []revocation {
+	revocations := []revocation{}
+	gracePeriod := cred.GracePeriod()
+	for _, key := range keys {
+		if key.ID == currentID {
+			continue
+		}
+		// orphaned keys were never used so they don't need a grace period
+		if cfg.State.IsOrphanedKey(cred.Source, key.ID) {
+			revocations = append(revocations, revocation{
+				keyID:  key.ID,
+				revoke: true,
+			})
+			continue
+		}
+		pending, isPending := cfg.State.PendingRevocation(cred.Source, key.ID)
+		switch {
+		case isPending && !pending.IsDue(now):
+			continue
+		case !isPending && gracePeriod > 0:
+			revocations = append(revocations, revocation{
+				keyID:    key.ID,
+				revokeAt: now.Add(gracePeriod),
+			})
+		default:
+			revocations = append(revocations, revocation{
+				keyID:  key.ID,
+				revoke: true,
+			})
+		}
+	}
+	return revocations
+}
+
+//revokeOldKeys
+//revokes all the keys on the source except for the current key,
+//if the credential has a grace period the keys are marked as
+//pending revocation and revoked on a later run once it has passed
+func revokeOldKeys(
+	cfg *config.Config,
+	cred *config.Credential,
+	src source.Source,
+	currentID string,
+) error {
+	keys, err := src.List(cfg.Ctx, cred)
+	if err != nil {
+		return err
+	}
+	for _, r := range planRevocations(cfg, cred, keys, currentID, time.Now()) {
+		if !r.revoke {
+			// keys that can be disabled stop working straight away
+			// but can still be restored until they are deleted
+			if deactivator, ok := src.(source.Deactivator); ok {
+				err = deactivator.Deactivate(cfg.Ctx, cred, r.keyID)
+				if err != nil {
+					return err
+				}
+			}
+			cfg.State.AddPendingRevocation(state.PendingRevocation{
+				Source:             cred.Source,
+				GoogleProjectID:    cred.GoogleProjectID,
+				ServiceAccount:     cred.ServiceAccount,
+				AWSUser:            cred.AWSUser,
+				AzureApplicationID: cred.AzureApplicationID,
+				KeyID:              r.keyID,
+				RevokeAt:           r.revokeAt,
+			})
+			log.WithFields(log.Fields{
+				"credential": cred.String(),
+				"source":     cred.Source,
+				"key":        r.keyID,
+				"revoke_at":  r.revokeAt.Format(time.RFC3339),
+			}).Info("key pending revocation")
+			continue
+		}
+		err = src.Revoke(cfg.Ctx, cred, r.keyID)
+		if err != nil {
+			return err
+		}
+		cfg.State.RemovePendingRevocation(cred.Source, r.keyID)
+		cfg.State.RemoveOrphanedKey(cred.Source, r.keyID)
+		log.WithFields(log.Fields{
+			"credential": cred.String(),
+			"source":     cred.Source,
+			"key":        r.keyID,
+		}).Info("deleted key")
+	}
+	return nil
+}
+
+//revokeDueKeys
+//revokes every key pending revocation whose grace period has passed,
+//including keys of credentials that are no longer in the configuration
+//or weren't processed, the error of each key is returned
+func revokeDueKeys(cfg *config.Config) error {
+	errs := &MultiError{}
+	for _, pending := range cfg.State.DueRevocations(time.Now()) {
+		err := revokePendingKey(cfg, pending)
+		if err != nil {
+			errs.Errors = append(errs.Errors, fmt.Errorf(
+				"failed revoking key %s from %s: %v",
+				pending.KeyID,
+				pending.Source,
+				err,
+			))
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+//revokePendingKey
+//revokes a key pending revocation through the source it was
+//issued from, a key that no longer exists is only forgotten
+func revokePendingKey(cfg *config.Config, pending state.PendingRevocation) error {
+	cred := pendingCredential(pending)
+	src, err := source.New(cred.Source, cfg)
 	if err != nil {
 		return err
 	}
-	err = gitlab.UpdateVariable(cfg.GitlabClient, cred, string(key.PrivateKeyData))
-	return err
+	exists, err := pendingKeyExists(cfg, cred, src, pending)
+	if err != nil {
+		return err
+	}
+	if exists {
+		err = src.Revoke(cfg.Ctx, cred, pending.KeyID)
+		if err != nil {
+			return err
+		}
+	}
+	cfg.State.RemovePendingRevocation(pending.Source, pending.KeyID)
+	log.WithFields(log.Fields{
+		"source": source.Describe(src, cred),
+		"key":    pending.KeyID,
+	}).Info("deleted key")
+	return nil
+}
+
+//pendingCredential
+//returns a credential for the source a key pending revocation
+//was issued from, as its credential may no longer be configured
+func pendingCredential(pending state.PendingRevocation) *config.Credential {
+	return &config.Credential{
+		Source:             pending.Source,
+		GoogleProjectID:    pending.GoogleProjectID,
+		ServiceAccount:     pending.ServiceAccount,
+		AWSUser:            pending.AWSUser,
+		AzureApplicationID: pending.AzureApplicationID,
+	}
+}
+
+//pendingKeyExists
+//checks if a key pending revocation still exists on its source
+func pendingKeyExists(
+	cfg *config.Config,
+	cred *config.Credential,
+	src source.Source,
+	pending state.PendingRevocation,
+) (bool, error) {
+	keys, err := src.List(cfg.Ctx, cred)
+	if err != nil {
+		return false, err
+	}
+	for _, key := range keys {
+		if key.ID == pending.KeyID {
+			return true, nil
+		}
+	}
+	return false, nil
 }
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -11,25 +12,34 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	iam "cloud.google.com/go/iam/admin/apiv1"
 	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	_ "github.com/Spazzy757/credentials-rotator/pkg/gitlab"
+	_ "github.com/Spazzy757/credentials-rotator/pkg/google"
+	"github.com/Spazzy757/credentials-rotator/pkg/source"
+	"github.com/Spazzy757/credentials-rotator/pkg/state"
 	"github.com/Spazzy757/credentials-rotator/pkg/test"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/api/option"
 	adminpb "google.golang.org/genproto/googleapis/iam/admin/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"gopkg.in/yaml.v2"
 )
 
 var clientOpt option.ClientOption
 
 func GetTestConfig(creds []config.Credential) config.Config {
+	tmpDir := os.TempDir()
 	testConfig := config.Config{
+		StateFile:   path.Join(tmpDir, "rotator-state.yaml"),
 		Credentials: creds,
 	}
 	configBytes, _ := yaml.Marshal(testConfig)
-	tmpDir := os.TempDir()
 	ioutil.WriteFile(path.Join(tmpDir, "config.yaml"), configBytes, 0644)
 	defer os.RemoveAll(path.Join(tmpDir, "config.yaml"))
 	cfg := config.Config{}
@@ -67,7 +77,7 @@ func mockGRPCServer() *grpc.Server {
 }
 
 //TODO: add some negative scenario tests
-func TestGitlabHandler(t *testing.T) {
+func TestCredentialHandler(t *testing.T) {
 	t.Run("handles gitlab", func(t *testing.T) {
 		assertions := require.New(t)
 		grpcServ := mockGRPCServer()
@@ -86,10 +96,26 @@ func TestGitlabHandler(t *testing.T) {
 				"auth_provider_x509_cert_url": "https://www.googleapis.com/oauth2/v1/certs",
 				"client_x509_cert_url": "https://www.googleapis.com/robot/v1/metadata/x509/test%40test-00000.iam.gserviceaccount.com"
 		}`)
+		key.Name = "projects/test-0000000/serviceAccounts/test@test-0000000.iam.gserviceaccount.com/keys/new-key"
 		expectedResponse := &key
+		listResponse := &adminpb.ListServiceAccountKeysResponse{
+			Keys: []*adminpb.ServiceAccountKey{
+				&adminpb.ServiceAccountKey{
+					Name: "projects/test-0000000/serviceAccounts/test@test-0000000.iam.gserviceaccount.com/keys/old-key",
+				},
+				&adminpb.ServiceAccountKey{
+					Name: key.Name,
+				},
+			},
+		}
 		mockIam.Err = nil
 		mockIam.Reqs = nil
-		mockIam.Resps = append(mockIam.Resps[:0], expectedResponse)
+		mockIam.Resps = append(
+			mockIam.Resps[:0],
+			expectedResponse,
+			listResponse,
+			&emptypb.Empty{},
+		)
 
 		os.Setenv("TEST", "true")
 		mux, server, _ := test.SetupGitlabTestServer(t)
@@ -121,7 +147,1145 @@ func TestGitlabHandler(t *testing.T) {
 		}
 		c, _ := iam.NewIamClient(context.Background(), clientOpt)
 		cfg := GetTestConfig(creds)
-		err := gitlabHandler(&cfg, &cfg.Credentials[0], c)
+		cfg.GoogleIAMClient = c
+		_, _, err := credentialHandler(&cfg, &cfg.Credentials[0])
+		assertions.NoError(err)
+		assertions.Len(mockIam.Reqs, 3)
+		deleteReq, ok := mockIam.Reqs[2].(*adminpb.DeleteServiceAccountKeyRequest)
+		assertions.True(ok)
+		assertions.Equal(
+			"projects/test-0000000/serviceAccounts/test@test-0000000.iam.gserviceaccount.com/keys/old-key",
+			deleteReq.Name,
+		)
+	})
+	t.Run("revokes the new key when gitlab update fails", func(t *testing.T) {
+		assertions := require.New(t)
+		grpcServ := mockGRPCServer()
+		defer grpcServ.GracefulStop()
+		mockIam.Err = nil
+		mockIam.Reqs = nil
+		mockIam.Resps = append(
+			mockIam.Resps[:0],
+			&adminpb.ServiceAccountKey{Name: "keys/new-key"},
+			&emptypb.Empty{},
+		)
+
+		os.Setenv("TEST", "true")
+		mux, server, _ := test.SetupGitlabTestServer(t)
+		mux.HandleFunc("/api/v4/projects/12345/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			},
+		)
+		defer server.Close()
+		os.Setenv("GITLAB_TEST_SERVER_URL", server.URL)
+		creds := []config.Credential{
+			config.Credential{
+				Type:            "gitlab",
+				ProjectID:       "12345",
+				Variable:        "TEST_VARIABLE",
+				GoogleProjectID: "test-0000000",
+				ServiceAccount:  "test@test-0000000.iam.gserviceaccount.com",
+			},
+		}
+		c, _ := iam.NewIamClient(context.Background(), clientOpt)
+		cfg := GetTestConfig(creds)
+		cfg.GoogleIAMClient = c
+		_, _, err := credentialHandler(&cfg, &cfg.Credentials[0])
+		assertions.Error(err)
+		// the old keys were never listed only the new key was deleted
+		assertions.Len(mockIam.Reqs, 2)
+		deleteReq, ok := mockIam.Reqs[1].(*adminpb.DeleteServiceAccountKeyRequest)
+		assertions.True(ok)
+		assertions.Equal(
+			"projects/test-0000000/serviceAccounts/test@test-0000000.iam.gserviceaccount.com/keys/new-key",
+			deleteReq.Name,
+		)
+		assertions.Empty(cfg.State.OrphanedKeys)
+	})
+}
+
+func TestRevokeOldKeys(t *testing.T) {
+	t.Run("old keys are marked pending revocation", func(t *testing.T) {
+		assertions := require.New(t)
+		grpcServ := mockGRPCServer()
+		defer grpcServ.GracefulStop()
+		mockIam.Err = nil
+		mockIam.Reqs = nil
+		mockIam.Resps = append(
+			mockIam.Resps[:0],
+			&adminpb.ListServiceAccountKeysResponse{
+				Keys: []*adminpb.ServiceAccountKey{
+					&adminpb.ServiceAccountKey{Name: "keys/old-key"},
+					&adminpb.ServiceAccountKey{Name: "keys/new-key"},
+				},
+			},
+		)
+		revokeAfter := time.Hour
+		creds := []config.Credential{
+			config.Credential{
+				Type:            "gitlab",
+				ProjectID:       "12345",
+				Variable:        "TEST_VARIABLE",
+				GoogleProjectID: "test-0000000",
+				ServiceAccount:  "test@test-0000000.iam.gserviceaccount.com",
+				RevokeAfter:     &revokeAfter,
+			},
+		}
+		c, _ := iam.NewIamClient(context.Background(), clientOpt)
+		cfg := GetTestConfig(creds)
+		cfg.GoogleIAMClient = c
+		defer os.RemoveAll(cfg.StateFile)
+		src, err := source.New("google", &cfg)
+		assertions.NoError(err)
+		err = revokeOldKeys(&cfg, &cfg.Credentials[0], src, "new-key")
+		assertions.NoError(err)
+		// only the list request, nothing was deleted
+		assertions.Len(mockIam.Reqs, 1)
+		_, pending := cfg.State.PendingRevocation("google", "old-key")
+		assertions.True(pending)
+		_, pending = cfg.State.PendingRevocation("google", "new-key")
+		assertions.False(pending)
+	})
+	t.Run("keys past their grace period are deleted", func(t *testing.T) {
+		assertions := require.New(t)
+		grpcServ := mockGRPCServer()
+		defer grpcServ.GracefulStop()
+		mockIam.Err = nil
+		mockIam.Reqs = nil
+		mockIam.Resps = append(
+			mockIam.Resps[:0],
+			&adminpb.ListServiceAccountKeysResponse{
+				Keys: []*adminpb.ServiceAccountKey{
+					&adminpb.ServiceAccountKey{Name: "keys/due-key"},
+					&adminpb.ServiceAccountKey{Name: "keys/waiting-key"},
+					&adminpb.ServiceAccountKey{Name: "keys/new-key"},
+				},
+			},
+			&emptypb.Empty{},
+		)
+		revokeAfter := time.Hour
+		creds := []config.Credential{
+			config.Credential{
+				Type:            "gitlab",
+				ProjectID:       "12345",
+				Variable:        "TEST_VARIABLE",
+				GoogleProjectID: "test-0000000",
+				ServiceAccount:  "test@test-0000000.iam.gserviceaccount.com",
+				RevokeAfter:     &revokeAfter,
+			},
+		}
+		c, _ := iam.NewIamClient(context.Background(), clientOpt)
+		cfg := GetTestConfig(creds)
+		cfg.GoogleIAMClient = c
+		defer os.RemoveAll(cfg.StateFile)
+		cfg.State.AddPendingRevocation(state.PendingRevocation{
+			Source:   "google",
+			KeyID:    "due-key",
+			RevokeAt: time.Now().Add(-time.Minute),
+		})
+		cfg.State.AddPendingRevocation(state.PendingRevocation{
+			Source:   "google",
+			KeyID:    "waiting-key",
+			RevokeAt: time.Now().Add(time.Hour),
+		})
+		src, err := source.New("google", &cfg)
+		assertions.NoError(err)
+		err = revokeOldKeys(&cfg, &cfg.Credentials[0], src, "new-key")
+		assertions.NoError(err)
+		assertions.Len(mockIam.Reqs, 2)
+		deleteReq, ok := mockIam.Reqs[1].(*adminpb.DeleteServiceAccountKeyRequest)
+		assertions.True(ok)
+		assertions.Equal(
+			"projects/test-0000000/serviceAccounts/test@test-0000000.iam.gserviceaccount.com/keys/due-key",
+			deleteReq.Name,
+		)
+		_, pending := cfg.State.PendingRevocation("google", "due-key")
+		assertions.False(pending)
+		_, pending = cfg.State.PendingRevocation("google", "waiting-key")
+		assertions.True(pending)
+	})
+}
+
+func TestConfigHandler(t *testing.T) {
+	t.Run("unknown destination returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		creds := []config.Credential{
+			config.Credential{
+				Type:     "unknown",
+				Variable: "TEST_VARIABLE",
+			},
+		}
+		cfg := GetTestConfig(creds)
+		defer os.RemoveAll(cfg.StateFile)
+		results, err := ConfigHandler(&cfg)
+		assertions.Error(err)
+		assertions.Len(results, 1)
+		assertions.Equal(StatusFailure, results[0].Status)
+	})
+	t.Run("failures are kept when a later credential succeeds", func(t *testing.T) {
+		assertions := require.New(t)
+		grpcServ := mockGRPCServer()
+		defer grpcServ.GracefulStop()
+		mockIam.Err = nil
+		mockIam.Reqs = nil
+		mockIam.Resps = append(
+			mockIam.Resps[:0],
+			&adminpb.ServiceAccountKey{Name: "keys/new-key"},
+			&adminpb.ListServiceAccountKeysResponse{},
+		)
+
+		os.Setenv("TEST", "true")
+		mux, server, _ := test.SetupGitlabTestServer(t)
+		mux.HandleFunc("/api/v4/projects/12345/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprint(w, `{"key": "TEST_VARIABLE"}`)
+			},
+		)
+		defer server.Close()
+		os.Setenv("GITLAB_TEST_SERVER_URL", server.URL)
+		creds := []config.Credential{
+			config.Credential{
+				Type:     "unknown",
+				Variable: "TEST_VARIABLE",
+			},
+			config.Credential{
+				Type:            "gitlab",
+				ProjectID:       "12345",
+				Variable:        "TEST_VARIABLE",
+				GoogleProjectID: "test-0000000",
+				ServiceAccount:  "test@test-0000000.iam.gserviceaccount.com",
+			},
+		}
+		c, _ := iam.NewIamClient(context.Background(), clientOpt)
+		cfg := GetTestConfig(creds)
+		cfg.GoogleIAMClient = c
+		defer os.RemoveAll(cfg.StateFile)
+		results, err := ConfigHandler(&cfg)
+		assertions.Error(err)
+		multiErr, ok := err.(*MultiError)
+		assertions.True(ok)
+		assertions.Len(multiErr.Errors, 1)
+		assertions.Len(results, 2)
+		assertions.Equal(StatusFailure, results[0].Status)
+		assertions.Equal(StatusSuccess, results[1].Status)
+		summary := results.Summary()
+		assertions.Equal(2, summary.Total)
+		assertions.Equal(1, summary.Failed)
+		assertions.Equal(1, summary.Succeeded)
+	})
+	t.Run("credentials failing the preflight are not rotated", func(t *testing.T) {
+		assertions := require.New(t)
+		grpcServ := mockGRPCServer()
+		defer grpcServ.GracefulStop()
+		mockIam.Err = nil
+		mockIam.Reqs = nil
+		mockIam.Resps = append(
+			mockIam.Resps[:0],
+			&adminpb.ServiceAccountKey{Name: "keys/new-key"},
+			&adminpb.ListServiceAccountKeysResponse{},
+		)
+
+		os.Setenv("TEST", "true")
+		mux, server, _ := test.SetupGitlabTestServer(t)
+		mux.HandleFunc("/api/v4/user",
+			func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"username": "developer", "is_admin": false}`)
+			},
+		)
+		mux.HandleFunc("/api/v4/projects/12345/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprint(w, `{"key": "TEST_VARIABLE"}`)
+			},
+		)
+		defer server.Close()
+		os.Setenv("GITLAB_TEST_SERVER_URL", server.URL)
+		creds := []config.Credential{
+			config.Credential{
+				Type:            "gitlab-instance",
+				Variable:        "TEST_VARIABLE",
+				GoogleProjectID: "test-0000000",
+				ServiceAccount:  "test@test-0000000.iam.gserviceaccount.com",
+			},
+			config.Credential{
+				Type:            "gitlab",
+				ProjectID:       "12345",
+				Variable:        "TEST_VARIABLE",
+				GoogleProjectID: "test-0000000",
+				ServiceAccount:  "other@test-0000000.iam.gserviceaccount.com",
+			},
+		}
+		c, _ := iam.NewIamClient(context.Background(), clientOpt)
+		cfg := GetTestConfig(creds)
+		cfg.GoogleIAMClient = c
+		defer os.RemoveAll(cfg.StateFile)
+		results, err := ConfigHandler(&cfg)
+		assertions.Error(err)
+		assertions.Len(results, 2)
+		assertions.Equal(StatusFailure, results[0].Status)
+		assertions.Contains(results[0].Err.Error(), "developer is not an administrator")
+		assertions.Equal(StatusSuccess, results[1].Status)
+		// only the key of the second credential was issued
+		assertions.Len(mockIam.Reqs, 2)
+		summary := results.Summary()
+		assertions.Equal(1, summary.Failed)
+		assertions.Equal(1, summary.Succeeded)
+	})
+	t.Run("due keys are revoked without a configured credential", func(t *testing.T) {
+		assertions := require.New(t)
+		grpcServ := mockGRPCServer()
+		defer grpcServ.GracefulStop()
+		mockIam.Err = nil
+		mockIam.Reqs = nil
+		mockIam.Resps = append(
+			mockIam.Resps[:0],
+			&adminpb.ListServiceAccountKeysResponse{
+				Keys: []*adminpb.ServiceAccountKey{
+					&adminpb.ServiceAccountKey{Name: "keys/due-key"},
+				},
+			},
+			&emptypb.Empty{},
+			&adminpb.ListServiceAccountKeysResponse{},
+		)
+		c, _ := iam.NewIamClient(context.Background(), clientOpt)
+		cfg := GetTestConfig([]config.Credential{})
+		cfg.GoogleIAMClient = c
+		defer os.RemoveAll(cfg.StateFile)
+		for _, keyID := range []string{"due-key", "deleted-key"} {
+			cfg.State.AddPendingRevocation(state.PendingRevocation{
+				Source:          "google",
+				GoogleProjectID: "test-0000000",
+				ServiceAccount:  "test@test-0000000.iam.gserviceaccount.com",
+				KeyID:           keyID,
+				RevokeAt:        time.Now().Add(-time.Minute),
+			})
+		}
+		cfg.State.AddPendingRevocation(state.PendingRevocation{
+			Source:          "google",
+			GoogleProjectID: "test-0000000",
+			ServiceAccount:  "test@test-0000000.iam.gserviceaccount.com",
+			KeyID:           "waiting-key",
+			RevokeAt:        time.Now().Add(time.Hour),
+		})
+		results, err := ConfigHandler(&cfg)
+		assertions.NoError(err)
+		assertions.Empty(results)
+		// the missing key is only removed from the state
+		assertions.Len(mockIam.Reqs, 3)
+		deleteReq, ok := mockIam.Reqs[1].(*adminpb.DeleteServiceAccountKeyRequest)
+		assertions.True(ok)
+		assertions.Equal(
+			"projects/test-0000000/serviceAccounts/test@test-0000000.iam.gserviceaccount.com/keys/due-key",
+			deleteReq.Name,
+		)
+		assertions.Len(cfg.State.PendingRevocations, 1)
+		assertions.Equal("waiting-key", cfg.State.PendingRevocations[0].KeyID)
+	})
+}
+
+func TestPreflight(t *testing.T) {
+	t.Run("unknown destination fails preflight", func(t *testing.T) {
+		assertions := require.New(t)
+		creds := []config.Credential{
+			config.Credential{
+				Type:     "unknown",
+				Variable: "TEST_VARIABLE",
+			},
+		}
+		cfg := GetTestConfig(creds)
+		defer os.RemoveAll(cfg.StateFile)
+		failed := Preflight(&cfg)
+		assertions.Len(failed, 1)
+		assertions.Contains(failed[&cfg.Credentials[0]].Error(), "unknown")
+	})
+	t.Run("gitlab instance destination needs an admin", func(t *testing.T) {
+		assertions := require.New(t)
+		os.Setenv("TEST", "true")
+		mux, server, _ := test.SetupGitlabTestServer(t)
+		mux.HandleFunc("/api/v4/user",
+			func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"username": "developer", "is_admin": false}`)
+			},
+		)
+		defer server.Close()
+		os.Setenv("GITLAB_TEST_SERVER_URL", server.URL)
+		creds := []config.Credential{
+			config.Credential{
+				Type:            "gitlab-instance",
+				Variable:        "TEST_VARIABLE",
+				GoogleProjectID: "test-0000000",
+				ServiceAccount:  "test@test-0000000.iam.gserviceaccount.com",
+			},
+		}
+		cfg := GetTestConfig(creds)
+		defer os.RemoveAll(cfg.StateFile)
+		failed := Preflight(&cfg)
+		assertions.Len(failed, 1)
+		assertions.Contains(
+			failed[&cfg.Credentials[0]].Error(),
+			"developer is not an administrator",
+		)
+	})
+	t.Run("gitlab instance destination passes for an admin", func(t *testing.T) {
+		assertions := require.New(t)
+		os.Setenv("TEST", "true")
+		mux, server, _ := test.SetupGitlabTestServer(t)
+		mux.HandleFunc("/api/v4/user",
+			func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"username": "root", "is_admin": true}`)
+			},
+		)
+		defer server.Close()
+		os.Setenv("GITLAB_TEST_SERVER_URL", server.URL)
+		creds := []config.Credential{
+			config.Credential{
+				Type:            "gitlab-instance",
+				Variable:        "TEST_VARIABLE",
+				GoogleProjectID: "test-0000000",
+				ServiceAccount:  "test@test-0000000.iam.gserviceaccount.com",
+			},
+		}
+		cfg := GetTestConfig(creds)
+		defer os.RemoveAll(cfg.StateFile)
+		failed := Preflight(&cfg)
+		assertions.Empty(failed)
+	})
+}
+
+func TestMaxAge(t *testing.T) {
+	creds := func() []config.Credential {
+		maxAge := 24 * time.Hour
+		return []config.Credential{
+			config.Credential{
+				Type:            "gitlab",
+				ProjectID:       "12345",
+				Variable:        "TEST_VARIABLE",
+				GoogleProjectID: "test-0000000",
+				ServiceAccount:  "test@test-0000000.iam.gserviceaccount.com",
+				MaxAge:          &maxAge,
+			},
+		}
+	}
+	listResponse := func(age time.Duration) *adminpb.ListServiceAccountKeysResponse {
+		return &adminpb.ListServiceAccountKeysResponse{
+			Keys: []*adminpb.ServiceAccountKey{
+				&adminpb.ServiceAccountKey{
+					Name:           "keys/current-key",
+					ValidAfterTime: timestamppb.New(time.Now().Add(-age)),
+				},
+			},
+		}
+	}
+	t.Run("young keys are skipped", func(t *testing.T) {
+		assertions := require.New(t)
+		grpcServ := mockGRPCServer()
+		defer grpcServ.GracefulStop()
+		mockIam.Err = nil
+		mockIam.Reqs = nil
+		mockIam.Resps = append(mockIam.Resps[:0], listResponse(time.Hour))
+		c, _ := iam.NewIamClient(context.Background(), clientOpt)
+		cfg := GetTestConfig(creds())
+		cfg.GoogleIAMClient = c
+		status, _, err := credentialHandler(&cfg, &cfg.Credentials[0])
+		assertions.NoError(err)
+		assertions.Equal(StatusSkipped, status)
+		for _, req := range mockIam.Reqs {
+			_, isCreate := req.(*adminpb.CreateServiceAccountKeyRequest)
+			assertions.False(isCreate)
+		}
+	})
+	t.Run("old keys are rotated", func(t *testing.T) {
+		assertions := require.New(t)
+		grpcServ := mockGRPCServer()
+		defer grpcServ.GracefulStop()
+		mockIam.Err = nil
+		mockIam.Reqs = nil
+		mockIam.Resps = append(
+			mockIam.Resps[:0],
+			listResponse(48*time.Hour),
+			&adminpb.ServiceAccountKey{Name: "keys/new-key"},
+			&adminpb.ListServiceAccountKeysResponse{},
+		)
+		os.Setenv("TEST", "true")
+		mux, server, _ := test.SetupGitlabTestServer(t)
+		mux.HandleFunc("/api/v4/projects/12345/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"key": "TEST_VARIABLE"}`)
+			},
+		)
+		defer server.Close()
+		os.Setenv("GITLAB_TEST_SERVER_URL", server.URL)
+		c, _ := iam.NewIamClient(context.Background(), clientOpt)
+		cfg := GetTestConfig(creds())
+		cfg.GoogleIAMClient = c
+		status, _, err := credentialHandler(&cfg, &cfg.Credentials[0])
+		assertions.NoError(err)
+		assertions.Equal(StatusSuccess, status)
+		_, isCreate := mockIam.Reqs[1].(*adminpb.CreateServiceAccountKeyRequest)
+		assertions.True(isCreate)
+	})
+	t.Run("force rotates young keys", func(t *testing.T) {
+		assertions := require.New(t)
+		grpcServ := mockGRPCServer()
+		defer grpcServ.GracefulStop()
+		mockIam.Err = nil
+		mockIam.Reqs = nil
+		mockIam.Resps = append(
+			mockIam.Resps[:0],
+			&adminpb.ServiceAccountKey{Name: "keys/new-key"},
+			&adminpb.ListServiceAccountKeysResponse{},
+		)
+		os.Setenv("TEST", "true")
+		mux, server, _ := test.SetupGitlabTestServer(t)
+		mux.HandleFunc("/api/v4/projects/12345/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"key": "TEST_VARIABLE"}`)
+			},
+		)
+		defer server.Close()
+		os.Setenv("GITLAB_TEST_SERVER_URL", server.URL)
+		c, _ := iam.NewIamClient(context.Background(), clientOpt)
+		cfg := GetTestConfig(creds())
+		cfg.GoogleIAMClient = c
+		cfg.Force = true
+		status, _, err := credentialHandler(&cfg, &cfg.Credentials[0])
+		assertions.NoError(err)
+		assertions.Equal(StatusSuccess, status)
+		_, isCreate := mockIam.Reqs[0].(*adminpb.CreateServiceAccountKeyRequest)
+		assertions.True(isCreate)
+	})
+}
+
+type fakeSource struct {
+	keys      []source.Key
+	revokeErr error
+	revoked   []string
+
+	// the number of keys the source can have
+	limit int
+
+	// keys the source revokes itself when issuing
+	revokedOnIssue []string
+}
+
+func (s *fakeSource) Issue(ctx context.Context, cred *config.Credential) (*source.Key, error) {
+	for _, keyID := range s.revokedOnIssue {
+		s.Revoke(ctx, cred, keyID)
+	}
+	if s.limit > 0 && len(s.keys) >= s.limit {
+		return nil, fmt.Errorf("already has %d keys", len(s.keys))
+	}
+	return &source.Key{
+		ID:        "new-key",
+		Value:     []byte("value"),
+		Fields:    map[string]string{"id": "key-id", "secret": "key-secret"},
+		CreatedAt: time.Now(),
+		Revoked:   s.revokedOnIssue,
+	}, nil
+}
+
+func (s *fakeSource) List(ctx context.Context, cred *config.Credential) ([]source.Key, error) {
+	return s.keys, nil
+}
+
+func (s *fakeSource) Revoke(ctx context.Context, cred *config.Credential, keyID string) error {
+	if s.revokeErr != nil {
+		return s.revokeErr
+	}
+	s.revoked = append(s.revoked, keyID)
+	keys := []source.Key{}
+	for _, key := range s.keys {
+		if key.ID != keyID {
+			keys = append(keys, key)
+		}
+	}
+	s.keys = keys
+	return nil
+}
+
+//limitedSource is a fakeSource that reports its key limit
+type limitedSource struct {
+	fakeSource
+}
+
+func (s *limitedSource) KeyLimit() int {
+	return s.limit
+}
+
+type fakeDestination struct {
+	writeErr error
+	written  map[string]string
+	metadata []destination.Metadata
+}
+
+func (d *fakeDestination) Write(ctx context.Context, cred *config.Credential, value string) error {
+	if d.written != nil {
+		d.written[cred.Variable] = value
+	}
+	if metadata, ok := destination.MetadataFrom(ctx); ok {
+		d.metadata = append(d.metadata, metadata)
+	}
+	return d.writeErr
+}
+
+func (d *fakeDestination) Read(ctx context.Context, cred *config.Credential) (string, error) {
+	return "", destination.ErrReadNotSupported
+}
+
+func (d *fakeDestination) Delete(ctx context.Context, cred *config.Credential) error {
+	return nil
+}
+
+type versionedDestination struct {
+	fakeDestination
+	writes int
+}
+
+func (d *versionedDestination) WriteVersion(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+) (string, error) {
+	d.writes++
+	return fmt.Sprint(d.writes), nil
+}
+
+func TestDestinationVersion(t *testing.T) {
+	t.Run("version of the last write is recorded", func(t *testing.T) {
+		assertions := require.New(t)
+		cfg := GetTestConfig([]config.Credential{
+			config.Credential{
+				Type: "fake",
+				FieldVariables: map[string]string{
+					"id":     "KEY_ID",
+					"secret": "KEY_SECRET",
+				},
+			},
+		})
+		defer os.RemoveAll(cfg.StateFile)
+		cfg.Credentials[0].Source = "fake"
+		targets := []target{
+			target{cred: &cfg.Credentials[0], dst: &versionedDestination{}},
+			target{cred: &cfg.Credentials[0], dst: &fakeDestination{}},
+		}
+		destinations, err := rotate(&cfg, &cfg.Credentials[0], &fakeSource{}, targets)
+		assertions.NoError(err)
+		assertions.Equal("2", destinations[0].Version)
+		assertions.Equal("", destinations[1].Version)
+	})
+}
+
+func TestRollback(t *testing.T) {
+	t.Run("unrevoked keys are saved as orphaned", func(t *testing.T) {
+		assertions := require.New(t)
+		cfg := GetTestConfig([]config.Credential{
+			config.Credential{Type: "fake", Variable: "TEST_VARIABLE"},
+		})
+		cfg.Credentials[0].Source = "fake"
+		src := &fakeSource{revokeErr: errors.New("revoke failed")}
+		dst := &fakeDestination{writeErr: errors.New("write failed")}
+		targets := []target{target{cred: &cfg.Credentials[0], dst: dst}}
+		_, err := rotate(&cfg, &cfg.Credentials[0], src, targets)
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "write failed")
+		assertions.Contains(err.Error(), "revoke failed")
+		assertions.True(cfg.State.IsOrphanedKey("fake", "new-key"))
+	})
+	t.Run("orphaned keys are cleaned up on a later run", func(t *testing.T) {
+		assertions := require.New(t)
+		revokeAfter := time.Hour
+		maxAge := 24 * time.Hour
+		cfg := GetTestConfig([]config.Credential{
+			config.Credential{
+				Type:        "fake",
+				Variable:    "TEST_VARIABLE",
+				RevokeAfter: &revokeAfter,
+				MaxAge:      &maxAge,
+			},
+		})
+		cfg.Credentials[0].Source = "fake"
+		cfg.State.AddOrphanedKey(state.OrphanedKey{Source: "fake", KeyID: "orphaned-key"})
+		src := &fakeSource{
+			keys: []source.Key{
+				source.Key{ID: "current-key", CreatedAt: time.Now().Add(-time.Hour)},
+				source.Key{ID: "orphaned-key", CreatedAt: time.Now()},
+			},
+		}
+		current, due := rotationDue(&cfg, &cfg.Credentials[0], src, src.keys, time.Now())
+		assertions.False(due)
+		assertions.Equal("current-key", current.ID)
+		err := revokeOldKeys(&cfg, &cfg.Credentials[0], src, current.ID)
+		assertions.NoError(err)
+		assertions.Equal([]string{"orphaned-key"}, src.revoked)
+		assertions.False(cfg.State.IsOrphanedKey("fake", "orphaned-key"))
+	})
+}
+
+func TestCurrentKey(t *testing.T) {
+	newConfig := func() config.Config {
+		maxAge := 24 * time.Hour
+		cfg := GetTestConfig([]config.Credential{
+			config.Credential{Type: "fake", Variable: "TEST_VARIABLE", MaxAge: &maxAge},
+		})
+		cfg.Credentials[0].Source = "fake"
+		return cfg
+	}
+	t.Run("keys created outside the rotator don't postpone the rotation", func(t *testing.T) {
+		assertions := require.New(t)
+		cfg := newConfig()
+		src := &fakeSource{
+			keys: []source.Key{
+				source.Key{ID: "current-key", CreatedAt: time.Now().Add(-48 * time.Hour)},
+				source.Key{ID: "other-key", CreatedAt: time.Now()},
+			},
+		}
+		cfg.State.SetCurrentKey(state.CurrentKey{
+			Credential: rotationKey(&cfg.Credentials[0], src),
+			KeyID:      "current-key",
+		})
+		current, due := rotationDue(&cfg, &cfg.Credentials[0], src, src.keys, time.Now())
+		assertions.True(due)
+		assertions.Equal("current-key", current.ID)
+	})
+	t.Run("keys are revoked relative to the current key", func(t *testing.T) {
+		assertions := require.New(t)
+		cfg := newConfig()
+		src := &fakeSource{
+			keys: []source.Key{
+				source.Key{ID: "current-key", CreatedAt: time.Now().Add(-time.Hour)},
+				source.Key{ID: "other-key", CreatedAt: time.Now()},
+			},
+		}
+		cfg.State.SetCurrentKey(state.CurrentKey{
+			Credential: rotationKey(&cfg.Credentials[0], src),
+			KeyID:      "current-key",
+		})
+		current, due := rotationDue(&cfg, &cfg.Credentials[0], src, src.keys, time.Now())
+		assertions.False(due)
+		err := revokeOldKeys(&cfg, &cfg.Credentials[0], src, current.ID)
+		assertions.NoError(err)
+		assertions.Equal([]string{"other-key"}, src.revoked)
+	})
+	t.Run("a deleted current key is rotated", func(t *testing.T) {
+		assertions := require.New(t)
+		cfg := newConfig()
+		src := &fakeSource{
+			keys: []source.Key{source.Key{ID: "other-key", CreatedAt: time.Now()}},
+		}
+		cfg.State.SetCurrentKey(state.CurrentKey{
+			Credential: rotationKey(&cfg.Credentials[0], src),
+			KeyID:      "current-key",
+		})
+		_, due := rotationDue(&cfg, &cfg.Credentials[0], src, src.keys, time.Now())
+		assertions.True(due)
+	})
+	t.Run("successful rotations save the current key", func(t *testing.T) {
+		assertions := require.New(t)
+		cfg := newConfig()
+		defer os.RemoveAll(cfg.StateFile)
+		src := &fakeSource{}
+		targets := []target{target{cred: &cfg.Credentials[0], dst: &fakeDestination{}}}
+		_, err := rotate(&cfg, &cfg.Credentials[0], src, targets)
+		assertions.NoError(err)
+		current, ok := cfg.State.CurrentKey(rotationKey(&cfg.Credentials[0], src))
+		assertions.True(ok)
+		assertions.Equal("new-key", current.KeyID)
+	})
+}
+
+func TestFanOut(t *testing.T) {
+	newConfig := func() config.Config {
+		cfg := GetTestConfig([]config.Credential{
+			config.Credential{
+				Name:     "shared",
+				Variable: "TEST_VARIABLE",
+				Destinations: []config.Credential{
+					config.Credential{Type: "fake", ProjectID: "1"},
+					config.Credential{Type: "fake", ProjectID: "2"},
+				},
+			},
+		})
+		cfg.Credentials[0].Source = "fake"
+		return cfg
+	}
+	newSource := func() *fakeSource {
+		return &fakeSource{
+			keys: []source.Key{
+				source.Key{ID: "old-key", CreatedAt: time.Now().Add(-time.Hour)},
+				source.Key{ID: "new-key", CreatedAt: time.Now()},
+			},
+		}
+	}
+	t.Run("old keys are revoked once every destination is written", func(t *testing.T) {
+		assertions := require.New(t)
+		cfg := newConfig()
+		defer os.RemoveAll(cfg.StateFile)
+		src := newSource()
+		targets := []target{
+			target{cred: &cfg.Credentials[0].Destinations[0], dst: &fakeDestination{}},
+			target{cred: &cfg.Credentials[0].Destinations[1], dst: &fakeDestination{}},
+		}
+		destinations, err := rotate(&cfg, &cfg.Credentials[0], src, targets)
 		assertions.NoError(err)
+		assertions.Len(destinations, 2)
+		assertions.Equal(StatusSuccess, destinations[0].Status)
+		assertions.Equal(StatusSuccess, destinations[1].Status)
+		assertions.Equal([]string{"old-key"}, src.revoked)
+	})
+	t.Run("old keys are kept when a destination fails", func(t *testing.T) {
+		assertions := require.New(t)
+		cfg := newConfig()
+		defer os.RemoveAll(cfg.StateFile)
+		src := newSource()
+		targets := []target{
+			target{cred: &cfg.Credentials[0].Destinations[0], dst: &fakeDestination{}},
+			target{
+				cred: &cfg.Credentials[0].Destinations[1],
+				dst:  &fakeDestination{writeErr: errors.New("write failed")},
+			},
+		}
+		destinations, err := rotate(&cfg, &cfg.Credentials[0], src, targets)
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "write failed")
+		assertions.Equal(StatusSuccess, destinations[0].Status)
+		assertions.Equal(StatusFailure, destinations[1].Status)
+		assertions.Empty(src.revoked)
+		incomplete, ok := cfg.State.IncompleteRotation(rotationKey(&cfg.Credentials[0], src))
+		assertions.True(ok)
+		assertions.Equal("new-key", incomplete.KeyID)
+		assertions.Equal([]string{"fake 2/TEST_VARIABLE"}, incomplete.FailedDestinations)
+
+		// the next run rotates again even though the newest key is young
+		maxAge := 24 * time.Hour
+		cfg.Credentials[0].MaxAge = &maxAge
+		_, due := rotationDue(&cfg, &cfg.Credentials[0], src, src.keys, time.Now())
+		assertions.True(due)
+	})
+	t.Run("key of an incomplete rotation waits for the grace period", func(t *testing.T) {
+		assertions := require.New(t)
+		cfg := newConfig()
+		defer os.RemoveAll(cfg.StateFile)
+		revokeAfter := time.Hour
+		cfg.Credentials[0].RevokeAfter = &revokeAfter
+		src := newSource()
+		src.keys[1].ID = "incomplete-key"
+		cfg.State.SetIncompleteRotation(state.IncompleteRotation{
+			Credential: rotationKey(&cfg.Credentials[0], src),
+			KeyID:      "incomplete-key",
+		})
+		targets := []target{
+			target{cred: &cfg.Credentials[0].Destinations[0], dst: &fakeDestination{}},
+			target{cred: &cfg.Credentials[0].Destinations[1], dst: &fakeDestination{}},
+		}
+		_, err := rotate(&cfg, &cfg.Credentials[0], src, targets)
+		assertions.NoError(err)
+		// destinations written by the incomplete rotation
+		// keep working until the grace period has passed
+		assertions.Empty(src.revoked)
+		_, pending := cfg.State.PendingRevocation("fake", "incomplete-key")
+		assertions.True(pending)
+		_, pending = cfg.State.PendingRevocation("fake", "old-key")
+		assertions.True(pending)
+		assertions.Empty(cfg.State.IncompleteRotations)
+	})
+	t.Run("key of an incomplete rotation is revoked when the source is full", func(t *testing.T) {
+		assertions := require.New(t)
+		cfg := newConfig()
+		defer os.RemoveAll(cfg.StateFile)
+		revokeAfter := time.Hour
+		cfg.Credentials[0].RevokeAfter = &revokeAfter
+		src := &limitedSource{*newSource()}
+		src.limit = 2
+		src.keys[1].ID = "incomplete-key"
+		cfg.State.SetIncompleteRotation(state.IncompleteRotation{
+			Credential: rotationKey(&cfg.Credentials[0], src),
+			KeyID:      "incomplete-key",
+		})
+		targets := []target{
+			target{cred: &cfg.Credentials[0].Destinations[0], dst: &fakeDestination{}},
+			target{cred: &cfg.Credentials[0].Destinations[1], dst: &fakeDestination{}},
+		}
+		_, err := rotate(&cfg, &cfg.Credentials[0], src, targets)
+		assertions.NoError(err)
+		assertions.Equal([]string{"incomplete-key"}, src.revoked)
+		_, pending := cfg.State.PendingRevocation("fake", "old-key")
+		assertions.True(pending)
+	})
+	t.Run("unnamed credentials with the same variable are kept apart", func(t *testing.T) {
+		assertions := require.New(t)
+		cfg := GetTestConfig([]config.Credential{
+			config.Credential{
+				Type:            "fake",
+				Variable:        "TEST_VARIABLE",
+				GoogleProjectID: "test-0000000",
+				ServiceAccount:  "first@test-0000000.iam.gserviceaccount.com",
+			},
+			config.Credential{
+				Type:            "fake",
+				Variable:        "TEST_VARIABLE",
+				GoogleProjectID: "test-0000000",
+				ServiceAccount:  "second@test-0000000.iam.gserviceaccount.com",
+			},
+		})
+		defer os.RemoveAll(cfg.StateFile)
+		src, err := source.New("google", &cfg)
+		assertions.NoError(err)
+		assertions.NotEqual(
+			rotationKey(&cfg.Credentials[0], src),
+			rotationKey(&cfg.Credentials[1], src),
+		)
+	})
+	t.Run("new key is rolled back when every destination fails", func(t *testing.T) {
+		assertions := require.New(t)
+		cfg := newConfig()
+		defer os.RemoveAll(cfg.StateFile)
+		src := newSource()
+		targets := []target{
+			target{
+				cred: &cfg.Credentials[0].Destinations[0],
+				dst:  &fakeDestination{writeErr: errors.New("write failed")},
+			},
+			target{
+				cred: &cfg.Credentials[0].Destinations[1],
+				dst:  &fakeDestination{writeErr: errors.New("write failed")},
+			},
+		}
+		_, err := rotate(&cfg, &cfg.Credentials[0], src, targets)
+		assertions.Error(err)
+		multiErr, ok := err.(*MultiError)
+		assertions.True(ok)
+		assertions.Len(multiErr.Errors, 2)
+		assertions.Equal([]string{"new-key"}, src.revoked)
+	})
+}
+
+type deactivatingSource struct {
+	fakeSource
+	deactivated []string
+}
+
+func (s *deactivatingSource) Deactivate(ctx context.Context, cred *config.Credential, keyID string) error {
+	s.deactivated = append(s.deactivated, keyID)
+	return nil
+}
+
+func TestKeyFields(t *testing.T) {
+	t.Run("fields are written to separate variables", func(t *testing.T) {
+		assertions := require.New(t)
+		cfg := GetTestConfig([]config.Credential{
+			config.Credential{
+				Type: "fake",
+				FieldVariables: map[string]string{
+					"id":     "KEY_ID",
+					"secret": "KEY_SECRET",
+				},
+			},
+		})
+		defer os.RemoveAll(cfg.StateFile)
+		cfg.Credentials[0].Source = "fake"
+		dst := &fakeDestination{written: map[string]string{}}
+		targets := []target{target{cred: &cfg.Credentials[0], dst: dst}}
+		_, err := rotate(&cfg, &cfg.Credentials[0], &fakeSource{}, targets)
+		assertions.NoError(err)
+		assertions.Equal(map[string]string{
+			"KEY_ID":     "key-id",
+			"KEY_SECRET": "key-secret",
+		}, dst.written)
+	})
+	t.Run("destinations get the metadata of the key", func(t *testing.T) {
+		assertions := require.New(t)
+		cfg := GetTestConfig([]config.Credential{
+			config.Credential{Type: "fake", Variable: "TEST_VARIABLE"},
+		})
+		defer os.RemoveAll(cfg.StateFile)
+		cfg.Credentials[0].Source = "fake"
+		dst := &fakeDestination{}
+		targets := []target{target{cred: &cfg.Credentials[0], dst: dst}}
+		_, err := rotate(&cfg, &cfg.Credentials[0], &fakeSource{}, targets)
+		assertions.NoError(err)
+		assertions.Len(dst.metadata, 1)
+		assertions.Equal("new-key", dst.metadata[0].KeyID)
+		assertions.False(dst.metadata[0].RotatedAt.IsZero())
+	})
+	t.Run("missing field fails the destination", func(t *testing.T) {
+		assertions := require.New(t)
+		cfg := GetTestConfig([]config.Credential{
+			config.Credential{
+				Type:           "fake",
+				FieldVariables: map[string]string{"token": "TOKEN"},
+			},
+		})
+		defer os.RemoveAll(cfg.StateFile)
+		cfg.Credentials[0].Source = "fake"
+		src := &fakeSource{}
+		targets := []target{target{cred: &cfg.Credentials[0], dst: &fakeDestination{}}}
+		_, err := rotate(&cfg, &cfg.Credentials[0], src, targets)
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "key has no field token")
+		assertions.Equal([]string{"new-key"}, src.revoked)
+	})
+}
+
+func TestTrackedKeys(t *testing.T) {
+	newConfig := func() config.Config {
+		revokeAfter := time.Hour
+		cfg := GetTestConfig([]config.Credential{
+			config.Credential{
+				Type:        "fake",
+				Variable:    "TEST_VARIABLE",
+				RevokeAfter: &revokeAfter,
+			},
+		})
+		cfg.Credentials[0].Source = "fake"
+		return cfg
+	}
+	t.Run("tracked keys are revoked to make room for the new key", func(t *testing.T) {
+		assertions := require.New(t)
+		cfg := newConfig()
+		defer os.RemoveAll(cfg.StateFile)
+		src := &limitedSource{fakeSource{
+			limit: 3,
+			keys: []source.Key{
+				source.Key{ID: "old-key"},
+				source.Key{ID: "incomplete-key"},
+				source.Key{ID: "orphaned-key"},
+				source.Key{ID: "due-key"},
+				source.Key{ID: "waiting-key"},
+			},
+		}}
+		cfg.State.SetIncompleteRotation(state.IncompleteRotation{
+			Credential: rotationKey(&cfg.Credentials[0], src),
+			KeyID:      "incomplete-key",
+		})
+		cfg.State.AddOrphanedKey(state.OrphanedKey{Source: "fake", KeyID: "orphaned-key"})
+		cfg.State.AddPendingRevocation(state.PendingRevocation{
+			Source:   "fake",
+			KeyID:    "due-key",
+			RevokeAt: time.Now().Add(-time.Minute),
+		})
+		cfg.State.AddPendingRevocation(state.PendingRevocation{
+			Source:   "fake",
+			KeyID:    "waiting-key",
+			RevokeAt: time.Now().Add(time.Hour),
+		})
+		targets := []target{target{cred: &cfg.Credentials[0], dst: &fakeDestination{}}}
+		_, err := rotate(&cfg, &cfg.Credentials[0], src, targets)
+		assertions.NoError(err)
+		assertions.Equal([]string{"orphaned-key", "due-key", "incomplete-key"}, src.revoked)
+		assertions.Empty(cfg.State.IncompleteRotations)
+		assertions.Empty(cfg.State.OrphanedKeys)
+		_, pending := cfg.State.PendingRevocation("fake", "due-key")
+		assertions.False(pending)
+		_, pending = cfg.State.PendingRevocation("fake", "waiting-key")
+		assertions.True(pending)
+		_, pending = cfg.State.PendingRevocation("fake", "old-key")
+		assertions.True(pending)
+	})
+	t.Run("keys revoked by the source are forgotten", func(t *testing.T) {
+		assertions := require.New(t)
+		cfg := newConfig()
+		defer os.RemoveAll(cfg.StateFile)
+		src := &fakeSource{
+			keys: []source.Key{
+				source.Key{ID: "old-key"},
+				source.Key{ID: "waiting-key"},
+			},
+			revokedOnIssue: []string{"waiting-key"},
+		}
+		cfg.State.AddPendingRevocation(state.PendingRevocation{
+			Source:   "fake",
+			KeyID:    "waiting-key",
+			RevokeAt: time.Now().Add(time.Hour),
+		})
+		targets := []target{target{cred: &cfg.Credentials[0], dst: &fakeDestination{}}}
+		_, err := rotate(&cfg, &cfg.Credentials[0], src, targets)
+		assertions.NoError(err)
+		_, pending := cfg.State.PendingRevocation("fake", "waiting-key")
+		assertions.False(pending)
+	})
+}
+
+func TestDeactivation(t *testing.T) {
+	t.Run("keys are deactivated while pending revocation", func(t *testing.T) {
+		assertions := require.New(t)
+		revokeAfter := time.Hour
+		cfg := GetTestConfig([]config.Credential{
+			config.Credential{
+				Type:        "fake",
+				Variable:    "TEST_VARIABLE",
+				RevokeAfter: &revokeAfter,
+			},
+		})
+		defer os.RemoveAll(cfg.StateFile)
+		cfg.Credentials[0].Source = "fake"
+		src := &deactivatingSource{
+			fakeSource: fakeSource{
+				keys: []source.Key{
+					source.Key{ID: "old-key", CreatedAt: time.Now().Add(-time.Hour)},
+					source.Key{ID: "new-key", CreatedAt: time.Now()},
+				},
+			},
+		}
+		err := revokeOldKeys(&cfg, &cfg.Credentials[0], src, "new-key")
+		assertions.NoError(err)
+		assertions.Equal([]string{"old-key"}, src.deactivated)
+		assertions.Empty(src.revoked)
+		_, pending := cfg.State.PendingRevocation("fake", "old-key")
+		assertions.True(pending)
+
+		// keys that are already pending aren't deactivated again
+		err = revokeOldKeys(&cfg, &cfg.Credentials[0], src, "new-key")
+		assertions.NoError(err)
+		assertions.Equal([]string{"old-key"}, src.deactivated)
+	})
+}
+
+type prunedDestination struct {
+	fakeDestination
+	pruned []time.Duration
+}
+
+func (d *prunedDestination) Prune(
+	ctx context.Context,
+	cred *config.Credential,
+	gracePeriod time.Duration,
+) error {
+	d.pruned = append(d.pruned, gracePeriod)
+	return nil
+}
+
+func TestPruning(t *testing.T) {
+	t.Run("destinations are pruned with the grace period after rotating", func(t *testing.T) {
+		assertions := require.New(t)
+		revokeAfter := time.Hour
+		cfg := GetTestConfig([]config.Credential{
+			config.Credential{
+				Type:        "fake",
+				Variable:    "TEST_VARIABLE",
+				RevokeAfter: &revokeAfter,
+			},
+		})
+		defer os.RemoveAll(cfg.StateFile)
+		cfg.Credentials[0].Source = "fake"
+		dst := &prunedDestination{}
+		targets := []target{target{cred: &cfg.Credentials[0], dst: dst}}
+		_, err := rotate(&cfg, &cfg.Credentials[0], &fakeSource{}, targets)
+		assertions.NoError(err)
+		assertions.Equal([]time.Duration{time.Hour}, dst.pruned)
+	})
+	t.Run("destinations aren't pruned when writing failed", func(t *testing.T) {
+		assertions := require.New(t)
+		cfg := GetTestConfig([]config.Credential{
+			config.Credential{Type: "fake", Variable: "TEST_VARIABLE"},
+		})
+		defer os.RemoveAll(cfg.StateFile)
+		cfg.Credentials[0].Source = "fake"
+		dst := &prunedDestination{fakeDestination: fakeDestination{writeErr: errors.New("write failed")}}
+		targets := []target{target{cred: &cfg.Credentials[0], dst: dst}}
+		_, err := rotate(&cfg, &cfg.Credentials[0], &fakeSource{}, targets)
+		assertions.Error(err)
+		assertions.Empty(dst.pruned)
 	})
 }
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/Spazzy757/credentials-rotator/pkg/source"
+)
+
+//Plan of what a run would do for a single credential
+type Plan struct {
+	Credential   string       `json:"credential"`
+	Source       string       `json:"source"`
+	Destinations []string     `json:"destinations"`
+	Keys         []PlannedKey `json:"keys"`
+	Rotate       bool         `json:"rotate"`
+	Actions      []string     `json:"actions"`
+	Error        string       `json:"error,omitempty"`
+}
+
+//PlannedKey is a key that currently exists on the source
+type PlannedKey struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Age       string    `json:"age"`
+}
+
+//Plans of what a run would do for every credential
+type Plans []Plan
+
+//PlanHandler
+//works out what a run would do for each credential
+//without changing anything on the sources or destinations
+func PlanHandler(cfg *config.Config) (Plans, error) {
+	plans := Plans{}
+	errs := &MultiError{}
+	failed := Preflight(cfg)
+	// keys the credentials delete themselves
+	// aren't planned again by the revocation sweep
+	planned := map[string]bool{}
+	for i := range cfg.Credentials {
+		cred := &cfg.Credentials[i]
+		plan, err := planCredential(cfg, cred)
+		if preflightErr, ok := failed[cred]; ok {
+			// nothing is rotated for a credential that fails the preflight
+			plan.Rotate = false
+			plan.Actions = []string{}
+			err = preflightErr
+		}
+		if err != nil {
+			plan.Error = err.Error()
+			errs.Errors = append(errs.Errors, &CredentialError{
+				Credential: cred,
+				Err:        err,
+			})
+		} else {
+			for _, key := range plan.Keys {
+				planned[plannedKey(cred.Source, key.ID)] = true
+			}
+		}
+		plans = append(plans, plan)
+	}
+	due, err := planDueRevocations(cfg, planned, time.Now())
+	if err != nil {
+		errs.Errors = append(errs.Errors, err)
+	}
+	plans = append(plans, due...)
+	return plans, errs.ErrorOrNil()
+}
+
+//plannedKey identifies a key across sources
+func plannedKey(src string, keyID string) string {
+	return fmt.Sprintf("%s %s", src, keyID)
+}
+
+//planCredential
+//lists the existing keys, checks the destinations
+//and returns the actions a rotation would take
+func planCredential(cfg *config.Config, cred *config.Credential) (Plan, error) {
+	plan := Plan{
+		Credential:   cred.String(),
+		Destinations: []string{},
+		Keys:         []PlannedKey{},
+		Actions:      []string{},
+	}
+	src, err := source.New(cred.Source, cfg)
+	if err != nil {
+		return plan, err
+	}
+	plan.Source = source.Describe(src, cred)
+	targets, err := newTargets(cfg, cred)
+	if err != nil {
+		return plan, err
+	}
+	for _, t := range targets {
+		plan.Destinations = append(plan.Destinations, destination.Describe(t.dst, t.cred))
+	}
+
+	now := time.Now()
+	keys, err := src.List(cfg.Ctx, cred)
+	if err != nil {
+		return plan, fmt.Errorf("failed listing keys: %v", err)
+	}
+	for _, key := range keys {
+		plan.Keys = append(plan.Keys, PlannedKey{
+			ID:        key.ID,
+			CreatedAt: key.CreatedAt,
+			Age:       now.Sub(key.CreatedAt).Round(time.Second).String(),
+		})
+	}
+	writes := []string{}
+	for _, t := range targets {
+		for _, w := range keyWrites(t.cred) {
+			write := "update"
+			_, err = t.dst.Read(cfg.Ctx, w.cred)
+			switch {
+			case errors.Is(err, destination.ErrNotFound):
+				write = "create"
+			case err != nil && !errors.Is(err, destination.ErrReadNotSupported):
+				return plan, fmt.Errorf("failed checking destination: %v", err)
+			}
+			writes = append(writes, fmt.Sprintf(
+				"%s %s",
+				write,
+				destination.Describe(t.dst, w.cred),
+			))
+		}
+	}
+
+	// the new key doesn't exist yet so every existing key is old
+	currentID := ""
+	current, due := rotationDue(cfg, cred, src, keys, now)
+	remaining := keys
+	if due {
+		plan.Rotate = true
+		revoked := trackedRevocations(cfg, cred, src, keys, now)
+		for _, keyID := range revoked {
+			plan.Actions = append(plan.Actions, fmt.Sprintf("delete key %s", keyID))
+		}
+		remaining = withoutKeys(keys, revoked)
+		plan.Actions = append(plan.Actions, fmt.Sprintf("create key for %s", plan.Source))
+		plan.Actions = append(plan.Actions, writes...)
+	} else {
+		currentID = current.ID
+		plan.Actions = append(plan.Actions, fmt.Sprintf(
+			"skip rotation, key %s is younger than the max age of %s",
+			current.ID,
+			cred.MaxKeyAge(),
+		))
+	}
+	_, deactivates := src.(source.Deactivator)
+	for _, r := range planRevocations(cfg, cred, remaining, currentID, now) {
+		switch {
+		case r.revoke:
+			plan.Actions = append(plan.Actions, fmt.Sprintf("delete key %s", r.keyID))
+		case deactivates:
+			plan.Actions = append(plan.Actions, fmt.Sprintf(
+				"deactivate key %s and delete it after %s",
+				r.keyID,
+				r.revokeAt.Format(time.RFC3339),
+			))
+		default:
+			plan.Actions = append(plan.Actions, fmt.Sprintf(
+				"mark key %s for revocation after %s",
+				r.keyID,
+				r.revokeAt.Format(time.RFC3339),
+			))
+		}
+	}
+	return plan, nil
+}
+
+//withoutKeys returns the keys other than the given ones
+func withoutKeys(keys []source.Key, keyIDs []string) []source.Key {
+	remaining := []source.Key{}
+	for _, key := range keys {
+		kept := true
+		for _, keyID := range keyIDs {
+			if key.ID == keyID {
+				kept = false
+			}
+		}
+		if kept {
+			remaining = append(remaining, key)
+		}
+	}
+	return remaining
+}
+
+//planDueRevocations
+//plans the keys past their grace period that no credential deletes,
+//e.g keys of credentials that are no longer in the configuration,
+//with a plan for every source they were issued from
+func planDueRevocations(
+	cfg *config.Config,
+	planned map[string]bool,
+	now time.Time,
+) (Plans, error) {
+	plans := Plans{}
+	errs := &MultiError{}
+	bySource := map[string]int{}
+	for _, pending := range cfg.State.DueRevocations(now) {
+		if planned[plannedKey(pending.Source, pending.KeyID)] {
+			continue
+		}
+		cred := pendingCredential(pending)
+		src, err := source.New(cred.Source, cfg)
+		if err != nil {
+			errs.Errors = append(errs.Errors, fmt.Errorf(
+				"failed planning revocation of key %s from %s: %v",
+				pending.KeyID,
+				pending.Source,
+				err,
+			))
+			continue
+		}
+		description := source.Describe(src, cred)
+		i, ok := bySource[description]
+		if !ok {
+			i = len(plans)
+			bySource[description] = i
+			plans = append(plans, Plan{
+				Credential:   "keys pending revocation",
+				Source:       description,
+				Destinations: []string{},
+				Keys:         []PlannedKey{},
+				Actions:      []string{},
+			})
+		}
+		exists, err := pendingKeyExists(cfg, cred, src, pending)
+		switch {
+		case err != nil:
+			plans[i].Error = fmt.Sprintf("failed listing keys: %v", err)
+			errs.Errors = append(errs.Errors, fmt.Errorf(
+				"failed planning revocation of key %s from %s: %v",
+				pending.KeyID,
+				pending.Source,
+				err,
+			))
+		case exists:
+			plans[i].Actions = append(plans[i].Actions, fmt.Sprintf("delete key %s", pending.KeyID))
+		default:
+			plans[i].Actions = append(plans[i].Actions, fmt.Sprintf(
+				"forget key %s, it no longer exists",
+				pending.KeyID,
+			))
+		}
+	}
+	return plans, errs.ErrorOrNil()
+}
+
+//WriteText writes the plans in a human readable format
+func (p Plans) WriteText(w io.Writer) error {
+	for _, plan := range p {
+		fmt.Fprintf(w, "credential: %s\n", plan.Credential)
+		fmt.Fprintf(w, "  source: %s\n", plan.Source)
+		fmt.Fprintf(w, "  destinations:\n")
+		for _, dst := range plan.Destinations {
+			fmt.Fprintf(w, "    - %s\n", dst)
+		}
+		fmt.Fprintf(w, "  existing keys:\n")
+		for _, key := range plan.Keys {
+			fmt.Fprintf(w, "    - %s (age %s)\n", key.ID, key.Age)
+		}
+		if plan.Error != "" {
+			fmt.Fprintf(w, "  error: %s\n", plan.Error)
+			continue
+		}
+		fmt.Fprintf(w, "  actions:\n")
+		for _, action := range plan.Actions {
+			fmt.Fprintf(w, "    - %s\n", action)
+		}
+	}
+	return nil
+}
+
+//WriteJSON writes the plans as JSON
+func (p Plans) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(p)
+}
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	iam "cloud.google.com/go/iam/admin/apiv1"
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/state"
+	"github.com/Spazzy757/credentials-rotator/pkg/test"
+	"github.com/stretchr/testify/require"
+	adminpb "google.golang.org/genproto/googleapis/iam/admin/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestPlanHandler(t *testing.T) {
+	t.Run("plans the rotation without changing anything", func(t *testing.T) {
+		assertions := require.New(t)
+		grpcServ := mockGRPCServer()
+		defer grpcServ.GracefulStop()
+		mockIam.Err = nil
+		mockIam.Reqs = nil
+		mockIam.Resps = append(
+			mockIam.Resps[:0],
+			&adminpb.ListServiceAccountKeysResponse{
+				Keys: []*adminpb.ServiceAccountKey{
+					&adminpb.ServiceAccountKey{
+						Name:           "keys/old-key",
+						ValidAfterTime: timestamppb.New(time.Now().Add(-48 * time.Hour)),
+					},
+				},
+			},
+		)
+
+		os.Setenv("TEST", "true")
+		mux, server, _ := test.SetupGitlabTestServer(t)
+		mux.HandleFunc("/api/v4/projects/12345/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				assertions.Equal(http.MethodGet, r.Method)
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprint(w, `{"key": "TEST_VARIABLE", "value": "old value"}`)
+			},
+		)
+		defer server.Close()
+		os.Setenv("GITLAB_TEST_SERVER_URL", server.URL)
+		creds := []config.Credential{
+			config.Credential{
+				Type:            "gitlab",
+				ProjectID:       "12345",
+				Variable:        "TEST_VARIABLE",
+				GoogleProjectID: "test-0000000",
+				ServiceAccount:  "test@test-0000000.iam.gserviceaccount.com",
+			},
+		}
+		c, _ := iam.NewIamClient(context.Background(), clientOpt)
+		cfg := GetTestConfig(creds)
+		cfg.GoogleIAMClient = c
+		plans, err := PlanHandler(&cfg)
+		assertions.NoError(err)
+		// only the keys were listed
+		assertions.Len(mockIam.Reqs, 1)
+		assertions.Len(plans, 1)
+		assertions.Len(plans[0].Keys, 1)
+		assertions.Equal("old-key", plans[0].Keys[0].ID)
+		assertions.Equal("48h0m0s", plans[0].Keys[0].Age)
+		assertions.Equal([]string{
+			"create key for service account test@test-0000000.iam.gserviceaccount.com in project test-0000000",
+			"update variable TEST_VARIABLE in project 12345",
+			"delete key old-key",
+		}, plans[0].Actions)
+
+		text := &bytes.Buffer{}
+		assertions.NoError(plans.WriteText(text))
+		assertions.Contains(text.String(), "- old-key (age 48h0m0s)")
+		assertions.Contains(text.String(), "- delete key old-key")
+
+		jsonOutput := &bytes.Buffer{}
+		assertions.NoError(plans.WriteJSON(jsonOutput))
+		decoded := Plans{}
+		assertions.NoError(json.Unmarshal(jsonOutput.Bytes(), &decoded))
+		assertions.Equal(plans[0].Actions, decoded[0].Actions)
+	})
+	t.Run("missing variable is planned to be created", func(t *testing.T) {
+		assertions := require.New(t)
+		grpcServ := mockGRPCServer()
+		defer grpcServ.GracefulStop()
+		mockIam.Err = nil
+		mockIam.Reqs = nil
+		mockIam.Resps = append(
+			mockIam.Resps[:0],
+			&adminpb.ListServiceAccountKeysResponse{},
+		)
+
+		os.Setenv("TEST", "true")
+		mux, server, _ := test.SetupGitlabTestServer(t)
+		mux.HandleFunc("/api/v4/projects/12345/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"message": "404 Variable Not Found"}`)
+			},
+		)
+		mux.HandleFunc("/api/v4/projects/12345",
+			func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"id": 12345}`)
+			},
+		)
+		defer server.Close()
+		os.Setenv("GITLAB_TEST_SERVER_URL", server.URL)
+		creds := []config.Credential{
+			config.Credential{
+				Type:            "gitlab",
+				ProjectID:       "12345",
+				Variable:        "TEST_VARIABLE",
+				GoogleProjectID: "test-0000000",
+				ServiceAccount:  "test@test-0000000.iam.gserviceaccount.com",
+			},
+		}
+		c, _ := iam.NewIamClient(context.Background(), clientOpt)
+		cfg := GetTestConfig(creds)
+		cfg.GoogleIAMClient = c
+		plans, err := PlanHandler(&cfg)
+		assertions.NoError(err)
+		assertions.Contains(
+			plans[0].Actions,
+			"create variable TEST_VARIABLE in project 12345",
+		)
+	})
+	t.Run("missing project is reported", func(t *testing.T) {
+		assertions := require.New(t)
+		grpcServ := mockGRPCServer()
+		defer grpcServ.GracefulStop()
+		mockIam.Err = nil
+		mockIam.Reqs = nil
+		mockIam.Resps = append(
+			mockIam.Resps[:0],
+			&adminpb.ListServiceAccountKeysResponse{},
+		)
+
+		os.Setenv("TEST", "true")
+		mux, server, _ := test.SetupGitlabTestServer(t)
+		mux.HandleFunc("/",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"message": "404 Project Not Found"}`)
+			},
+		)
+		defer server.Close()
+		os.Setenv("GITLAB_TEST_SERVER_URL", server.URL)
+		creds := []config.Credential{
+			config.Credential{
+				Type:            "gitlab",
+				ProjectID:       "12345",
+				Variable:        "TEST_VARIABLE",
+				GoogleProjectID: "test-0000000",
+				ServiceAccount:  "test@test-0000000.iam.gserviceaccount.com",
+			},
+		}
+		c, _ := iam.NewIamClient(context.Background(), clientOpt)
+		cfg := GetTestConfig(creds)
+		cfg.GoogleIAMClient = c
+		plans, err := PlanHandler(&cfg)
+		assertions.Error(err)
+		assertions.Contains(plans[0].Error, "404 Project Not Found")
+		assertions.Empty(plans[0].Actions)
+	})
+	t.Run("young keys are planned as skipped", func(t *testing.T) {
+		assertions := require.New(t)
+		grpcServ := mockGRPCServer()
+		defer grpcServ.GracefulStop()
+		mockIam.Err = nil
+		mockIam.Reqs = nil
+		mockIam.Resps = append(
+			mockIam.Resps[:0],
+			&adminpb.ListServiceAccountKeysResponse{
+				Keys: []*adminpb.ServiceAccountKey{
+					&adminpb.ServiceAccountKey{
+						Name:           "keys/current-key",
+						ValidAfterTime: timestamppb.New(time.Now().Add(-time.Hour)),
+					},
+				},
+			},
+		)
+
+		os.Setenv("TEST", "true")
+		mux, server, _ := test.SetupGitlabTestServer(t)
+		mux.HandleFunc("/api/v4/projects/12345/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"key": "TEST_VARIABLE", "value": "old value"}`)
+			},
+		)
+		defer server.Close()
+		os.Setenv("GITLAB_TEST_SERVER_URL", server.URL)
+		maxAge := 24 * time.Hour
+		creds := []config.Credential{
+			config.Credential{
+				Type:            "gitlab",
+				ProjectID:       "12345",
+				Variable:        "TEST_VARIABLE",
+				GoogleProjectID: "test-0000000",
+				ServiceAccount:  "test@test-0000000.iam.gserviceaccount.com",
+				MaxAge:          &maxAge,
+			},
+		}
+		c, _ := iam.NewIamClient(context.Background(), clientOpt)
+		cfg := GetTestConfig(creds)
+		cfg.GoogleIAMClient = c
+		plans, err := PlanHandler(&cfg)
+		assertions.NoError(err)
+		assertions.False(plans[0].Rotate)
+		assertions.Equal([]string{
+			"skip rotation, key current-key is younger than the max age of 24h0m0s",
+		}, plans[0].Actions)
+	})
+	t.Run("tracked keys are planned as deleted before the new key", func(t *testing.T) {
+		assertions := require.New(t)
+		grpcServ := mockGRPCServer()
+		defer grpcServ.GracefulStop()
+		mockIam.Err = nil
+		mockIam.Reqs = nil
+		mockIam.Resps = append(
+			mockIam.Resps[:0],
+			&adminpb.ListServiceAccountKeysResponse{
+				Keys: []*adminpb.ServiceAccountKey{
+					&adminpb.ServiceAccountKey{
+						Name:           "keys/old-key",
+						ValidAfterTime: timestamppb.New(time.Now().Add(-48 * time.Hour)),
+					},
+					&adminpb.ServiceAccountKey{
+						Name:           "keys/orphaned-key",
+						ValidAfterTime: timestamppb.New(time.Now().Add(-time.Hour)),
+					},
+				},
+			},
+		)
+
+		os.Setenv("TEST", "true")
+		mux, server, _ := test.SetupGitlabTestServer(t)
+		mux.HandleFunc("/api/v4/projects/12345/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"key": "TEST_VARIABLE", "value": "old value"}`)
+			},
+		)
+		defer server.Close()
+		os.Setenv("GITLAB_TEST_SERVER_URL", server.URL)
+		revokeAfter := time.Hour
+		creds := []config.Credential{
+			config.Credential{
+				Type:            "gitlab",
+				ProjectID:       "12345",
+				Variable:        "TEST_VARIABLE",
+				GoogleProjectID: "test-0000000",
+				ServiceAccount:  "test@test-0000000.iam.gserviceaccount.com",
+				RevokeAfter:     &revokeAfter,
+			},
+		}
+		c, _ := iam.NewIamClient(context.Background(), clientOpt)
+		cfg := GetTestConfig(creds)
+		cfg.GoogleIAMClient = c
+		cfg.State.AddOrphanedKey(state.OrphanedKey{Source: "google", KeyID: "orphaned-key"})
+		plans, err := PlanHandler(&cfg)
+		assertions.NoError(err)
+		assertions.Len(plans, 1)
+		assertions.Equal("delete key orphaned-key", plans[0].Actions[0])
+		assertions.Equal(
+			"create key for service account test@test-0000000.iam.gserviceaccount.com in project test-0000000",
+			plans[0].Actions[1],
+		)
+		assertions.Contains(plans[0].Actions[3], "mark key old-key for revocation after")
+		assertions.Len(plans[0].Actions, 4)
+	})
+	t.Run("due revocations of other service accounts are planned", func(t *testing.T) {
+		assertions := require.New(t)
+		grpcServ := mockGRPCServer()
+		defer grpcServ.GracefulStop()
+		mockIam.Err = nil
+		mockIam.Reqs = nil
+		mockIam.Resps = append(
+			mockIam.Resps[:0],
+			&adminpb.ListServiceAccountKeysResponse{
+				Keys: []*adminpb.ServiceAccountKey{
+					&adminpb.ServiceAccountKey{
+						Name:           "keys/current-key",
+						ValidAfterTime: timestamppb.New(time.Now().Add(-time.Hour)),
+					},
+				},
+			},
+			&adminpb.ListServiceAccountKeysResponse{
+				Keys: []*adminpb.ServiceAccountKey{
+					&adminpb.ServiceAccountKey{
+						Name:           "keys/removed-key",
+						ValidAfterTime: timestamppb.New(time.Now().Add(-48 * time.Hour)),
+					},
+				},
+			},
+		)
+
+		os.Setenv("TEST", "true")
+		mux, server, _ := test.SetupGitlabTestServer(t)
+		mux.HandleFunc("/api/v4/projects/12345/variables/TEST_VARIABLE",
+			func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"key": "TEST_VARIABLE", "value": "old value"}`)
+			},
+		)
+		defer server.Close()
+		os.Setenv("GITLAB_TEST_SERVER_URL", server.URL)
+		maxAge := 24 * time.Hour
+		creds := []config.Credential{
+			config.Credential{
+				Type:            "gitlab",
+				ProjectID:       "12345",
+				Variable:        "TEST_VARIABLE",
+				GoogleProjectID: "test-0000000",
+				ServiceAccount:  "test@test-0000000.iam.gserviceaccount.com",
+				MaxAge:          &maxAge,
+			},
+		}
+		c, _ := iam.NewIamClient(context.Background(), clientOpt)
+		cfg := GetTestConfig(creds)
+		cfg.GoogleIAMClient = c
+		cfg.State.AddPendingRevocation(state.PendingRevocation{
+			Source:          "google",
+			GoogleProjectID: "test-0000000",
+			ServiceAccount:  "removed@test-0000000.iam.gserviceaccount.com",
+			KeyID:           "removed-key",
+			RevokeAt:        time.Now().Add(-time.Minute),
+		})
+		plans, err := PlanHandler(&cfg)
+		assertions.NoError(err)
+		assertions.Len(plans, 2)
+		assertions.Equal("keys pending revocation", plans[1].Credential)
+		assertions.Equal(
+			"service account removed@test-0000000.iam.gserviceaccount.com in project test-0000000",
+			plans[1].Source,
+		)
+		assertions.Equal([]string{"delete key removed-key"}, plans[1].Actions)
+		// nothing was deleted
+		_, pending := cfg.State.PendingRevocation("google", "removed-key")
+		assertions.True(pending)
+	})
+}
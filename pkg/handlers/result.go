@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+)
+
+//Status of a single credential after a run
+type Status string
+
+const (
+	// StatusSuccess the credential was rotated
+	StatusSuccess Status = "success"
+	// StatusFailure the credential could not be rotated
+	StatusFailure Status = "failure"
+	// StatusSkipped the credential didn't need rotating
+	StatusSkipped Status = "skipped"
+)
+
+//Result of processing a single credential
+type Result struct {
+	Credential *config.Credential
+	Status     Status
+	Err        error
+
+	// The result of each destination the key was written to
+	Destinations []DestinationResult
+}
+
+//DestinationResult of writing the key to a single destination
+type DestinationResult struct {
+	Destination *config.Credential
+	Status      Status
+	Err         error
+
+	// The version that was written, only set
+	// by destinations that keep versions
+	Version string
+}
+
+//Results of processing all the credentials in a run
+type Results []Result
+
+//Summary counts the results by status
+type Summary struct {
+	Total     int
+	Succeeded int
+	Failed    int
+	Skipped   int
+}
+
+//Summary counts the results by status
+func (r Results) Summary() Summary {
+	summary := Summary{Total: len(r)}
+	for _, result := range r {
+		switch result.Status {
+		case StatusSuccess:
+			summary.Succeeded++
+		case StatusFailure:
+			summary.Failed++
+		case StatusSkipped:
+			summary.Skipped++
+		}
+	}
+	return summary
+}
+
+//CredentialError is the error of a single failed credential
+type CredentialError struct {
+	Credential *config.Credential
+	Err        error
+}
+
+func (e *CredentialError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Credential, e.Err)
+}
+
+//Unwrap returns the underlying error
+func (e *CredentialError) Unwrap() error {
+	return e.Err
+}
+
+//DestinationError is the error of a single failed destination
+type DestinationError struct {
+	Destination *config.Credential
+	Err         error
+}
+
+func (e *DestinationError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Destination, e.Err)
+}
+
+//Unwrap returns the underlying error
+func (e *DestinationError) Unwrap() error {
+	return e.Err
+}
+
+//MultiError collects all the errors that happened during a run
+//so that a failure on one credential isn't hidden by another
+type MultiError struct {
+	Errors []error
+}
+
+func (e *MultiError) Error() string {
+	messages := []string{}
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf(
+		"%d error(s) occurred: %s",
+		len(e.Errors),
+		strings.Join(messages, "; "),
+	)
+}
+
+//ErrorOrNil returns nil when no errors were collected
+func (e *MultiError) ErrorOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
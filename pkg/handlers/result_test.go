@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResults(t *testing.T) {
+	t.Run("summary counts results by status", func(t *testing.T) {
+		assertions := require.New(t)
+		results := Results{
+			Result{Status: StatusSuccess},
+			Result{Status: StatusFailure},
+			Result{Status: StatusSkipped},
+			Result{Status: StatusSuccess},
+		}
+		summary := results.Summary()
+		assertions.Equal(Summary{Total: 4, Succeeded: 2, Failed: 1, Skipped: 1}, summary)
+	})
+}
+
+func TestMultiError(t *testing.T) {
+	t.Run("no errors returns nil", func(t *testing.T) {
+		assertions := require.New(t)
+		errs := &MultiError{}
+		assertions.Nil(errs.ErrorOrNil())
+	})
+	t.Run("every error is reported", func(t *testing.T) {
+		assertions := require.New(t)
+		first := errors.New("first failure")
+		errs := &MultiError{
+			Errors: []error{
+				&CredentialError{
+					Credential: &config.Credential{Type: "gitlab", Variable: "FIRST"},
+					Err:        first,
+				},
+				&CredentialError{
+					Credential: &config.Credential{Name: "second"},
+					Err:        errors.New("second failure"),
+				},
+			},
+		}
+		err := errs.ErrorOrNil()
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "gitlab FIRST: first failure")
+		assertions.Contains(err.Error(), "second: second failure")
+		assertions.True(errors.Is(errs.Errors[0], first))
+	})
+}
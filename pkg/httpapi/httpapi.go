@@ -0,0 +1,155 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//Client sends JSON requests to a REST API, the settings
+//cover how the APIs differ in reporting errors
+type Client struct {
+	// The http client that authenticates with the API
+	HTTP *http.Client
+
+	// Headers sent with every request
+	Header http.Header
+
+	// Returns the message of an error response, the
+	// trimmed body is used when it is not set
+	ErrorMessage func(body []byte) string
+
+	// Wrapped by the error of not found responses
+	// e.g destination.ErrNotFound
+	NotFound error
+
+	// Decodes not found responses into out as
+	// some APIs return details along with them
+	DecodeNotFound bool
+
+	// Checks a response before its status,
+	// for APIs that report errors in other ways
+	CheckResponse func(resp *http.Response) error
+}
+
+//Do sends the body as JSON and decodes
+//the response into out if it is set
+func (c *Client) Do(
+	ctx context.Context,
+	method string,
+	requestURL string,
+	body interface{},
+	out interface{},
+) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, reader)
+	if err != nil {
+		return err
+	}
+	for name, values := range c.Header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if c.CheckResponse != nil {
+		err = c.CheckResponse(resp)
+		if err != nil {
+			return fmt.Errorf("%s %s: %v", method, requestURL, err)
+		}
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	notFound := resp.StatusCode == http.StatusNotFound && c.NotFound != nil
+	if notFound && c.DecodeNotFound && out != nil {
+		json.Unmarshal(data, out)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		status := strconv.Itoa(resp.StatusCode)
+		if message := c.errorMessage(data); message != "" {
+			status += " " + message
+		}
+		if notFound {
+			return fmt.Errorf("%s %s: %s: %w", method, requestURL, status, c.NotFound)
+		}
+		return fmt.Errorf("%s %s: %s", method, requestURL, status)
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+//errorMessage returns the message of an error response
+func (c *Client) errorMessage(body []byte) string {
+	if c.ErrorMessage != nil {
+		return c.ErrorMessage(body)
+	}
+	return strings.TrimSpace(string(body))
+}
+
+//HeaderTransport sets a header on every request
+//e.g the token of the API
+type HeaderTransport struct {
+	Name  string
+	Value string
+
+	// Sends the requests, defaults to http.DefaultTransport
+	Base http.RoundTripper
+}
+
+func (t *HeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set(t.Name, t.Value)
+	return base(t.Base).RoundTrip(req)
+}
+
+//BearerTransport returns a transport that
+//sends the token as a bearer token
+func BearerTransport(token string, rt http.RoundTripper) *HeaderTransport {
+	return &HeaderTransport{Name: "Authorization", Value: "Bearer " + token, Base: rt}
+}
+
+//BasicAuthTransport adds the user name
+//and password to every request
+type BasicAuthTransport struct {
+	Username string
+	Password string
+
+	// Sends the requests, defaults to http.DefaultTransport
+	Base http.RoundTripper
+}
+
+func (t *BasicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(t.Username, t.Password)
+	return base(t.Base).RoundTrip(req)
+}
+
+//base returns the transport requests are sent with
+func base(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		return http.DefaultTransport
+	}
+	return rt
+}
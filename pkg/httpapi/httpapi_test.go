@@ -0,0 +1,121 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	errNotFound := errors.New("not found")
+	t.Run("body is sent and the response decoded", func(t *testing.T) {
+		assertions := require.New(t)
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				assertions.Equal("application/json", r.Header.Get("Content-Type"))
+				assertions.Equal("application/json", r.Header.Get("Accept"))
+				fmt.Fprint(w, `{"name": "value"}`)
+			},
+		))
+		defer server.Close()
+		client := &Client{
+			HTTP:   server.Client(),
+			Header: http.Header{"Accept": []string{"application/json"}},
+		}
+		out := struct {
+			Name string `json:"name"`
+		}{}
+		err := client.Do(context.Background(), http.MethodPost, server.URL, map[string]string{}, &out)
+		assertions.NoError(err)
+		assertions.Equal("value", out.Name)
+	})
+	t.Run("error message is extracted", func(t *testing.T) {
+		assertions := require.New(t)
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `denied`)
+			},
+		))
+		defer server.Close()
+		client := &Client{
+			HTTP:         server.Client(),
+			ErrorMessage: func(body []byte) string { return "message: " + string(body) },
+		}
+		err := client.Do(context.Background(), http.MethodGet, server.URL, nil, nil)
+		assertions.EqualError(err, "GET "+server.URL+": 403 message: denied")
+	})
+	t.Run("not found wraps the error and can be decoded", func(t *testing.T) {
+		assertions := require.New(t)
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"version": 2}`)
+			},
+		))
+		defer server.Close()
+		client := &Client{
+			HTTP:           server.Client(),
+			ErrorMessage:   func(body []byte) string { return "" },
+			NotFound:       errNotFound,
+			DecodeNotFound: true,
+		}
+		out := struct {
+			Version int `json:"version"`
+		}{}
+		err := client.Do(context.Background(), http.MethodGet, server.URL, nil, &out)
+		assertions.True(errors.Is(err, errNotFound))
+		assertions.Equal(2, out.Version)
+	})
+	t.Run("responses are checked before their status", func(t *testing.T) {
+		assertions := require.New(t)
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNonAuthoritativeInfo)
+			},
+		))
+		defer server.Close()
+		client := &Client{
+			HTTP: server.Client(),
+			CheckResponse: func(resp *http.Response) error {
+				if resp.StatusCode == http.StatusNonAuthoritativeInfo {
+					return errors.New("not authenticated")
+				}
+				return nil
+			},
+		}
+		err := client.Do(context.Background(), http.MethodGet, server.URL, nil, nil)
+		assertions.EqualError(err, "GET "+server.URL+": not authenticated")
+	})
+}
+
+func TestTransports(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			username, password, _ := r.BasicAuth()
+			fmt.Fprintf(w, "%s|%s:%s", r.Header.Get("Authorization"), username, password)
+		},
+	))
+	defer server.Close()
+	get := func(rt http.RoundTripper) string {
+		resp, err := (&http.Client{Transport: rt}).Get(server.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body)
+	}
+	t.Run("bearer token is sent", func(t *testing.T) {
+		assertions := require.New(t)
+		assertions.Equal("Bearer token|:", get(BearerTransport("token", nil)))
+	})
+	t.Run("user name and password are sent", func(t *testing.T) {
+		assertions := require.New(t)
+		assertions.Contains(get(&BasicAuthTransport{Username: "user", Password: "pass"}), "|user:pass")
+	})
+}
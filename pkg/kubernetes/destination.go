@@ -0,0 +1,64 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"k8s.io/client-go/kubernetes"
+)
+
+func init() {
+	destination.Register("kubernetes-secret", NewSecretDestination)
+}
+
+//SecretDestination writes credentials to a key of a Kubernetes Secret
+type SecretDestination struct {
+	client kubernetes.Interface
+}
+
+//NewSecretDestination creates a SecretDestination from the configuration
+func NewSecretDestination(cfg *config.Config) (destination.Destination, error) {
+	if cfg.KubernetesClient == nil {
+		return nil, fmt.Errorf(
+			"kubernetes client is not configured, set kubeconfig or run in a cluster",
+		)
+	}
+	return &SecretDestination{client: cfg.KubernetesClient}, nil
+}
+
+//Write sets the value on the key of the Secret
+func (d *SecretDestination) Write(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+) error {
+	return UpdateSecret(ctx, d.client, cred, value)
+}
+
+//Read returns the current value of the key of the Secret
+func (d *SecretDestination) Read(
+	ctx context.Context,
+	cred *config.Credential,
+) (string, error) {
+	return GetSecret(ctx, d.client, cred)
+}
+
+//Delete removes the key from the Secret
+func (d *SecretDestination) Delete(
+	ctx context.Context,
+	cred *config.Credential,
+) error {
+	return RemoveSecretKey(ctx, d.client, cred)
+}
+
+//Describe returns the key of the Secret that is written to
+func (d *SecretDestination) Describe(cred *config.Credential) string {
+	return fmt.Sprintf(
+		"key %s in secret %s/%s",
+		cred.Variable,
+		namespace(cred),
+		cred.KubernetesSecret,
+	)
+}
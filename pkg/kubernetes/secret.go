@@ -0,0 +1,168 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// Annotations set on the Secret when kubernetes_annotate is enabled
+const (
+	AnnotationRotatedAt = "credentials-rotator/rotated-at"
+	AnnotationKeyID     = "credentials-rotator/key-id"
+)
+
+//namespace returns the namespace of the
+//credentials Secret, defaulting to default
+func namespace(cred *config.Credential) string {
+	if cred.KubernetesNamespace == "" {
+		return "default"
+	}
+	return cred.KubernetesNamespace
+}
+
+//annotate records when the Secret was rotated
+//and the ID of the key that was written
+func annotate(ctx context.Context, secret *corev1.Secret) {
+	metadata, ok := destination.MetadataFrom(ctx)
+	if !ok {
+		return
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[AnnotationRotatedAt] = metadata.RotatedAt.UTC().Format(time.RFC3339)
+	secret.Annotations[AnnotationKeyID] = metadata.KeyID
+}
+
+//UpdateSecret sets the value on the key of the credentials
+//Secret keeping its other keys, the Secret is created if it is missing
+func UpdateSecret(
+	ctx context.Context,
+	client kubernetes.Interface,
+	cred *config.Credential,
+	value string,
+) error {
+	secrets := client.CoreV1().Secrets(namespace(cred))
+	// the Secret could be changed by something else
+	// between reading and updating it
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := secrets.Get(ctx, cred.KubernetesSecret, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return createSecret(ctx, client, cred, value)
+		}
+		if err != nil {
+			return err
+		}
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[cred.Variable] = []byte(value)
+		if cred.KubernetesAnnotate {
+			annotate(ctx, secret)
+		}
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+//createSecret creates the credentials Secret with the value
+func createSecret(
+	ctx context.Context,
+	client kubernetes.Interface,
+	cred *config.Credential,
+	value string,
+) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cred.KubernetesSecret,
+			Namespace: namespace(cred),
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			cred.Variable: []byte(value),
+		},
+	}
+	if cred.KubernetesAnnotate {
+		annotate(ctx, secret)
+	}
+	_, err := client.CoreV1().Secrets(namespace(cred)).Create(ctx, secret, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"namespace": namespace(cred),
+		"secret":    cred.KubernetesSecret,
+	}).Info("created missing secret")
+	return nil
+}
+
+//GetSecret returns the value of the key of the credentials Secret,
+//if the Secret or key doesn't exist destination.ErrNotFound is returned
+func GetSecret(
+	ctx context.Context,
+	client kubernetes.Interface,
+	cred *config.Credential,
+) (string, error) {
+	secret, err := client.CoreV1().Secrets(namespace(cred)).Get(
+		ctx,
+		cred.KubernetesSecret,
+		metav1.GetOptions{},
+	)
+	if apierrors.IsNotFound(err) {
+		return "", fmt.Errorf(
+			"secret %s/%s: %w",
+			namespace(cred),
+			cred.KubernetesSecret,
+			destination.ErrNotFound,
+		)
+	}
+	if err != nil {
+		return "", err
+	}
+	value, ok := secret.Data[cred.Variable]
+	if !ok {
+		return "", fmt.Errorf(
+			"key %s in secret %s/%s: %w",
+			cred.Variable,
+			namespace(cred),
+			cred.KubernetesSecret,
+			destination.ErrNotFound,
+		)
+	}
+	return string(value), nil
+}
+
+//RemoveSecretKey removes the key from the credentials
+//Secret, the Secret itself and its other keys are kept
+func RemoveSecretKey(
+	ctx context.Context,
+	client kubernetes.Interface,
+	cred *config.Credential,
+) error {
+	secrets := client.CoreV1().Secrets(namespace(cred))
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := secrets.Get(ctx, cred.KubernetesSecret, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := secret.Data[cred.Variable]; !ok {
+			return nil
+		}
+		delete(secret.Data, cred.Variable)
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	})
+}
@@ -0,0 +1,192 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func existingSecret() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ci-credentials",
+			Namespace: "ci",
+		},
+		Data: map[string][]byte{
+			"OTHER_KEY":     []byte("other value"),
+			"TEST_VARIABLE": []byte("old value"),
+		},
+	}
+}
+
+func TestUpdateSecret(t *testing.T) {
+	cred := config.Credential{
+		KubernetesNamespace: "ci",
+		KubernetesSecret:    "ci-credentials",
+		Variable:            "TEST_VARIABLE",
+	}
+	t.Run("key gets updated and other keys are kept", func(t *testing.T) {
+		assertions := require.New(t)
+		client := fake.NewSimpleClientset(existingSecret())
+
+		err := UpdateSecret(context.Background(), client, &cred, "ABCDBC")
+		assertions.NoError(err)
+
+		secret, err := client.CoreV1().Secrets("ci").Get(
+			context.Background(),
+			"ci-credentials",
+			metav1.GetOptions{},
+		)
+		assertions.NoError(err)
+		assertions.Equal("ABCDBC", string(secret.Data["TEST_VARIABLE"]))
+		assertions.Equal("other value", string(secret.Data["OTHER_KEY"]))
+		assertions.Empty(secret.Annotations)
+	})
+	t.Run("missing secret gets created", func(t *testing.T) {
+		assertions := require.New(t)
+		client := fake.NewSimpleClientset()
+
+		err := UpdateSecret(context.Background(), client, &cred, "ABCDBC")
+		assertions.NoError(err)
+
+		secret, err := client.CoreV1().Secrets("ci").Get(
+			context.Background(),
+			"ci-credentials",
+			metav1.GetOptions{},
+		)
+		assertions.NoError(err)
+		assertions.Equal(corev1.SecretTypeOpaque, secret.Type)
+		assertions.Equal(map[string][]byte{"TEST_VARIABLE": []byte("ABCDBC")}, secret.Data)
+	})
+	t.Run("secret gets annotated with the key", func(t *testing.T) {
+		assertions := require.New(t)
+		client := fake.NewSimpleClientset(existingSecret())
+		annotated := cred
+		annotated.KubernetesAnnotate = true
+		rotatedAt := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+		ctx := destination.WithMetadata(context.Background(), destination.Metadata{
+			KeyID:     "key-2",
+			RotatedAt: rotatedAt,
+		})
+
+		err := UpdateSecret(ctx, client, &annotated, "ABCDBC")
+		assertions.NoError(err)
+
+		secret, err := client.CoreV1().Secrets("ci").Get(
+			context.Background(),
+			"ci-credentials",
+			metav1.GetOptions{},
+		)
+		assertions.NoError(err)
+		assertions.Equal("key-2", secret.Annotations[AnnotationKeyID])
+		assertions.Equal("2021-06-01T12:00:00Z", secret.Annotations[AnnotationRotatedAt])
+	})
+	t.Run("namespace defaults to default", func(t *testing.T) {
+		assertions := require.New(t)
+		client := fake.NewSimpleClientset()
+		defaulted := cred
+		defaulted.KubernetesNamespace = ""
+
+		err := UpdateSecret(context.Background(), client, &defaulted, "ABCDBC")
+		assertions.NoError(err)
+
+		_, err = client.CoreV1().Secrets("default").Get(
+			context.Background(),
+			"ci-credentials",
+			metav1.GetOptions{},
+		)
+		assertions.NoError(err)
+	})
+}
+
+func TestGetSecret(t *testing.T) {
+	cred := config.Credential{
+		KubernetesNamespace: "ci",
+		KubernetesSecret:    "ci-credentials",
+		Variable:            "TEST_VARIABLE",
+	}
+	t.Run("value of the key gets returned", func(t *testing.T) {
+		assertions := require.New(t)
+		client := fake.NewSimpleClientset(existingSecret())
+
+		value, err := GetSecret(context.Background(), client, &cred)
+		assertions.NoError(err)
+		assertions.Equal("old value", value)
+	})
+	t.Run("missing secret returns not found", func(t *testing.T) {
+		assertions := require.New(t)
+		client := fake.NewSimpleClientset()
+
+		_, err := GetSecret(context.Background(), client, &cred)
+		assertions.True(errors.Is(err, destination.ErrNotFound))
+	})
+	t.Run("missing key returns not found", func(t *testing.T) {
+		assertions := require.New(t)
+		client := fake.NewSimpleClientset(existingSecret())
+		missing := cred
+		missing.Variable = "MISSING"
+
+		_, err := GetSecret(context.Background(), client, &missing)
+		assertions.True(errors.Is(err, destination.ErrNotFound))
+	})
+}
+
+func TestRemoveSecretKey(t *testing.T) {
+	cred := config.Credential{
+		KubernetesNamespace: "ci",
+		KubernetesSecret:    "ci-credentials",
+		Variable:            "TEST_VARIABLE",
+	}
+	t.Run("only the key gets removed", func(t *testing.T) {
+		assertions := require.New(t)
+		client := fake.NewSimpleClientset(existingSecret())
+
+		err := RemoveSecretKey(context.Background(), client, &cred)
+		assertions.NoError(err)
+
+		secret, err := client.CoreV1().Secrets("ci").Get(
+			context.Background(),
+			"ci-credentials",
+			metav1.GetOptions{},
+		)
+		assertions.NoError(err)
+		assertions.Equal(map[string][]byte{"OTHER_KEY": []byte("other value")}, secret.Data)
+	})
+	t.Run("missing secret is ignored", func(t *testing.T) {
+		assertions := require.New(t)
+		client := fake.NewSimpleClientset()
+
+		err := RemoveSecretKey(context.Background(), client, &cred)
+		assertions.NoError(err)
+	})
+}
+
+func TestNewSecretDestination(t *testing.T) {
+	t.Run("missing client returns an error", func(t *testing.T) {
+		assertions := require.New(t)
+		_, err := NewSecretDestination(&config.Config{})
+		assertions.Error(err)
+	})
+	t.Run("destination describes the secret", func(t *testing.T) {
+		assertions := require.New(t)
+		dst, err := NewSecretDestination(&config.Config{
+			KubernetesClient: fake.NewSimpleClientset(),
+		})
+		assertions.NoError(err)
+		assertions.Equal(
+			"key TEST_VARIABLE in secret default/ci-credentials",
+			destination.Describe(dst, &config.Credential{
+				KubernetesSecret: "ci-credentials",
+				Variable:         "TEST_VARIABLE",
+			}),
+		)
+	})
+}
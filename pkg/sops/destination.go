@@ -0,0 +1,61 @@
+package sops
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+)
+
+func init() {
+	destination.Register("sops", NewDocumentDestination)
+}
+
+//DocumentDestination writes credentials to a key
+//of a SOPS encrypted YAML or JSON document
+type DocumentDestination struct{}
+
+//NewDocumentDestination creates a DocumentDestination
+func NewDocumentDestination(cfg *config.Config) (destination.Destination, error) {
+	return &DocumentDestination{}, nil
+}
+
+//Write sets the value on the key of the document
+func (d *DocumentDestination) Write(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+) error {
+	return UpdateDocument(cred, value)
+}
+
+//Read returns the current value of the key of the document
+func (d *DocumentDestination) Read(
+	ctx context.Context,
+	cred *config.Credential,
+) (string, error) {
+	return GetValue(cred)
+}
+
+//Delete removes the key from the document
+func (d *DocumentDestination) Delete(
+	ctx context.Context,
+	cred *config.Credential,
+) error {
+	return RemoveKey(cred)
+}
+
+//Check makes sure the document can be decrypted
+//before anything is rotated
+func (d *DocumentDestination) Check(
+	ctx context.Context,
+	cred *config.Credential,
+) error {
+	return CheckDocument(cred)
+}
+
+//Describe returns the key of the document that is written to
+func (d *DocumentDestination) Describe(cred *config.Credential) string {
+	return fmt.Sprintf("key %s in sops file %s", cred.Variable, cred.SOPSFile)
+}
@@ -0,0 +1,195 @@
+package sops
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/Spazzy757/credentials-rotator/pkg/file"
+	log "github.com/sirupsen/logrus"
+	mozillasops "go.mozilla.org/sops/v3"
+	"go.mozilla.org/sops/v3/aes"
+	"go.mozilla.org/sops/v3/cmd/sops/common"
+	"go.mozilla.org/sops/v3/cmd/sops/formats"
+	"go.mozilla.org/sops/v3/keyservice"
+)
+
+//document is a decrypted SOPS document, it
+//is only ever held in memory and never written to disk
+type document struct {
+	path    string
+	mode    os.FileMode
+	store   common.Store
+	tree    *mozillasops.Tree
+	dataKey []byte
+}
+
+//openDocument reads and decrypts the credentials SOPS document with
+//the keys available locally e.g SOPS_AGE_KEY_FILE, gpg or cloud KMS,
+//if the document doesn't exist destination.ErrNotFound is returned
+func openDocument(cred *config.Credential) (*document, error) {
+	format := formats.FormatForPath(cred.SOPSFile)
+	if format != formats.Yaml && format != formats.Json {
+		return nil, fmt.Errorf("sops file %s is not a YAML or JSON document", cred.SOPSFile)
+	}
+	info, err := os.Stat(cred.SOPSFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("sops file %s: %w", cred.SOPSFile, destination.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(cred.SOPSFile)
+	if err != nil {
+		return nil, err
+	}
+	store := common.StoreForFormat(format)
+	tree, err := store.LoadEncryptedFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("loading sops file %s: %w", cred.SOPSFile, err)
+	}
+	dataKey, err := common.DecryptTree(common.DecryptTreeOpts{
+		Tree:        &tree,
+		KeyServices: []keyservice.KeyServiceClient{keyservice.NewLocalClient()},
+		Cipher:      aes.NewCipher(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("decrypting sops file %s: %w", cred.SOPSFile, err)
+	}
+	return &document{
+		path:    cred.SOPSFile,
+		mode:    info.Mode().Perm(),
+		store:   store,
+		tree:    &tree,
+		dataKey: dataKey,
+	}, nil
+}
+
+//save encrypts the document with its existing data
+//key and replaces the file with it atomically
+func (d *document) save() error {
+	err := common.EncryptTree(common.EncryptTreeOpts{
+		Tree:    d.tree,
+		Cipher:  aes.NewCipher(),
+		DataKey: d.dataKey,
+	})
+	if err != nil {
+		return fmt.Errorf("encrypting sops file %s: %w", d.path, err)
+	}
+	data, err := d.store.EmitEncryptedFile(*d.tree)
+	if err != nil {
+		return err
+	}
+	return file.WriteAtomic(d.path, data, d.mode)
+}
+
+//keyPath returns the keys leading to the credentials value
+func keyPath(cred *config.Credential) []string {
+	path := append([]string{}, cred.SOPSPath...)
+	return append(path, cred.Variable)
+}
+
+//lookup returns the value at the path of keys in the branch
+func lookup(branch mozillasops.TreeBranch, path []string) (interface{}, bool) {
+	for _, item := range branch {
+		if item.Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return item.Value, true
+		}
+		child, ok := item.Value.(mozillasops.TreeBranch)
+		if !ok {
+			return nil, false
+		}
+		return lookup(child, path[1:])
+	}
+	return nil, false
+}
+
+//remove returns the branch without the value at the path of keys
+func remove(branch mozillasops.TreeBranch, path []string) mozillasops.TreeBranch {
+	result := mozillasops.TreeBranch{}
+	for _, item := range branch {
+		if item.Key == path[0] {
+			if len(path) == 1 {
+				continue
+			}
+			if child, ok := item.Value.(mozillasops.TreeBranch); ok {
+				item.Value = remove(child, path[1:])
+			}
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+//UpdateDocument sets the value on the key of the credentials SOPS
+//document, the rest of the document is decrypted in memory and
+//encrypted again with the same keys
+func UpdateDocument(cred *config.Credential, value string) error {
+	doc, err := openDocument(cred)
+	if err != nil {
+		return err
+	}
+	path := []interface{}{}
+	for _, key := range keyPath(cred) {
+		path = append(path, key)
+	}
+	doc.tree.Branches[0] = doc.tree.Branches[0].Set(path, value)
+	err = doc.save()
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"file": cred.SOPSFile,
+		"key":  cred.Variable,
+	}).Debug("updated sops document")
+	return nil
+}
+
+//GetValue returns the value of the key of the credentials SOPS document,
+//if the document or key doesn't exist destination.ErrNotFound is returned
+func GetValue(cred *config.Credential) (string, error) {
+	doc, err := openDocument(cred)
+	if err != nil {
+		return "", err
+	}
+	value, ok := lookup(doc.tree.Branches[0], keyPath(cred))
+	if !ok {
+		return "", fmt.Errorf(
+			"key %s in sops file %s: %w",
+			cred.Variable,
+			cred.SOPSFile,
+			destination.ErrNotFound,
+		)
+	}
+	return fmt.Sprint(value), nil
+}
+
+//RemoveKey removes the key from the credentials SOPS document,
+//a document or key that doesn't exist is already removed
+func RemoveKey(cred *config.Credential) error {
+	doc, err := openDocument(cred)
+	if errors.Is(err, destination.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, ok := lookup(doc.tree.Branches[0], keyPath(cred)); !ok {
+		return nil
+	}
+	doc.tree.Branches[0] = remove(doc.tree.Branches[0], keyPath(cred))
+	return doc.save()
+}
+
+//CheckDocument makes sure the credentials SOPS
+//document exists and can be decrypted
+func CheckDocument(cred *config.Credential) error {
+	_, err := openDocument(cred)
+	return err
+}
@@ -0,0 +1,191 @@
+package sops
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/Spazzy757/credentials-rotator/pkg/test"
+	"github.com/stretchr/testify/require"
+)
+
+const plainDocument = `stringData:
+    OTHER_KEY: other value
+    TEST_VARIABLE: old value
+`
+
+func TestUpdateDocument(t *testing.T) {
+	recipient := test.SetupSOPSKey(t)
+	t.Run("key gets updated and other keys are kept", func(t *testing.T) {
+		assertions := require.New(t)
+		path := filepath.Join(t.TempDir(), "secrets.yaml")
+		test.WriteSOPSFile(t, recipient, path, plainDocument)
+		cred := config.Credential{
+			SOPSFile: path,
+			SOPSPath: []string{"stringData"},
+			Variable: "TEST_VARIABLE",
+		}
+
+		err := UpdateDocument(&cred, "ABCDBC")
+		assertions.NoError(err)
+
+		data, err := ioutil.ReadFile(path)
+		assertions.NoError(err)
+		assertions.NotContains(string(data), "ABCDBC")
+		assertions.NotContains(string(data), "other value")
+		value, err := GetValue(&cred)
+		assertions.NoError(err)
+		assertions.Equal("ABCDBC", value)
+		cred.Variable = "OTHER_KEY"
+		value, err = GetValue(&cred)
+		assertions.NoError(err)
+		assertions.Equal("other value", value)
+	})
+	t.Run("missing key gets added to json document", func(t *testing.T) {
+		assertions := require.New(t)
+		path := filepath.Join(t.TempDir(), "secrets.json")
+		test.WriteSOPSFile(t, recipient, path, `{"OTHER_KEY": "other value"}`)
+		cred := config.Credential{SOPSFile: path, Variable: "TEST_VARIABLE"}
+
+		err := UpdateDocument(&cred, "ABCDBC")
+		assertions.NoError(err)
+
+		value, err := GetValue(&cred)
+		assertions.NoError(err)
+		assertions.Equal("ABCDBC", value)
+	})
+	t.Run("file mode is kept", func(t *testing.T) {
+		assertions := require.New(t)
+		path := filepath.Join(t.TempDir(), "secrets.yaml")
+		test.WriteSOPSFile(t, recipient, path, plainDocument)
+		assertions.NoError(os.Chmod(path, 0640))
+		cred := config.Credential{SOPSFile: path, Variable: "TEST_VARIABLE"}
+
+		err := UpdateDocument(&cred, "ABCDBC")
+		assertions.NoError(err)
+
+		info, err := os.Stat(path)
+		assertions.NoError(err)
+		assertions.Equal(os.FileMode(0640), info.Mode().Perm())
+	})
+	t.Run("missing document returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		path := filepath.Join(t.TempDir(), "secrets.yaml")
+		cred := config.Credential{SOPSFile: path, Variable: "TEST_VARIABLE"}
+
+		err := UpdateDocument(&cred, "ABCDBC")
+		assertions.True(errors.Is(err, destination.ErrNotFound))
+	})
+	t.Run("unencrypted document returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		path := filepath.Join(t.TempDir(), "secrets.yaml")
+		assertions.NoError(ioutil.WriteFile(path, []byte(plainDocument), 0600))
+		cred := config.Credential{SOPSFile: path, Variable: "TEST_VARIABLE"}
+
+		err := UpdateDocument(&cred, "ABCDBC")
+		assertions.Error(err)
+		data, err := ioutil.ReadFile(path)
+		assertions.NoError(err)
+		assertions.Equal(plainDocument, string(data))
+	})
+}
+
+func TestGetValue(t *testing.T) {
+	recipient := test.SetupSOPSKey(t)
+	path := filepath.Join(t.TempDir(), "secrets.yaml")
+	test.WriteSOPSFile(t, recipient, path, plainDocument)
+	t.Run("value gets decrypted", func(t *testing.T) {
+		assertions := require.New(t)
+		cred := config.Credential{
+			SOPSFile: path,
+			SOPSPath: []string{"stringData"},
+			Variable: "TEST_VARIABLE",
+		}
+
+		value, err := GetValue(&cred)
+		assertions.NoError(err)
+		assertions.Equal("old value", value)
+	})
+	t.Run("missing key is not found", func(t *testing.T) {
+		assertions := require.New(t)
+		cred := config.Credential{
+			SOPSFile: path,
+			SOPSPath: []string{"stringData"},
+			Variable: "MISSING",
+		}
+
+		_, err := GetValue(&cred)
+		assertions.True(errors.Is(err, destination.ErrNotFound))
+	})
+	t.Run("path through a value is not found", func(t *testing.T) {
+		assertions := require.New(t)
+		cred := config.Credential{
+			SOPSFile: path,
+			SOPSPath: []string{"stringData", "OTHER_KEY"},
+			Variable: "TEST_VARIABLE",
+		}
+
+		_, err := GetValue(&cred)
+		assertions.True(errors.Is(err, destination.ErrNotFound))
+	})
+}
+
+func TestRemoveKey(t *testing.T) {
+	recipient := test.SetupSOPSKey(t)
+	t.Run("key gets removed and other keys are kept", func(t *testing.T) {
+		assertions := require.New(t)
+		path := filepath.Join(t.TempDir(), "secrets.yaml")
+		test.WriteSOPSFile(t, recipient, path, plainDocument)
+		cred := config.Credential{
+			SOPSFile: path,
+			SOPSPath: []string{"stringData"},
+			Variable: "TEST_VARIABLE",
+		}
+
+		err := RemoveKey(&cred)
+		assertions.NoError(err)
+
+		_, err = GetValue(&cred)
+		assertions.True(errors.Is(err, destination.ErrNotFound))
+		cred.Variable = "OTHER_KEY"
+		value, err := GetValue(&cred)
+		assertions.NoError(err)
+		assertions.Equal("other value", value)
+	})
+	t.Run("missing document is ignored", func(t *testing.T) {
+		assertions := require.New(t)
+		path := filepath.Join(t.TempDir(), "secrets.yaml")
+		cred := config.Credential{SOPSFile: path, Variable: "TEST_VARIABLE"}
+
+		err := RemoveKey(&cred)
+		assertions.NoError(err)
+	})
+}
+
+func TestCheckDocument(t *testing.T) {
+	recipient := test.SetupSOPSKey(t)
+	path := filepath.Join(t.TempDir(), "secrets.yaml")
+	test.WriteSOPSFile(t, recipient, path, plainDocument)
+	t.Run("document that can be decrypted passes", func(t *testing.T) {
+		assertions := require.New(t)
+		err := CheckDocument(&config.Credential{SOPSFile: path})
+		assertions.NoError(err)
+	})
+	t.Run("document encrypted for another key fails", func(t *testing.T) {
+		assertions := require.New(t)
+		other := filepath.Join(t.TempDir(), "other.yaml")
+		test.WriteSOPSFile(t, test.SetupSOPSKey(t), other, plainDocument)
+		// the key of the other document replaced the first key
+		err := CheckDocument(&config.Credential{SOPSFile: path})
+		assertions.Error(err)
+	})
+	t.Run("binary files are not supported", func(t *testing.T) {
+		assertions := require.New(t)
+		err := CheckDocument(&config.Credential{SOPSFile: "secrets.bin"})
+		assertions.Error(err)
+	})
+}
@@ -0,0 +1,121 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+)
+
+//Key is a credential issued by a Source
+type Key struct {
+	// ID used to reference the key when revoking it
+	ID string
+
+	// The secret that gets written to the destination
+	// only set when the key has just been issued
+	Value []byte
+
+	// Named parts of keys made up of more than one value
+	// e.g an access key ID and secret, they can be written
+	// to separate variables, only set when the key has just been issued
+	Fields map[string]string
+
+	// When the key became valid
+	CreatedAt time.Time
+
+	// Keys the source revoked to make room for the key e.g
+	// when there is a limit on the number of keys, only set
+	// when the key has just been issued
+	Revoked []string
+}
+
+//Source issues, lists and revokes credentials
+//e.g service account keys on Google Cloud
+type Source interface {
+	// Issue creates a new key
+	Issue(ctx context.Context, cred *config.Credential) (*Key, error)
+
+	// List returns the keys that currently exist
+	List(ctx context.Context, cred *config.Credential) ([]Key, error)
+
+	// Revoke deletes a key so it can no longer be used
+	Revoke(ctx context.Context, cred *config.Credential, keyID string) error
+}
+
+//Deactivator is implemented by sources that can disable a key
+//without deleting it, keys waiting for their grace period are
+//deactivated so they stop working but can still be restored
+type Deactivator interface {
+	Deactivate(ctx context.Context, cred *config.Credential, keyID string) error
+}
+
+//Limiter is implemented by sources that only allow a
+//limited number of keys to exist at the same time
+type Limiter interface {
+	KeyLimit() int
+}
+
+//Describer is implemented by sources that can describe
+//what they issues keys for, it is used when planning a run
+type Describer interface {
+	Describe(cred *config.Credential) string
+}
+
+//Describe returns the description of the source
+//falling back to its type name
+func Describe(sou Source, cred *config.Credential) string {
+	if describer, ok := sou.(Describer); ok {
+		return describer.Describe(cred)
+	}
+	return cred.Source
+}
+
+//Newest returns the most recently created key
+func Newest(keys []Key) (Key, bool) {
+	if len(keys) == 0 {
+		return Key{}, false
+	}
+	newest := keys[0]
+	for _, key := range keys[1:] {
+		if key.CreatedAt.After(newest.CreatedAt) {
+			newest = key
+		}
+	}
+	return newest, true
+}
+
+//Factory creates a Source using the clients on the configuration
+type Factory func(cfg *config.Config) (Source, error)
+
+var registry = map[string]Factory{}
+
+//Register makes a source available under a type name,
+//it is meant to be called from the init of the implementing package
+func Register(name string, factory Factory) {
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("source %q registered twice", name))
+	}
+	registry[name] = factory
+}
+
+//New creates the source registered under the type name
+func New(name string, cfg *config.Config) (Source, error) {
+	factory, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown source type %q", name)
+	}
+	return factory(cfg)
+}
+
+//Types returns the names of all registered sources
+func Types() []string {
+	names := []string{}
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,70 @@
+package source
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSource struct{}
+
+func (s *fakeSource) Issue(ctx context.Context, cred *config.Credential) (*Key, error) {
+	return &Key{ID: "key"}, nil
+}
+
+func (s *fakeSource) List(ctx context.Context, cred *config.Credential) ([]Key, error) {
+	return []Key{}, nil
+}
+
+func (s *fakeSource) Revoke(ctx context.Context, cred *config.Credential, keyID string) error {
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	Register("fake", func(cfg *config.Config) (Source, error) {
+		return &fakeSource{}, nil
+	})
+	t.Run("registered source is created", func(t *testing.T) {
+		assertions := require.New(t)
+		src, err := New("fake", &config.Config{})
+		assertions.NoError(err)
+		assertions.IsType(&fakeSource{}, src)
+		assertions.Contains(Types(), "fake")
+	})
+	t.Run("unknown source returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		_, err := New("unknown", &config.Config{})
+		assertions.Error(err)
+	})
+	t.Run("registering twice panics", func(t *testing.T) {
+		assertions := require.New(t)
+		assertions.Panics(func() {
+			Register("fake", func(cfg *config.Config) (Source, error) {
+				return &fakeSource{}, nil
+			})
+		})
+	})
+}
+
+func TestNewest(t *testing.T) {
+	t.Run("returns the most recently created key", func(t *testing.T) {
+		assertions := require.New(t)
+		now := time.Now()
+		keys := []Key{
+			Key{ID: "old", CreatedAt: now.Add(-time.Hour)},
+			Key{ID: "new", CreatedAt: now},
+			Key{ID: "older", CreatedAt: now.Add(-2 * time.Hour)},
+		}
+		newest, ok := Newest(keys)
+		assertions.True(ok)
+		assertions.Equal("new", newest.ID)
+	})
+	t.Run("no keys", func(t *testing.T) {
+		assertions := require.New(t)
+		_, ok := Newest([]Key{})
+		assertions.False(ok)
+	})
+}
@@ -0,0 +1,240 @@
+package state
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+//State is persisted between runs so that work
+//started in one run can be finished in a later one
+type State struct {
+	path string
+
+	// Keys that have been rotated out and will be
+	// deleted once their grace period has passed
+	PendingRevocations []PendingRevocation `yaml:"pending_revocations,omitempty"`
+
+	// Keys that were issued but never written to a
+	// destination and couldn't be revoked straight away
+	OrphanedKeys []OrphanedKey `yaml:"orphaned_keys,omitempty"`
+
+	// Credentials whose newest key was only written
+	// to some of their destinations
+	IncompleteRotations []IncompleteRotation `yaml:"incomplete_rotations,omitempty"`
+
+	// The keys every destination of a credential was last written with
+	CurrentKeys []CurrentKey `yaml:"current_keys,omitempty"`
+}
+
+//CurrentKey is the key a credential was last rotated to
+type CurrentKey struct {
+	// The credential that was rotated, identified by the
+	// source its keys are issued from e.g the service account
+	Credential string `yaml:"credential"`
+
+	// The ID of the key written to every destination
+	KeyID string `yaml:"key_id"`
+}
+
+//PendingRevocation is a key waiting for its grace period to pass
+type PendingRevocation struct {
+	// The type of source that issued the key e.g google
+	Source string `yaml:"source"`
+
+	// Where the key was issued, kept so the key can still be
+	// revoked once its credential is no longer in the configuration
+	GoogleProjectID    string `yaml:"google_project_id,omitempty"`
+	ServiceAccount     string `yaml:"service_account,omitempty"`
+	AWSUser            string `yaml:"aws_user,omitempty"`
+	AzureApplicationID string `yaml:"azure_application_id,omitempty"`
+
+	// The ID of the key to revoke
+	KeyID string `yaml:"key_id"`
+
+	// The time after which the key can be deleted
+	RevokeAt time.Time `yaml:"revoke_at"`
+}
+
+//OrphanedKey is an unused key waiting to be cleaned up
+type OrphanedKey struct {
+	// The type of source that issued the key e.g google
+	Source string `yaml:"source"`
+
+	// The ID of the key to revoke
+	KeyID string `yaml:"key_id"`
+
+	// The credential the key was issued for
+	Credential string `yaml:"credential"`
+}
+
+//IncompleteRotation is a credential that needs to be rotated
+//again because not every destination got the new key
+type IncompleteRotation struct {
+	// The credential that was rotated, identified by the
+	// source its keys are issued from e.g the service account
+	Credential string `yaml:"credential"`
+
+	// The ID of the key that was issued
+	KeyID string `yaml:"key_id"`
+
+	// The destinations that failed to be written
+	FailedDestinations []string `yaml:"failed_destinations"`
+}
+
+//Load reads the state from a file, a missing
+//file is treated as an empty state
+func Load(path string) (*State, error) {
+	s := &State{path: path}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed loading state: %v", err)
+	}
+	err = yaml.Unmarshal(data, s)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing state: %v", err)
+	}
+	return s, nil
+}
+
+//Save writes the state back to the file it was loaded from
+func (s *State) Save() error {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path, data, 0600)
+}
+
+//PendingRevocation returns the pending revocation for a key if there is one
+func (s *State) PendingRevocation(source, keyID string) (PendingRevocation, bool) {
+	for _, p := range s.PendingRevocations {
+		if p.Source == source && p.KeyID == keyID {
+			return p, true
+		}
+	}
+	return PendingRevocation{}, false
+}
+
+//AddPendingRevocation marks a key for revocation,
+//keys that are already pending keep their original time
+func (s *State) AddPendingRevocation(p PendingRevocation) {
+	if _, pending := s.PendingRevocation(p.Source, p.KeyID); pending {
+		return
+	}
+	s.PendingRevocations = append(s.PendingRevocations, p)
+}
+
+//RemovePendingRevocation removes a key once it has been revoked
+func (s *State) RemovePendingRevocation(source, keyID string) {
+	pending := s.PendingRevocations[:0]
+	for _, p := range s.PendingRevocations {
+		if p.Source != source || p.KeyID != keyID {
+			pending = append(pending, p)
+		}
+	}
+	s.PendingRevocations = pending
+}
+
+//DueRevocations returns the keys whose grace period has passed
+func (s *State) DueRevocations(now time.Time) []PendingRevocation {
+	due := []PendingRevocation{}
+	for _, p := range s.PendingRevocations {
+		if p.IsDue(now) {
+			due = append(due, p)
+		}
+	}
+	return due
+}
+
+//IsDue checks if the grace period of the key has passed
+func (p PendingRevocation) IsDue(now time.Time) bool {
+	return !now.Before(p.RevokeAt)
+}
+
+//IsOrphanedKey checks if a key was never written to a destination
+func (s *State) IsOrphanedKey(source, keyID string) bool {
+	for _, o := range s.OrphanedKeys {
+		if o.Source == source && o.KeyID == keyID {
+			return true
+		}
+	}
+	return false
+}
+
+//AddOrphanedKey saves a key that needs to be cleaned up later
+func (s *State) AddOrphanedKey(o OrphanedKey) {
+	if s.IsOrphanedKey(o.Source, o.KeyID) {
+		return
+	}
+	s.OrphanedKeys = append(s.OrphanedKeys, o)
+}
+
+//RemoveOrphanedKey removes a key once it has been cleaned up
+func (s *State) RemoveOrphanedKey(source, keyID string) {
+	orphaned := s.OrphanedKeys[:0]
+	for _, o := range s.OrphanedKeys {
+		if o.Source != source || o.KeyID != keyID {
+			orphaned = append(orphaned, o)
+		}
+	}
+	s.OrphanedKeys = orphaned
+}
+
+//IncompleteRotation returns the incomplete rotation
+//of a credential if there is one
+func (s *State) IncompleteRotation(credential string) (IncompleteRotation, bool) {
+	for _, r := range s.IncompleteRotations {
+		if r.Credential == credential {
+			return r, true
+		}
+	}
+	return IncompleteRotation{}, false
+}
+
+//SetIncompleteRotation saves the incomplete rotation of a
+//credential, replacing an earlier one for the same credential
+func (s *State) SetIncompleteRotation(r IncompleteRotation) {
+	s.RemoveIncompleteRotation(r.Credential)
+	s.IncompleteRotations = append(s.IncompleteRotations, r)
+}
+
+//RemoveIncompleteRotation removes a credential once
+//every destination has its newest key
+func (s *State) RemoveIncompleteRotation(credential string) {
+	incomplete := s.IncompleteRotations[:0]
+	for _, r := range s.IncompleteRotations {
+		if r.Credential != credential {
+			incomplete = append(incomplete, r)
+		}
+	}
+	s.IncompleteRotations = incomplete
+}
+
+//CurrentKey returns the key a credential was last rotated to
+func (s *State) CurrentKey(credential string) (CurrentKey, bool) {
+	for _, c := range s.CurrentKeys {
+		if c.Credential == credential {
+			return c, true
+		}
+	}
+	return CurrentKey{}, false
+}
+
+//SetCurrentKey saves the key a credential was rotated to,
+//replacing the earlier key of the same credential
+func (s *State) SetCurrentKey(c CurrentKey) {
+	current := s.CurrentKeys[:0]
+	for _, existing := range s.CurrentKeys {
+		if existing.Credential != c.Credential {
+			current = append(current, existing)
+		}
+	}
+	s.CurrentKeys = append(current, c)
+}
@@ -0,0 +1,150 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("missing file returns empty state", func(t *testing.T) {
+		assertions := require.New(t)
+		s, err := Load(path.Join(os.TempDir(), "missing-state.yaml"))
+		assertions.NoError(err)
+		assertions.Len(s.PendingRevocations, 0)
+	})
+	t.Run("saved state is loaded", func(t *testing.T) {
+		assertions := require.New(t)
+		statePath := path.Join(os.TempDir(), "rotator-state.yaml")
+		defer os.RemoveAll(statePath)
+		revokeAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		s, err := Load(statePath)
+		assertions.NoError(err)
+		s.AddPendingRevocation(PendingRevocation{
+			Source:   "google",
+			KeyID:    "key-1",
+			RevokeAt: revokeAt,
+		})
+		assertions.NoError(s.Save())
+
+		loaded, err := Load(statePath)
+		assertions.NoError(err)
+		assertions.Len(loaded.PendingRevocations, 1)
+		assertions.Equal("key-1", loaded.PendingRevocations[0].KeyID)
+		assertions.True(revokeAt.Equal(loaded.PendingRevocations[0].RevokeAt))
+	})
+	t.Run("invalid file returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		statePath := path.Join(os.TempDir(), "rotator-state.yaml")
+		defer os.RemoveAll(statePath)
+		ioutil.WriteFile(statePath, []byte("`^88(0"), 0600)
+		_, err := Load(statePath)
+		assertions.Error(err)
+	})
+}
+
+func TestPendingRevocations(t *testing.T) {
+	t.Run("pending keys keep their original time", func(t *testing.T) {
+		assertions := require.New(t)
+		first := time.Now()
+		s := State{}
+		s.AddPendingRevocation(PendingRevocation{Source: "google", KeyID: "key-1", RevokeAt: first})
+		s.AddPendingRevocation(PendingRevocation{Source: "google", KeyID: "key-1", RevokeAt: first.Add(time.Hour)})
+		assertions.Len(s.PendingRevocations, 1)
+		assertions.Equal(first, s.PendingRevocations[0].RevokeAt)
+	})
+	t.Run("keys are pending per source", func(t *testing.T) {
+		assertions := require.New(t)
+		s := State{}
+		s.AddPendingRevocation(PendingRevocation{Source: "google", KeyID: "key-1"})
+		_, pending := s.PendingRevocation("google", "key-1")
+		assertions.True(pending)
+		_, pending = s.PendingRevocation("other", "key-1")
+		assertions.False(pending)
+	})
+	t.Run("only keys past their grace period are due", func(t *testing.T) {
+		assertions := require.New(t)
+		now := time.Now()
+		due := PendingRevocation{KeyID: "due", RevokeAt: now.Add(-time.Minute)}
+		waiting := PendingRevocation{KeyID: "waiting", RevokeAt: now.Add(time.Hour)}
+		assertions.True(due.IsDue(now))
+		assertions.False(waiting.IsDue(now))
+		s := State{PendingRevocations: []PendingRevocation{due, waiting}}
+		assertions.Equal([]PendingRevocation{due}, s.DueRevocations(now))
+	})
+	t.Run("revoked keys are removed", func(t *testing.T) {
+		assertions := require.New(t)
+		s := State{}
+		s.AddPendingRevocation(PendingRevocation{Source: "google", KeyID: "key-1"})
+		s.AddPendingRevocation(PendingRevocation{Source: "google", KeyID: "key-2"})
+		s.RemovePendingRevocation("google", "key-1")
+		_, pending := s.PendingRevocation("google", "key-1")
+		assertions.False(pending)
+		_, pending = s.PendingRevocation("google", "key-2")
+		assertions.True(pending)
+	})
+}
+
+func TestOrphanedKeys(t *testing.T) {
+	t.Run("orphaned keys are tracked per source", func(t *testing.T) {
+		assertions := require.New(t)
+		s := State{}
+		s.AddOrphanedKey(OrphanedKey{Source: "google", KeyID: "key-1"})
+		s.AddOrphanedKey(OrphanedKey{Source: "google", KeyID: "key-1"})
+		assertions.Len(s.OrphanedKeys, 1)
+		assertions.True(s.IsOrphanedKey("google", "key-1"))
+		assertions.False(s.IsOrphanedKey("other", "key-1"))
+	})
+	t.Run("cleaned up keys are removed", func(t *testing.T) {
+		assertions := require.New(t)
+		s := State{}
+		s.AddOrphanedKey(OrphanedKey{Source: "google", KeyID: "key-1"})
+		s.AddOrphanedKey(OrphanedKey{Source: "google", KeyID: "key-2"})
+		s.RemoveOrphanedKey("google", "key-1")
+		assertions.False(s.IsOrphanedKey("google", "key-1"))
+		assertions.True(s.IsOrphanedKey("google", "key-2"))
+	})
+}
+
+func TestIncompleteRotations(t *testing.T) {
+	t.Run("later rotations replace earlier ones", func(t *testing.T) {
+		assertions := require.New(t)
+		s := State{}
+		s.SetIncompleteRotation(IncompleteRotation{Credential: "shared", KeyID: "key-1"})
+		s.SetIncompleteRotation(IncompleteRotation{Credential: "shared", KeyID: "key-2"})
+		assertions.Len(s.IncompleteRotations, 1)
+		r, ok := s.IncompleteRotation("shared")
+		assertions.True(ok)
+		assertions.Equal("key-2", r.KeyID)
+		_, ok = s.IncompleteRotation("other")
+		assertions.False(ok)
+	})
+	t.Run("completed rotations are removed", func(t *testing.T) {
+		assertions := require.New(t)
+		s := State{}
+		s.SetIncompleteRotation(IncompleteRotation{Credential: "shared", KeyID: "key-1"})
+		s.RemoveIncompleteRotation("shared")
+		_, ok := s.IncompleteRotation("shared")
+		assertions.False(ok)
+	})
+}
+
+func TestCurrentKeys(t *testing.T) {
+	t.Run("later keys replace earlier ones", func(t *testing.T) {
+		assertions := require.New(t)
+		s := State{}
+		s.SetCurrentKey(CurrentKey{Credential: "shared", KeyID: "key-1"})
+		s.SetCurrentKey(CurrentKey{Credential: "other", KeyID: "key-2"})
+		s.SetCurrentKey(CurrentKey{Credential: "shared", KeyID: "key-3"})
+		assertions.Len(s.CurrentKeys, 2)
+		c, ok := s.CurrentKey("shared")
+		assertions.True(ok)
+		assertions.Equal("key-3", c.KeyID)
+		_, ok = s.CurrentKey("missing")
+		assertions.False(ok)
+	})
+}
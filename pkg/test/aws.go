@@ -0,0 +1,165 @@
+package test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+)
+
+//MockAccessKey is an access key held by the MockAWSIAMServer
+type MockAccessKey struct {
+	ID         string
+	Secret     string
+	Status     string
+	CreateDate time.Time
+}
+
+//MockAWSIAMServer is a stand-in for the AWS IAM query API
+//that keeps the access keys of a single user in memory
+type MockAWSIAMServer struct {
+	mu sync.Mutex
+
+	// The access keys of the user
+	Keys []MockAccessKey
+
+	// The actions that were called e.g CreateAccessKey
+	Actions []string
+
+	// If set, all calls fail with this error code
+	ErrCode string
+
+	created int
+}
+
+type mockAccessKeyMember struct {
+	XMLName         xml.Name
+	UserName        string `xml:"UserName"`
+	AccessKeyID     string `xml:"AccessKeyId"`
+	SecretAccessKey string `xml:"SecretAccessKey,omitempty"`
+	Status          string `xml:"Status"`
+	CreateDate      string `xml:"CreateDate"`
+}
+
+//marshal returns the key as an element with the name
+func (k MockAccessKey) marshal(name string, withSecret bool) string {
+	m := mockAccessKeyMember{
+		XMLName:     xml.Name{Local: name},
+		UserName:    "user",
+		AccessKeyID: k.ID,
+		Status:      k.Status,
+		CreateDate:  k.CreateDate.UTC().Format(time.RFC3339),
+	}
+	if withSecret {
+		m.SecretAccessKey = k.Secret
+	}
+	body, _ := xml.Marshal(m)
+	return string(body)
+}
+
+func (s *MockAWSIAMServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := r.ParseForm()
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "MalformedInput")
+		return
+	}
+	action := r.Form.Get("Action")
+	s.Actions = append(s.Actions, action)
+	if s.ErrCode != "" {
+		s.writeError(w, http.StatusBadRequest, s.ErrCode)
+		return
+	}
+	switch action {
+	case "ListAccessKeys":
+		members := ""
+		for _, key := range s.Keys {
+			members += key.marshal("member", false)
+		}
+		s.write(w, action, fmt.Sprintf(
+			"<AccessKeyMetadata>%s</AccessKeyMetadata><IsTruncated>false</IsTruncated>",
+			members,
+		))
+	case "CreateAccessKey":
+		if len(s.Keys) >= 2 {
+			s.writeError(w, http.StatusConflict, "LimitExceeded")
+			return
+		}
+		s.created++
+		key := MockAccessKey{
+			ID:         fmt.Sprintf("AKIANEW%012d", s.created),
+			Secret:     fmt.Sprintf("secret-%d", s.created),
+			Status:     iam.StatusTypeActive,
+			CreateDate: time.Now(),
+		}
+		s.Keys = append(s.Keys, key)
+		s.write(w, action, key.marshal("AccessKey", true))
+	case "UpdateAccessKey", "DeleteAccessKey":
+		keyID := r.Form.Get("AccessKeyId")
+		for i, key := range s.Keys {
+			if key.ID != keyID {
+				continue
+			}
+			if action == "DeleteAccessKey" {
+				s.Keys = append(s.Keys[:i], s.Keys[i+1:]...)
+			} else {
+				s.Keys[i].Status = r.Form.Get("Status")
+			}
+			s.write(w, action, "")
+			return
+		}
+		s.writeError(w, http.StatusNotFound, "NoSuchEntity")
+	default:
+		s.writeError(w, http.StatusBadRequest, "InvalidAction")
+	}
+}
+
+//write responds with the result of an action in the IAM query API format
+func (s *MockAWSIAMServer) write(w http.ResponseWriter, action string, result string) {
+	fmt.Fprintf(w, `<%sResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/">`, action)
+	if result != "" {
+		// the result element is named after the action
+		fmt.Fprintf(w, "<%sResult>%s</%sResult>", action, result, action)
+	}
+	fmt.Fprintf(w, "<ResponseMetadata><RequestId>test</RequestId></ResponseMetadata>")
+	fmt.Fprintf(w, "</%sResponse>", action)
+}
+
+//writeError responds with an error in the IAM query API format
+func (s *MockAWSIAMServer) writeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(
+		w,
+		"<ErrorResponse><Error><Type>Sender</Type><Code>%s</Code>"+
+			"<Message>%s</Message></Error><RequestId>test</RequestId></ErrorResponse>",
+		code,
+		code,
+	)
+}
+
+//SetupAWSIAMTestServer starts a MockAWSIAMServer and returns an IAM client using it
+func SetupAWSIAMTestServer(t *testing.T) (*MockAWSIAMServer, *httptest.Server, iamiface.IAMAPI) {
+	mock := &MockAWSIAMServer{}
+	server := httptest.NewServer(mock)
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("test", "test", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	if err != nil {
+		server.Close()
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return mock, server, iam.New(sess)
+}
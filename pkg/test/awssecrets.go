@@ -0,0 +1,331 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+//writeAWSJSON responds in the AWS JSON protocol format
+func writeAWSJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	json.NewEncoder(w).Encode(body)
+}
+
+//writeAWSJSONError responds with an error in the AWS JSON protocol format
+func writeAWSJSONError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{
+		"__type":  code,
+		"message": code,
+	})
+}
+
+//awsTestSession returns a session for a mock server
+func awsTestSession(t *testing.T, server *httptest.Server) *session.Session {
+	sess, err := session.NewSession(&aws.Config{
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("test", "test", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	if err != nil {
+		server.Close()
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return sess
+}
+
+//MockSecretVersion is a version of a MockSecret
+type MockSecretVersion struct {
+	ID          string
+	Value       string
+	Stages      []string
+	CreatedDate time.Time
+}
+
+//hasStage checks if the version has the staging label
+func (v *MockSecretVersion) hasStage(stage string) bool {
+	for _, s := range v.Stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+//removeStage removes the staging label from the version
+func (v *MockSecretVersion) removeStage(stage string) {
+	stages := []string{}
+	for _, s := range v.Stages {
+		if s != stage {
+			stages = append(stages, s)
+		}
+	}
+	v.Stages = stages
+}
+
+//MockSecret is a secret held by the MockSecretsManagerServer
+type MockSecret struct {
+	KMSKeyID string
+	Versions []*MockSecretVersion
+}
+
+//stage returns the version with the staging label
+func (s *MockSecret) stage(stage string) *MockSecretVersion {
+	for _, version := range s.Versions {
+		if version.hasStage(stage) {
+			return version
+		}
+	}
+	return nil
+}
+
+//put adds a new current version, the current
+//version becomes the previous version
+func (s *MockSecret) put(id string, value string) *MockSecretVersion {
+	if previous := s.stage("AWSPREVIOUS"); previous != nil {
+		previous.removeStage("AWSPREVIOUS")
+	}
+	if current := s.stage("AWSCURRENT"); current != nil {
+		current.removeStage("AWSCURRENT")
+		current.Stages = append(current.Stages, "AWSPREVIOUS")
+	}
+	version := &MockSecretVersion{
+		ID:          id,
+		Value:       value,
+		Stages:      []string{"AWSCURRENT"},
+		CreatedDate: time.Now(),
+	}
+	s.Versions = append(s.Versions, version)
+	return version
+}
+
+//MockSecretsManagerServer is a stand-in for the AWS Secrets
+//Manager JSON API that keeps the secrets in memory
+type MockSecretsManagerServer struct {
+	mu sync.Mutex
+
+	// The secrets by name
+	Secrets map[string]*MockSecret
+
+	// The actions that were called e.g PutSecretValue
+	Actions []string
+
+	created int
+}
+
+func (s *MockSecretsManagerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "secretsmanager.")
+	s.Actions = append(s.Actions, action)
+	req := struct {
+		Name                string
+		SecretId            string
+		SecretString        string
+		KmsKeyId            string
+		ClientRequestToken  string
+		VersionStage        string
+		RemoveFromVersionId string
+	}{}
+	json.NewDecoder(r.Body).Decode(&req)
+	if action == "CreateSecret" {
+		if _, exists := s.Secrets[req.Name]; exists {
+			writeAWSJSONError(w, "ResourceExistsException")
+			return
+		}
+		secret := &MockSecret{KMSKeyID: req.KmsKeyId}
+		version := secret.put(s.versionID(req.ClientRequestToken), req.SecretString)
+		s.Secrets[req.Name] = secret
+		writeAWSJSON(w, map[string]string{"Name": req.Name, "VersionId": version.ID})
+		return
+	}
+	secret, exists := s.Secrets[req.SecretId]
+	if !exists {
+		writeAWSJSONError(w, "ResourceNotFoundException")
+		return
+	}
+	switch action {
+	case "DescribeSecret":
+		stages := map[string][]string{}
+		for _, version := range secret.Versions {
+			if len(version.Stages) > 0 {
+				stages[version.ID] = version.Stages
+			}
+		}
+		writeAWSJSON(w, map[string]interface{}{
+			"Name":               req.SecretId,
+			"KmsKeyId":           secret.KMSKeyID,
+			"VersionIdsToStages": stages,
+		})
+	case "PutSecretValue", "UpdateSecret":
+		if req.KmsKeyId != "" {
+			secret.KMSKeyID = req.KmsKeyId
+		}
+		version := secret.put(s.versionID(req.ClientRequestToken), req.SecretString)
+		writeAWSJSON(w, map[string]interface{}{
+			"Name":          req.SecretId,
+			"VersionId":     version.ID,
+			"VersionStages": version.Stages,
+		})
+	case "GetSecretValue":
+		version := secret.stage("AWSCURRENT")
+		writeAWSJSON(w, map[string]interface{}{
+			"Name":          req.SecretId,
+			"SecretString":  version.Value,
+			"VersionId":     version.ID,
+			"VersionStages": version.Stages,
+		})
+	case "ListSecretVersionIds":
+		versions := []map[string]interface{}{}
+		for _, version := range secret.Versions {
+			if len(version.Stages) == 0 {
+				continue
+			}
+			versions = append(versions, map[string]interface{}{
+				"VersionId":     version.ID,
+				"VersionStages": version.Stages,
+				"CreatedDate":   float64(version.CreatedDate.UnixNano()) / float64(time.Second),
+			})
+		}
+		writeAWSJSON(w, map[string]interface{}{"Name": req.SecretId, "Versions": versions})
+	case "UpdateSecretVersionStage":
+		for _, version := range secret.Versions {
+			if version.ID == req.RemoveFromVersionId && version.hasStage(req.VersionStage) {
+				version.removeStage(req.VersionStage)
+				writeAWSJSON(w, map[string]string{"Name": req.SecretId})
+				return
+			}
+		}
+		writeAWSJSONError(w, "InvalidParameterException")
+	case "DeleteSecret":
+		delete(s.Secrets, req.SecretId)
+		writeAWSJSON(w, map[string]string{"Name": req.SecretId})
+	default:
+		writeAWSJSONError(w, "InvalidAction")
+	}
+}
+
+//versionID returns the client request token that
+//is used as the version ID or generates one
+func (s *MockSecretsManagerServer) versionID(token string) string {
+	if token != "" {
+		return token
+	}
+	s.created++
+	return fmt.Sprintf("00000000-0000-0000-0000-%012d", s.created)
+}
+
+//SetupSecretsManagerTestServer starts a MockSecretsManagerServer
+//and returns a Secrets Manager client using it
+func SetupSecretsManagerTestServer(
+	t *testing.T,
+) (*MockSecretsManagerServer, *httptest.Server, secretsmanageriface.SecretsManagerAPI) {
+	mock := &MockSecretsManagerServer{Secrets: map[string]*MockSecret{}}
+	server := httptest.NewServer(mock)
+	return mock, server, secretsmanager.New(awsTestSession(t, server))
+}
+
+//MockParameter is a parameter held by the MockSSMServer
+type MockParameter struct {
+	Type     string
+	KMSKeyID string
+
+	// Every value of the parameter, the first version is 1
+	Values []string
+}
+
+//MockSSMServer is a stand-in for the AWS SSM JSON API that
+//keeps Parameter Store parameters in memory
+type MockSSMServer struct {
+	mu sync.Mutex
+
+	// The parameters by name
+	Parameters map[string]*MockParameter
+
+	// The actions that were called e.g PutParameter
+	Actions []string
+}
+
+func (s *MockSSMServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonSSM.")
+	s.Actions = append(s.Actions, action)
+	req := struct {
+		Name           string
+		Value          string
+		Type           string
+		KeyId          string
+		Overwrite      bool
+		WithDecryption bool
+	}{}
+	json.NewDecoder(r.Body).Decode(&req)
+	parameter, exists := s.Parameters[req.Name]
+	switch action {
+	case "PutParameter":
+		if exists && !req.Overwrite {
+			writeAWSJSONError(w, "ParameterAlreadyExists")
+			return
+		}
+		if !exists {
+			parameter = &MockParameter{}
+			s.Parameters[req.Name] = parameter
+		}
+		parameter.Type = req.Type
+		parameter.KMSKeyID = req.KeyId
+		parameter.Values = append(parameter.Values, req.Value)
+		writeAWSJSON(w, map[string]interface{}{
+			"Version": len(parameter.Values),
+			"Tier":    "Standard",
+		})
+	case "GetParameter":
+		if !exists {
+			writeAWSJSONError(w, "ParameterNotFound")
+			return
+		}
+		value := parameter.Values[len(parameter.Values)-1]
+		if parameter.Type == "SecureString" && !req.WithDecryption {
+			value = "encrypted"
+		}
+		writeAWSJSON(w, map[string]interface{}{
+			"Parameter": map[string]interface{}{
+				"Name":    req.Name,
+				"Type":    parameter.Type,
+				"Value":   value,
+				"Version": len(parameter.Values),
+			},
+		})
+	case "DeleteParameter":
+		if !exists {
+			writeAWSJSONError(w, "ParameterNotFound")
+			return
+		}
+		delete(s.Parameters, req.Name)
+		writeAWSJSON(w, map[string]string{})
+	default:
+		writeAWSJSONError(w, "InvalidAction")
+	}
+}
+
+//SetupSSMTestServer starts a MockSSMServer and returns an SSM client using it
+func SetupSSMTestServer(t *testing.T) (*MockSSMServer, *httptest.Server, ssmiface.SSMAPI) {
+	mock := &MockSSMServer{Parameters: map[string]*MockParameter{}}
+	server := httptest.NewServer(mock)
+	return mock, server, ssm.New(awsTestSession(t, server))
+}
@@ -0,0 +1,129 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+//MockPassword is a client secret held by the MockAzureServer
+type MockPassword struct {
+	KeyID         string    `json:"keyId"`
+	DisplayName   string    `json:"displayName"`
+	SecretText    string    `json:"secretText,omitempty"`
+	StartDateTime time.Time `json:"startDateTime"`
+	EndDateTime   time.Time `json:"endDateTime"`
+}
+
+//MockAzureServer is a stand-in for the Azure AD token endpoint and
+//Microsoft Graph that keeps the client secrets of a single application
+type MockAzureServer struct {
+	mu sync.Mutex
+
+	// The application (client) ID of the application
+	AppID string
+
+	// The client secrets of the application
+	Passwords []MockPassword
+
+	// The number of tokens that were issued
+	Tokens int
+
+	// If set, all graph calls fail with this status
+	ErrStatus int
+
+	created int
+}
+
+func (s *MockAzureServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.URL.Path == "/token" {
+		if r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.Tokens++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token": "graph-token", "token_type": "Bearer", "expires_in": 3600}`)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer graph-token" {
+		s.writeError(w, http.StatusUnauthorized, "InvalidAuthenticationToken")
+		return
+	}
+	if s.ErrStatus != 0 {
+		s.writeError(w, s.ErrStatus, "Request_BadRequest")
+		return
+	}
+	application := fmt.Sprintf("/v1.0/applications(appId='%s')", s.AppID)
+	if !strings.HasPrefix(r.URL.Path, application) {
+		s.writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	switch strings.TrimPrefix(r.URL.Path, application) {
+	case "":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"passwordCredentials": s.Passwords,
+		})
+	case "/addPassword":
+		body := struct {
+			PasswordCredential MockPassword `json:"passwordCredential"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		s.created++
+		password := MockPassword{
+			KeyID:         fmt.Sprintf("key-%d", s.created),
+			DisplayName:   body.PasswordCredential.DisplayName,
+			StartDateTime: time.Now().UTC(),
+			EndDateTime:   body.PasswordCredential.EndDateTime,
+		}
+		s.Passwords = append(s.Passwords, password)
+		password.SecretText = fmt.Sprintf("secret-%d", s.created)
+		json.NewEncoder(w).Encode(password)
+	case "/removePassword":
+		body := struct {
+			KeyID string `json:"keyId"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		for i, password := range s.Passwords {
+			if password.KeyID == body.KeyID {
+				s.Passwords = append(s.Passwords[:i], s.Passwords[i+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		s.writeError(w, http.StatusBadRequest, "Request_BadRequest")
+	default:
+		s.writeError(w, http.StatusNotFound, "Request_ResourceNotFound")
+	}
+}
+
+//writeError responds with an error in the Microsoft Graph format
+func (s *MockAzureServer) writeError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]string{"code": code, "message": code},
+	})
+}
+
+//SetupAzureTestServer starts a MockAzureServer and returns a client
+//that authenticates with it, the server is also the Graph base URL
+func SetupAzureTestServer(t *testing.T) (*MockAzureServer, *httptest.Server, *http.Client) {
+	mock := &MockAzureServer{AppID: "app-id"}
+	server := httptest.NewServer(mock)
+	credentials := clientcredentials.Config{
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		TokenURL:     server.URL + "/token",
+	}
+	return mock, server, credentials.Client(context.Background())
+}
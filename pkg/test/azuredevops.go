@@ -0,0 +1,207 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/httpapi"
+)
+
+//MockGroupVariable is a variable of a MockVariableGroup
+type MockGroupVariable struct {
+	Value      string
+	IsSecret   bool
+	IsReadOnly bool
+}
+
+//MockVariableGroup is a variable group held by the MockAzureDevOpsServer
+type MockVariableGroup struct {
+	ID          int
+	Name        string
+	Description string
+
+	// The type of the group, defaults to Vsts
+	Type string
+
+	Variables map[string]MockGroupVariable
+}
+
+//MockAzureDevOpsServer is a stand-in for the Azure DevOps
+//variable groups API of a single organization and project
+type MockAzureDevOpsServer struct {
+	mu sync.Mutex
+
+	// The organization and project of the variable groups
+	Organization string
+	Project      string
+
+	// The personal access token requests need to have
+	Token string
+
+	// The variable groups of the project
+	Groups []*MockVariableGroup
+
+	// The number of variable groups that were updated
+	Updates int
+}
+
+func (s *MockAzureDevOpsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, token, _ := r.BasicAuth(); token != s.Token {
+		// Azure DevOps shows the sign in page
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusNonAuthoritativeInfo)
+		fmt.Fprint(w, "<html>Sign In</html>")
+		return
+	}
+	if r.URL.Query().Get("api-version") == "" {
+		s.writeError(w, http.StatusBadRequest, "No api-version was supplied")
+		return
+	}
+	list := fmt.Sprintf("/%s/%s/_apis/distributedtask/variablegroups", s.Organization, s.Project)
+	update := fmt.Sprintf("/%s/_apis/distributedtask/variablegroups/", s.Organization)
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.URL.Path == list && r.Method == http.MethodGet:
+		groups := []interface{}{}
+		for _, group := range s.Groups {
+			if strings.EqualFold(group.Name, r.URL.Query().Get("groupName")) {
+				groups = append(groups, s.marshal(group))
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"count": len(groups),
+			"value": groups,
+		})
+	case strings.HasPrefix(r.URL.Path, update) && r.Method == http.MethodPut:
+		id, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, update))
+		group := s.group(id)
+		if group == nil {
+			s.writeError(w, http.StatusNotFound, "Variable group not found")
+			return
+		}
+		s.put(w, r, group)
+	default:
+		s.writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+//put replaces the variables of the group with the variables of the
+//request, secret variables without a value keep their value
+func (s *MockAzureDevOpsServer) put(
+	w http.ResponseWriter,
+	r *http.Request,
+	group *MockVariableGroup,
+) {
+	body := struct {
+		Name                           string `json:"name"`
+		Description                    string `json:"description"`
+		VariableGroupProjectReferences []struct {
+			ProjectReference struct {
+				Name string `json:"name"`
+			} `json:"projectReference"`
+		} `json:"variableGroupProjectReferences"`
+		Variables map[string]struct {
+			Value      *string `json:"value"`
+			IsSecret   bool    `json:"isSecret"`
+			IsReadOnly bool    `json:"isReadOnly"`
+		} `json:"variables"`
+	}{}
+	json.NewDecoder(r.Body).Decode(&body)
+	if len(body.VariableGroupProjectReferences) == 0 {
+		s.writeError(w, http.StatusBadRequest, "VariableGroupProjectReferences is required")
+		return
+	}
+	if len(body.Variables) == 0 {
+		s.writeError(w, http.StatusBadRequest, "Variable group must have at least one variable")
+		return
+	}
+	variables := map[string]MockGroupVariable{}
+	for name, variable := range body.Variables {
+		updated := MockGroupVariable{IsSecret: variable.IsSecret, IsReadOnly: variable.IsReadOnly}
+		if variable.Value != nil {
+			updated.Value = *variable.Value
+		} else if variable.IsSecret {
+			updated.Value = group.Variables[name].Value
+		}
+		variables[name] = updated
+	}
+	group.Name = body.Name
+	group.Description = body.Description
+	group.Variables = variables
+	s.Updates++
+	json.NewEncoder(w).Encode(s.marshal(group))
+}
+
+//group returns the variable group with the ID
+func (s *MockAzureDevOpsServer) group(id int) *MockVariableGroup {
+	for _, group := range s.Groups {
+		if group.ID == id {
+			return group
+		}
+	}
+	return nil
+}
+
+//marshal returns the variable group the way Azure DevOps
+//returns it, without the values of secret variables
+func (s *MockAzureDevOpsServer) marshal(group *MockVariableGroup) map[string]interface{} {
+	variables := map[string]interface{}{}
+	for name, variable := range group.Variables {
+		marshaled := map[string]interface{}{"value": variable.Value}
+		if variable.IsSecret {
+			marshaled = map[string]interface{}{"value": nil, "isSecret": true}
+		}
+		if variable.IsReadOnly {
+			marshaled["isReadOnly"] = true
+		}
+		variables[name] = marshaled
+	}
+	groupType := group.Type
+	if groupType == "" {
+		groupType = "Vsts"
+	}
+	return map[string]interface{}{
+		"id":          group.ID,
+		"name":        group.Name,
+		"description": group.Description,
+		"type":        groupType,
+		"variables":   variables,
+		"variableGroupProjectReferences": []interface{}{
+			map[string]interface{}{
+				"name": group.Name,
+				"projectReference": map[string]interface{}{
+					"id":   "project-id",
+					"name": s.Project,
+				},
+			},
+		},
+	}
+}
+
+//writeError responds with an error in the Azure DevOps format
+func (s *MockAzureDevOpsServer) writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"$id": "1", "message": message})
+}
+
+//SetupAzureDevOpsTestServer starts a MockAzureDevOpsServer for the
+//organization/project project and returns a client that authenticates
+//with it, the server is also the Azure DevOps base URL
+func SetupAzureDevOpsTestServer(
+	t *testing.T,
+) (*MockAzureDevOpsServer, *httptest.Server, *http.Client) {
+	mock := &MockAzureDevOpsServer{
+		Organization: "organization",
+		Project:      "project",
+		Token:        "devops-pat",
+	}
+	server, client := setupHTTPTestServer(mock, &httpapi.BasicAuthTransport{Password: mock.Token})
+	return mock, server, client
+}
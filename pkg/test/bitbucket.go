@@ -0,0 +1,220 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/httpapi"
+)
+
+//MockBitbucketVariable is a Pipelines variable held by the MockBitbucketServer
+type MockBitbucketVariable struct {
+	UUID    string `json:"uuid"`
+	Key     string `json:"key"`
+	Value   string `json:"value,omitempty"`
+	Secured bool   `json:"secured"`
+}
+
+//MockBitbucketEnvironment is a deployment environment
+//of the repository of the MockBitbucketServer
+type MockBitbucketEnvironment struct {
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+}
+
+//MockBitbucketServer is a stand-in for the Bitbucket Cloud API that
+//keeps the Pipelines variables of a single repository, lists are
+//returned in pages of two so paging is exercised
+type MockBitbucketServer struct {
+	mu sync.Mutex
+
+	// The repository e.g workspace/repo_slug
+	Repository string
+
+	// The deployment environments of the repository
+	Environments []MockBitbucketEnvironment
+
+	// The variables of the repository under "" and the variables
+	// of the deployment environments under their UUID
+	Variables map[string][]MockBitbucketVariable
+
+	created int
+}
+
+func (s *MockBitbucketServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer bitbucket-token" {
+		s.writeError(w, http.StatusUnauthorized, "Access token expired")
+		return
+	}
+	repository := fmt.Sprintf("/repositories/%s", s.Repository)
+	if !strings.HasPrefix(r.URL.Path, repository+"/") {
+		s.writeError(w, http.StatusNotFound, "Repository not found")
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, repository)
+	if path == "/environments/" && r.Method == http.MethodGet {
+		values := []interface{}{}
+		for _, environment := range s.Environments {
+			values = append(values, environment)
+		}
+		s.writePage(w, r, values)
+		return
+	}
+	scope := ""
+	switch {
+	case strings.HasPrefix(path, "/pipelines_config/variables/"):
+		path = strings.TrimPrefix(path, "/pipelines_config/variables/")
+	case strings.HasPrefix(path, "/deployments_config/environments/"):
+		parts := strings.SplitN(
+			strings.TrimPrefix(path, "/deployments_config/environments/"),
+			"/",
+			2,
+		)
+		if len(parts) != 2 || !strings.HasPrefix(parts[1], "variables/") {
+			s.writeError(w, http.StatusNotFound, "Not found")
+			return
+		}
+		scope = parts[0]
+		path = strings.TrimPrefix(parts[1], "variables/")
+		if !s.hasEnvironment(scope) {
+			s.writeError(w, http.StatusNotFound, "Environment not found")
+			return
+		}
+	default:
+		s.writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	s.serveVariables(w, r, scope, path)
+}
+
+//serveVariables lists and creates the variables of the scope
+//when the path is empty, otherwise it updates or deletes one
+func (s *MockBitbucketServer) serveVariables(
+	w http.ResponseWriter,
+	r *http.Request,
+	scope string,
+	path string,
+) {
+	if s.Variables == nil {
+		s.Variables = map[string][]MockBitbucketVariable{}
+	}
+	variables := s.Variables[scope]
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			values := []interface{}{}
+			for _, variable := range variables {
+				if variable.Secured {
+					variable.Value = ""
+				}
+				values = append(values, variable)
+			}
+			s.writePage(w, r, values)
+		case http.MethodPost:
+			variable := MockBitbucketVariable{}
+			json.NewDecoder(r.Body).Decode(&variable)
+			for _, existing := range variables {
+				if existing.Key == variable.Key {
+					s.writeError(w, http.StatusConflict, "Variable already exists")
+					return
+				}
+			}
+			s.created++
+			variable.UUID = fmt.Sprintf("{variable-%d}", s.created)
+			s.Variables[scope] = append(variables, variable)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(variable)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+	for i, variable := range variables {
+		if variable.UUID != path {
+			continue
+		}
+		switch r.Method {
+		case http.MethodPut:
+			update := MockBitbucketVariable{}
+			json.NewDecoder(r.Body).Decode(&update)
+			update.UUID = variable.UUID
+			variables[i] = update
+			json.NewEncoder(w).Encode(update)
+		case http.MethodDelete:
+			s.Variables[scope] = append(variables[:i], variables[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+	s.writeError(w, http.StatusNotFound, "Variable not found")
+}
+
+//hasEnvironment returns if the repository has the deployment environment
+func (s *MockBitbucketServer) hasEnvironment(uuid string) bool {
+	for _, environment := range s.Environments {
+		if environment.UUID == uuid {
+			return true
+		}
+	}
+	return false
+}
+
+//writePage responds with the page of values in the
+//page query parameter and the URL of the next page
+func (s *MockBitbucketServer) writePage(
+	w http.ResponseWriter,
+	r *http.Request,
+	values []interface{},
+) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	start := (page - 1) * 2
+	if start > len(values) {
+		start = len(values)
+	}
+	end := start + 2
+	body := map[string]interface{}{"page": page}
+	if end < len(values) {
+		next := *r.URL
+		query := next.Query()
+		query.Set("page", strconv.Itoa(page+1))
+		next.RawQuery = query.Encode()
+		next.Scheme = "http"
+		next.Host = r.Host
+		body["next"] = next.String()
+	} else {
+		end = len(values)
+	}
+	body["values"] = values[start:end]
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+//writeError responds with an error in the Bitbucket format
+func (s *MockBitbucketServer) writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"type":  "error",
+		"error": map[string]string{"message": message},
+	})
+}
+
+//SetupBitbucketTestServer starts a MockBitbucketServer for the workspace/repo
+//repository and returns a client that authenticates with it,
+//the server is also the Bitbucket base URL
+func SetupBitbucketTestServer(t *testing.T) (*MockBitbucketServer, *httptest.Server, *http.Client) {
+	mock := &MockBitbucketServer{Repository: "workspace/repo"}
+	server, client := setupHTTPTestServer(mock, httpapi.BearerTransport("bitbucket-token", nil))
+	return mock, server, client
+}
@@ -0,0 +1,138 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+	storage "google.golang.org/api/storage/v1"
+)
+
+//MockHMACKey is an HMAC key held by the MockHMACServer
+type MockHMACKey struct {
+	AccessID       string
+	Secret         string
+	State          string
+	ServiceAccount string
+	TimeCreated    time.Time
+}
+
+//MockHMACServer is a stand-in for the HMAC key
+//endpoints of the Google Cloud Storage JSON API
+type MockHMACServer struct {
+	mu sync.Mutex
+
+	// The HMAC keys of the project
+	Keys []MockHMACKey
+
+	// If set, all calls fail with this status
+	ErrStatus int
+
+	created int
+}
+
+func (k MockHMACKey) metadata() *storage.HmacKeyMetadata {
+	return &storage.HmacKeyMetadata{
+		AccessId:            k.AccessID,
+		ServiceAccountEmail: k.ServiceAccount,
+		State:               k.State,
+		TimeCreated:         k.TimeCreated.UTC().Format(time.RFC3339),
+	}
+}
+
+func (s *MockHMACServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ErrStatus != 0 {
+		s.writeError(w, s.ErrStatus)
+		return
+	}
+	// paths are /storage/v1/projects/<project>/hmacKeys[/<access id>]
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/storage/v1/"), "/")
+	if len(parts) < 3 || parts[0] != "projects" || parts[2] != "hmacKeys" {
+		s.writeError(w, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if len(parts) == 3 {
+		switch r.Method {
+		case http.MethodPost:
+			s.created++
+			key := MockHMACKey{
+				AccessID:       fmt.Sprintf("GOOG1NEW%d", s.created),
+				Secret:         fmt.Sprintf("secret-%d", s.created),
+				State:          "ACTIVE",
+				ServiceAccount: r.URL.Query().Get("serviceAccountEmail"),
+				TimeCreated:    time.Now(),
+			}
+			s.Keys = append(s.Keys, key)
+			json.NewEncoder(w).Encode(&storage.HmacKey{
+				Metadata: key.metadata(),
+				Secret:   key.Secret,
+			})
+		case http.MethodGet:
+			items := []*storage.HmacKeyMetadata{}
+			for _, key := range s.Keys {
+				if key.ServiceAccount == r.URL.Query().Get("serviceAccountEmail") {
+					items = append(items, key.metadata())
+				}
+			}
+			json.NewEncoder(w).Encode(&storage.HmacKeysMetadata{Items: items})
+		}
+		return
+	}
+	for i, key := range s.Keys {
+		if key.AccessID != parts[3] {
+			continue
+		}
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(key.metadata())
+		case http.MethodPut:
+			update := storage.HmacKeyMetadata{}
+			json.NewDecoder(r.Body).Decode(&update)
+			s.Keys[i].State = update.State
+			json.NewEncoder(w).Encode(s.Keys[i].metadata())
+		case http.MethodDelete:
+			// like the real API active keys can't be deleted
+			if key.State == "ACTIVE" {
+				s.writeError(w, http.StatusBadRequest)
+				return
+			}
+			s.Keys = append(s.Keys[:i], s.Keys[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+	s.writeError(w, http.StatusNotFound)
+}
+
+//writeError responds with an error in the Google API format
+func (s *MockHMACServer) writeError(w http.ResponseWriter, status int) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{"code": status, "message": http.StatusText(status)},
+	})
+}
+
+//SetupHMACTestServer starts a MockHMACServer and returns a storage service using it
+func SetupHMACTestServer(t *testing.T) (*MockHMACServer, *httptest.Server, *storage.Service) {
+	mock := &MockHMACServer{}
+	server := httptest.NewServer(mock)
+	service, err := storage.NewService(
+		context.Background(),
+		option.WithEndpoint(server.URL+"/storage/v1/"),
+		option.WithoutAuthentication(),
+	)
+	if err != nil {
+		server.Close()
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	return mock, server, service
+}
@@ -6,10 +6,12 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 
 	"github.com/golang/protobuf/ptypes"
+	"github.com/google/go-github/v35/github"
 	"github.com/xanzy/go-gitlab"
 	adminpb "google.golang.org/genproto/googleapis/iam/admin/v1"
 	"google.golang.org/grpc/metadata"
@@ -34,9 +36,20 @@ type MockIamServer struct {
 	Err error
 
 	// responses to return if err == nil
+	// each call consumes one response, the last
+	// response is returned for any remaining calls
 	Resps []proto.Message
 }
 
+//nextResp pops the next queued response
+func (s *MockIamServer) nextResp() proto.Message {
+	resp := s.Resps[0]
+	if len(s.Resps) > 1 {
+		s.Resps = s.Resps[1:]
+	}
+	return resp
+}
+
 func (s *MockIamServer) CreateServiceAccountKey(
 	ctx context.Context,
 	req *adminpb.CreateServiceAccountKeyRequest,
@@ -49,7 +62,7 @@ func (s *MockIamServer) CreateServiceAccountKey(
 	if s.Err != nil {
 		return nil, s.Err
 	}
-	return s.Resps[0].(*adminpb.ServiceAccountKey), nil
+	return s.nextResp().(*adminpb.ServiceAccountKey), nil
 }
 
 func (s *MockIamServer) ListServiceAccountKeys(
@@ -64,7 +77,7 @@ func (s *MockIamServer) ListServiceAccountKeys(
 	if s.Err != nil {
 		return nil, s.Err
 	}
-	return s.Resps[0].(*adminpb.ListServiceAccountKeysResponse), nil
+	return s.nextResp().(*adminpb.ListServiceAccountKeysResponse), nil
 }
 
 func (s *MockIamServer) DeleteServiceAccountKey(
@@ -79,7 +92,7 @@ func (s *MockIamServer) DeleteServiceAccountKey(
 	if s.Err != nil {
 		return nil, s.Err
 	}
-	return s.Resps[0].(*emptypb.Empty), nil
+	return s.nextResp().(*emptypb.Empty), nil
 }
 
 func SetupGitlabTestServer(t *testing.T) (*http.ServeMux, *httptest.Server, *gitlab.Client) {
@@ -98,3 +111,22 @@ func SetupGitlabTestServer(t *testing.T) (*http.ServeMux, *httptest.Server, *git
 
 	return mux, server, client
 }
+
+func SetupGithubTestServer(t *testing.T) (*http.ServeMux, *httptest.Server, *github.Client) {
+	// mux is the HTTP request multiplexer used with the test server.
+	mux := http.NewServeMux()
+
+	// server is a test HTTP server used to provide mock API responses.
+	server := httptest.NewServer(mux)
+
+	// client is the Github client being tested.
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		server.Close()
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	client.BaseURL = baseURL
+
+	return mux, server, client
+}
@@ -0,0 +1,25 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+)
+
+//writeJSON responds with the body encoded as JSON,
+//the mock servers use it for their error formats
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+//setupHTTPTestServer starts a test server for the mock and returns
+//a client that authenticates with it through the transport
+func setupHTTPTestServer(
+	mock http.Handler,
+	transport http.RoundTripper,
+) (*httptest.Server, *http.Client) {
+	server := httptest.NewServer(mock)
+	return server, &http.Client{Transport: transport}
+}
@@ -0,0 +1,226 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//MockSecretManagerServer is an in memory Secret Manager that keeps
+//the secrets and their versions, versions are numbered from 1
+type MockSecretManagerServer struct {
+	// Embed for forward compatibility.
+	// Tests will keep working if more methods are added
+	// in the future.
+	secretmanagerpb.SecretManagerServiceServer
+
+	mu sync.Mutex
+
+	// The secrets by name
+	Secrets map[string]*secretmanagerpb.Secret
+
+	// The versions of each secret by the name of the secret
+	Versions map[string][]*secretmanagerpb.SecretVersion
+
+	// The payload of each version by the name of the version
+	Payloads map[string][]byte
+
+	// If set, all calls return this error.
+	Err error
+}
+
+//Reset removes all the secrets from the server
+func (s *MockSecretManagerServer) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Secrets = map[string]*secretmanagerpb.Secret{}
+	s.Versions = map[string][]*secretmanagerpb.SecretVersion{}
+	s.Payloads = map[string][]byte{}
+	s.Err = nil
+}
+
+func (s *MockSecretManagerServer) CreateSecret(
+	ctx context.Context,
+	req *secretmanagerpb.CreateSecretRequest,
+) (*secretmanagerpb.Secret, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	name := fmt.Sprintf("%s/secrets/%s", req.Parent, req.SecretId)
+	if _, exists := s.Secrets[name]; exists {
+		return nil, status.Errorf(codes.AlreadyExists, "secret %s already exists", name)
+	}
+	secret := proto.Clone(req.Secret).(*secretmanagerpb.Secret)
+	secret.Name = name
+	secret.CreateTime = timestamppb.Now()
+	s.Secrets[name] = secret
+	return secret, nil
+}
+
+func (s *MockSecretManagerServer) GetSecret(
+	ctx context.Context,
+	req *secretmanagerpb.GetSecretRequest,
+) (*secretmanagerpb.Secret, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	secret, exists := s.Secrets[req.Name]
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "secret %s not found", req.Name)
+	}
+	return secret, nil
+}
+
+func (s *MockSecretManagerServer) UpdateSecret(
+	ctx context.Context,
+	req *secretmanagerpb.UpdateSecretRequest,
+) (*secretmanagerpb.Secret, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	secret, exists := s.Secrets[req.Secret.Name]
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "secret %s not found", req.Secret.Name)
+	}
+	for _, path := range req.UpdateMask.GetPaths() {
+		if path != "labels" {
+			return nil, status.Errorf(codes.InvalidArgument, "unsupported update mask %s", path)
+		}
+		secret.Labels = req.Secret.Labels
+	}
+	return secret, nil
+}
+
+func (s *MockSecretManagerServer) DeleteSecret(
+	ctx context.Context,
+	req *secretmanagerpb.DeleteSecretRequest,
+) (*emptypb.Empty, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	if _, exists := s.Secrets[req.Name]; !exists {
+		return nil, status.Errorf(codes.NotFound, "secret %s not found", req.Name)
+	}
+	delete(s.Secrets, req.Name)
+	delete(s.Versions, req.Name)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *MockSecretManagerServer) AddSecretVersion(
+	ctx context.Context,
+	req *secretmanagerpb.AddSecretVersionRequest,
+) (*secretmanagerpb.SecretVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	if _, exists := s.Secrets[req.Parent]; !exists {
+		return nil, status.Errorf(codes.NotFound, "secret %s not found", req.Parent)
+	}
+	version := &secretmanagerpb.SecretVersion{
+		Name:       fmt.Sprintf("%s/versions/%d", req.Parent, len(s.Versions[req.Parent])+1),
+		CreateTime: timestamppb.Now(),
+		State:      secretmanagerpb.SecretVersion_ENABLED,
+	}
+	s.Versions[req.Parent] = append(s.Versions[req.Parent], version)
+	s.Payloads[version.Name] = req.Payload.GetData()
+	return version, nil
+}
+
+func (s *MockSecretManagerServer) ListSecretVersions(
+	ctx context.Context,
+	req *secretmanagerpb.ListSecretVersionsRequest,
+) (*secretmanagerpb.ListSecretVersionsResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	if _, exists := s.Secrets[req.Parent]; !exists {
+		return nil, status.Errorf(codes.NotFound, "secret %s not found", req.Parent)
+	}
+	// like Secret Manager the newest version is listed first
+	versions := []*secretmanagerpb.SecretVersion{}
+	for i := len(s.Versions[req.Parent]) - 1; i >= 0; i-- {
+		versions = append(versions, s.Versions[req.Parent][i])
+	}
+	return &secretmanagerpb.ListSecretVersionsResponse{
+		Versions:  versions,
+		TotalSize: int32(len(versions)),
+	}, nil
+}
+
+func (s *MockSecretManagerServer) AccessSecretVersion(
+	ctx context.Context,
+	req *secretmanagerpb.AccessSecretVersionRequest,
+) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	version, err := s.version(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if version.State != secretmanagerpb.SecretVersion_ENABLED {
+		return nil, status.Errorf(codes.FailedPrecondition, "version %s is not enabled", version.Name)
+	}
+	return &secretmanagerpb.AccessSecretVersionResponse{
+		Name:    version.Name,
+		Payload: &secretmanagerpb.SecretPayload{Data: s.Payloads[version.Name]},
+	}, nil
+}
+
+func (s *MockSecretManagerServer) DisableSecretVersion(
+	ctx context.Context,
+	req *secretmanagerpb.DisableSecretVersionRequest,
+) (*secretmanagerpb.SecretVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	version, err := s.version(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	version.State = secretmanagerpb.SecretVersion_DISABLED
+	return version, nil
+}
+
+//version looks up a version by its name, the latest
+//alias resolves to the newest version
+func (s *MockSecretManagerServer) version(name string) (*secretmanagerpb.SecretVersion, error) {
+	parts := strings.SplitN(name, "/versions/", 2)
+	versions, exists := s.Versions[parts[0]]
+	if !exists || len(parts) != 2 || len(versions) == 0 {
+		return nil, status.Errorf(codes.NotFound, "version %s not found", name)
+	}
+	if parts[1] == "latest" {
+		return versions[len(versions)-1], nil
+	}
+	for _, version := range versions {
+		if version.Name == name {
+			return version, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "version %s not found", name)
+}
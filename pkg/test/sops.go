@@ -0,0 +1,69 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/require"
+	mozillasops "go.mozilla.org/sops/v3"
+	"go.mozilla.org/sops/v3/aes"
+	sopsage "go.mozilla.org/sops/v3/age"
+	"go.mozilla.org/sops/v3/cmd/sops/common"
+	"go.mozilla.org/sops/v3/cmd/sops/formats"
+	"go.mozilla.org/sops/v3/keys"
+	"go.mozilla.org/sops/v3/version"
+)
+
+//SetupSOPSKey generates an age key that SOPS documents are
+//encrypted with and points SOPS_AGE_KEY_FILE at it, it
+//returns the recipient of the key
+func SetupSOPSKey(t *testing.T) string {
+	assertions := require.New(t)
+	identity, err := age.GenerateX25519Identity()
+	assertions.NoError(err)
+	keyFile := filepath.Join(t.TempDir(), "keys.txt")
+	assertions.NoError(ioutil.WriteFile(keyFile, []byte(identity.String()+"\n"), 0600))
+	previous, hadPrevious := os.LookupEnv("SOPS_AGE_KEY_FILE")
+	os.Setenv("SOPS_AGE_KEY_FILE", keyFile)
+	t.Cleanup(func() {
+		if hadPrevious {
+			os.Setenv("SOPS_AGE_KEY_FILE", previous)
+			return
+		}
+		os.Unsetenv("SOPS_AGE_KEY_FILE")
+	})
+	return identity.Recipient().String()
+}
+
+//WriteSOPSFile encrypts the plain YAML or JSON document for the
+//age recipient the same way `sops --encrypt` does and writes it to path
+func WriteSOPSFile(t *testing.T, recipient string, path string, plain string) {
+	assertions := require.New(t)
+	store := common.StoreForFormat(formats.FormatForPath(path))
+	branches, err := store.LoadPlainFile([]byte(plain))
+	assertions.NoError(err)
+	key, err := sopsage.MasterKeyFromRecipient(recipient)
+	assertions.NoError(err)
+	tree := mozillasops.Tree{
+		Branches: branches,
+		Metadata: mozillasops.Metadata{
+			KeyGroups:         []mozillasops.KeyGroup{{keys.MasterKey(key)}},
+			UnencryptedSuffix: "_unencrypted",
+			Version:           version.Version,
+		},
+	}
+	dataKey, errs := tree.GenerateDataKey()
+	assertions.Empty(errs)
+	err = common.EncryptTree(common.EncryptTreeOpts{
+		Tree:    &tree,
+		Cipher:  aes.NewCipher(),
+		DataKey: dataKey,
+	})
+	assertions.NoError(err)
+	data, err := store.EmitEncryptedFile(tree)
+	assertions.NoError(err)
+	assertions.NoError(ioutil.WriteFile(path, data, 0600))
+}
@@ -0,0 +1,193 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/httpapi"
+)
+
+//MockKVSecret is a KV v2 secret held by the MockVaultServer
+type MockKVSecret struct {
+	// Every version of the secret, the first version is 1
+	Versions []map[string]interface{}
+
+	// If the latest version was deleted
+	Deleted bool
+}
+
+//MockVaultServer is a stand-in for Vault with a KV v2 secrets
+//engine mounted at secret, a KV v1 secrets engine mounted at kv
+//and the approle and kubernetes auth methods
+type MockVaultServer struct {
+	mu sync.Mutex
+
+	// The token requests need to have, it is
+	// also the token returned by logins
+	Token string
+
+	// The role ID and secret ID accepted by the approle login
+	RoleID   string
+	SecretID string
+
+	// The role and service account token accepted by the kubernetes login
+	Role string
+	JWT  string
+
+	// The number of successful logins
+	Logins int
+
+	// The secrets of the KV v2 engine by path
+	Secrets map[string]*MockKVSecret
+
+	// The secrets of the KV v1 engine by path
+	V1Secrets map[string]map[string]interface{}
+}
+
+func (s *MockVaultServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if strings.HasPrefix(r.URL.Path, "/v1/auth/") {
+		s.login(w, r)
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != s.Token {
+		s.writeError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/secret/data/"):
+		s.serveKV2(w, r, strings.TrimPrefix(r.URL.Path, "/v1/secret/data/"))
+	case strings.HasPrefix(r.URL.Path, "/v1/kv/"):
+		s.serveKV1(w, r, strings.TrimPrefix(r.URL.Path, "/v1/kv/"))
+	default:
+		s.writeError(w, http.StatusNotFound)
+	}
+}
+
+//login issues the token to requests with the expected
+//credentials of the approle or kubernetes auth method
+func (s *MockVaultServer) login(w http.ResponseWriter, r *http.Request) {
+	body := map[string]string{}
+	json.NewDecoder(r.Body).Decode(&body)
+	valid := false
+	switch r.URL.Path {
+	case "/v1/auth/approle/login":
+		valid = body["role_id"] == s.RoleID && body["secret_id"] == s.SecretID
+	case "/v1/auth/kubernetes/login":
+		valid = body["role"] == s.Role && body["jwt"] == s.JWT
+	}
+	if !valid {
+		s.writeError(w, http.StatusBadRequest, "invalid credentials")
+		return
+	}
+	s.Logins++
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"auth": map[string]interface{}{"client_token": s.Token},
+	})
+}
+
+func (s *MockVaultServer) serveKV2(w http.ResponseWriter, r *http.Request, path string) {
+	secret, exists := s.Secrets[path]
+	switch r.Method {
+	case http.MethodGet:
+		if !exists {
+			s.writeError(w, http.StatusNotFound)
+			return
+		}
+		version := len(secret.Versions)
+		var data map[string]interface{}
+		if secret.Deleted {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			data = secret.Versions[version-1]
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     data,
+				"metadata": map[string]interface{}{"version": version},
+			},
+		})
+	case http.MethodPost, http.MethodPut:
+		body := struct {
+			Options map[string]int         `json:"options"`
+			Data    map[string]interface{} `json:"data"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if !exists {
+			secret = &MockKVSecret{}
+		}
+		if cas, ok := body.Options["cas"]; ok && cas != len(secret.Versions) {
+			s.writeError(
+				w,
+				http.StatusBadRequest,
+				"check-and-set parameter did not match the current version",
+			)
+			return
+		}
+		secret.Versions = append(secret.Versions, body.Data)
+		secret.Deleted = false
+		if s.Secrets == nil {
+			s.Secrets = map[string]*MockKVSecret{}
+		}
+		s.Secrets[path] = secret
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"version": len(secret.Versions)},
+		})
+	case http.MethodDelete:
+		if exists {
+			secret.Deleted = true
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *MockVaultServer) serveKV1(w http.ResponseWriter, r *http.Request, path string) {
+	switch r.Method {
+	case http.MethodGet:
+		data, exists := s.V1Secrets[path]
+		if !exists {
+			s.writeError(w, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	case http.MethodPost, http.MethodPut:
+		data := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&data)
+		if s.V1Secrets == nil {
+			s.V1Secrets = map[string]map[string]interface{}{}
+		}
+		s.V1Secrets[path] = data
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		delete(s.V1Secrets, path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+//writeError responds with an error in the Vault format
+func (s *MockVaultServer) writeError(w http.ResponseWriter, status int, messages ...string) {
+	if messages == nil {
+		messages = []string{}
+	}
+	writeJSON(w, status, map[string]interface{}{"errors": messages})
+}
+
+//SetupVaultTestServer starts a MockVaultServer and returns
+//a client that sends the token the server expects
+func SetupVaultTestServer(t *testing.T) (*MockVaultServer, *httptest.Server, *http.Client) {
+	mock := &MockVaultServer{
+		Token:   "vault-token",
+		Secrets: map[string]*MockKVSecret{},
+	}
+	server, client := setupHTTPTestServer(
+		mock,
+		&httpapi.HeaderTransport{Name: "X-Vault-Token", Value: mock.Token},
+	)
+	return mock, server, client
+}
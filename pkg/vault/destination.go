@@ -0,0 +1,78 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+)
+
+func init() {
+	destination.Register("vault-kv", NewKVDestination)
+}
+
+//KVDestination writes credentials to a field of a secret
+//in a Vault KV secrets engine
+type KVDestination struct {
+	client  *http.Client
+	address string
+}
+
+//NewKVDestination creates a KVDestination from the configuration
+func NewKVDestination(cfg *config.Config) (destination.Destination, error) {
+	if cfg.VaultClient == nil {
+		return nil, fmt.Errorf("vault client is not configured, set the vault address")
+	}
+	return &KVDestination{
+		client:  cfg.VaultClient,
+		address: cfg.Vault.Address,
+	}, nil
+}
+
+//Write sets the value on the field of the secret
+func (d *KVDestination) Write(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+) error {
+	_, err := d.WriteVersion(ctx, cred, value)
+	return err
+}
+
+//WriteVersion sets the value on the field of the secret
+//and returns the version written on KV v2
+func (d *KVDestination) WriteVersion(
+	ctx context.Context,
+	cred *config.Credential,
+	value string,
+) (string, error) {
+	return UpdateKV(ctx, d.client, d.address, cred, value)
+}
+
+//Read returns the current value of the field of the secret
+func (d *KVDestination) Read(
+	ctx context.Context,
+	cred *config.Credential,
+) (string, error) {
+	return GetKV(ctx, d.client, d.address, cred)
+}
+
+//Delete removes the field from the secret
+func (d *KVDestination) Delete(
+	ctx context.Context,
+	cred *config.Credential,
+) error {
+	return RemoveKVField(ctx, d.client, d.address, cred)
+}
+
+//Describe returns the field of the secret that is written to
+func (d *KVDestination) Describe(cred *config.Credential) string {
+	return fmt.Sprintf(
+		"field %s of vault secret %s/%s",
+		cred.Variable,
+		mount(cred),
+		cred.VaultPath,
+	)
+}
@@ -0,0 +1,224 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/Spazzy757/credentials-rotator/pkg/httpapi"
+)
+
+//vaultError is the error body returned by Vault
+type vaultError struct {
+	Errors []string `json:"errors"`
+}
+
+//kvSecret is a secret read from a KV secrets engine
+type kvSecret struct {
+	// The fields of the secret
+	Data map[string]interface{}
+
+	// The current version of a KV v2 secret,
+	// zero when the secret has never been written
+	Version int
+}
+
+//mount returns the mount of the credentials
+//KV secrets engine, defaulting to secret
+func mount(cred *config.Credential) string {
+	if cred.VaultMount == "" {
+		return "secret"
+	}
+	return strings.Trim(cred.VaultMount, "/")
+}
+
+//kvVersion returns the version of the credentials
+//KV secrets engine, defaulting to 2
+func kvVersion(cred *config.Credential) int {
+	if cred.VaultKVVersion == 0 {
+		return 2
+	}
+	return cred.VaultKVVersion
+}
+
+//secretURL returns the URL the credentials secret is read from and written to
+func secretURL(address string, cred *config.Credential) string {
+	address = strings.TrimSuffix(address, "/")
+	path := strings.Trim(cred.VaultPath, "/")
+	if kvVersion(cred) == 1 {
+		return fmt.Sprintf("%s/v1/%s/%s", address, mount(cred), path)
+	}
+	return fmt.Sprintf("%s/v1/%s/data/%s", address, mount(cred), path)
+}
+
+//vaultErrorMessage returns the messages of a Vault error
+func vaultErrorMessage(body []byte) string {
+	vaultErr := vaultError{}
+	if json.Unmarshal(body, &vaultErr) != nil {
+		return ""
+	}
+	return strings.Join(vaultErr.Errors, ", ")
+}
+
+//doVaultRequest sends a request to Vault and decodes the response
+//into out if it is set, a not found response is still decoded as
+//Vault returns the metadata of deleted KV v2 secrets with it
+func doVaultRequest(
+	ctx context.Context,
+	client *http.Client,
+	method string,
+	requestURL string,
+	body interface{},
+	out interface{},
+) error {
+	api := &httpapi.Client{
+		HTTP:           client,
+		ErrorMessage:   vaultErrorMessage,
+		NotFound:       destination.ErrNotFound,
+		DecodeNotFound: true,
+	}
+	return api.Do(ctx, method, requestURL, body, out)
+}
+
+//readKV reads the credentials secret, if it doesn't exist
+//destination.ErrNotFound is returned along with the version
+//of the secret in case the secret was deleted
+func readKV(
+	ctx context.Context,
+	client *http.Client,
+	address string,
+	cred *config.Credential,
+) (*kvSecret, error) {
+	if kvVersion(cred) == 1 {
+		resp := struct {
+			Data map[string]interface{} `json:"data"`
+		}{}
+		err := doVaultRequest(ctx, client, http.MethodGet, secretURL(address, cred), nil, &resp)
+		return &kvSecret{Data: resp.Data}, err
+	}
+	resp := struct {
+		Data struct {
+			Data     map[string]interface{} `json:"data"`
+			Metadata struct {
+				Version int `json:"version"`
+			} `json:"metadata"`
+		} `json:"data"`
+	}{}
+	err := doVaultRequest(ctx, client, http.MethodGet, secretURL(address, cred), nil, &resp)
+	return &kvSecret{
+		Data:    resp.Data.Data,
+		Version: resp.Data.Metadata.Version,
+	}, err
+}
+
+//writeKV writes the fields to the credentials secret, KV v2
+//secrets are only written if they are still at the version
+//that was read and the version written is returned
+func writeKV(
+	ctx context.Context,
+	client *http.Client,
+	address string,
+	cred *config.Credential,
+	secret *kvSecret,
+) (string, error) {
+	if kvVersion(cred) == 1 {
+		return "", doVaultRequest(ctx, client, http.MethodPost, secretURL(address, cred), secret.Data, nil)
+	}
+	body := map[string]interface{}{
+		"options": map[string]interface{}{"cas": secret.Version},
+		"data":    secret.Data,
+	}
+	resp := struct {
+		Data struct {
+			Version int `json:"version"`
+		} `json:"data"`
+	}{}
+	err := doVaultRequest(ctx, client, http.MethodPost, secretURL(address, cred), body, &resp)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(resp.Data.Version), nil
+}
+
+//UpdateKV sets the value on the field of the credentials
+//secret keeping its other fields, the secret is created if it
+//is missing, on KV v2 the write fails if the secret was changed
+//since it was read and the version written is returned
+func UpdateKV(
+	ctx context.Context,
+	client *http.Client,
+	address string,
+	cred *config.Credential,
+	value string,
+) (string, error) {
+	secret, err := readKV(ctx, client, address, cred)
+	if err != nil && !errors.Is(err, destination.ErrNotFound) {
+		return "", err
+	}
+	if secret.Data == nil {
+		secret.Data = map[string]interface{}{}
+	}
+	secret.Data[cred.Variable] = value
+	return writeKV(ctx, client, address, cred, secret)
+}
+
+//GetKV returns the value of the field of the credentials secret,
+//if the secret or field doesn't exist destination.ErrNotFound is returned
+func GetKV(
+	ctx context.Context,
+	client *http.Client,
+	address string,
+	cred *config.Credential,
+) (string, error) {
+	secret, err := readKV(ctx, client, address, cred)
+	if err != nil {
+		return "", err
+	}
+	value, ok := secret.Data[cred.Variable]
+	if !ok {
+		return "", fmt.Errorf(
+			"field %s of %s/%s: %w",
+			cred.Variable,
+			mount(cred),
+			cred.VaultPath,
+			destination.ErrNotFound,
+		)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+//RemoveKVField removes the field from the credentials secret,
+//the secret is deleted once it has no fields left
+func RemoveKVField(
+	ctx context.Context,
+	client *http.Client,
+	address string,
+	cred *config.Credential,
+) error {
+	secret, err := readKV(ctx, client, address, cred)
+	if errors.Is(err, destination.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, ok := secret.Data[cred.Variable]; !ok {
+		return nil
+	}
+	delete(secret.Data, cred.Variable)
+	if len(secret.Data) == 0 {
+		// KV v2 only deletes the latest version so it can be undeleted
+		return doVaultRequest(ctx, client, http.MethodDelete, secretURL(address, cred), nil, nil)
+	}
+	_, err = writeKV(ctx, client, address, cred, secret)
+	return err
+}
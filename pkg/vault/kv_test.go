@@ -0,0 +1,224 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Spazzy757/credentials-rotator/pkg/config"
+	"github.com/Spazzy757/credentials-rotator/pkg/destination"
+	"github.com/Spazzy757/credentials-rotator/pkg/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateKV(t *testing.T) {
+	cred := config.Credential{
+		VaultPath: "ci/deployer",
+		Variable:  "credentials",
+	}
+	t.Run("field gets updated and other fields are kept", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupVaultTestServer(t)
+		defer server.Close()
+		mock.Secrets["ci/deployer"] = &test.MockKVSecret{
+			Versions: []map[string]interface{}{
+				{"credentials": "old value", "other": "other value"},
+			},
+		}
+
+		version, err := UpdateKV(context.Background(), client, server.URL, &cred, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("2", version)
+		assertions.Equal(map[string]interface{}{
+			"credentials": "ABCDBC",
+			"other":       "other value",
+		}, mock.Secrets["ci/deployer"].Versions[1])
+	})
+	t.Run("missing secret gets created", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupVaultTestServer(t)
+		defer server.Close()
+
+		version, err := UpdateKV(context.Background(), client, server.URL, &cred, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("1", version)
+		assertions.Equal(
+			map[string]interface{}{"credentials": "ABCDBC"},
+			mock.Secrets["ci/deployer"].Versions[0],
+		)
+	})
+	t.Run("deleted secret gets a new version", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupVaultTestServer(t)
+		defer server.Close()
+		mock.Secrets["ci/deployer"] = &test.MockKVSecret{
+			Versions: []map[string]interface{}{{"credentials": "old value"}},
+			Deleted:  true,
+		}
+
+		version, err := UpdateKV(context.Background(), client, server.URL, &cred, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("2", version)
+		assertions.Equal(map[string]interface{}{"credentials": "ABCDBC"}, mock.Secrets["ci/deployer"].Versions[1])
+	})
+	t.Run("secret changed since it was read is not overwritten", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupVaultTestServer(t)
+		defer server.Close()
+		mock.Secrets["ci/deployer"] = &test.MockKVSecret{
+			Versions: []map[string]interface{}{{"credentials": "old value"}},
+		}
+		secret, err := readKV(context.Background(), client, server.URL, &cred)
+		assertions.NoError(err)
+		// another writer updates the secret in the meantime
+		mock.Secrets["ci/deployer"].Versions = append(
+			mock.Secrets["ci/deployer"].Versions,
+			map[string]interface{}{"credentials": "concurrent value"},
+		)
+		secret.Data["credentials"] = "ABCDBC"
+
+		_, err = writeKV(context.Background(), client, server.URL, &cred, secret)
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "check-and-set")
+		assertions.Len(mock.Secrets["ci/deployer"].Versions, 2)
+	})
+	t.Run("kv v1 secret gets updated", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupVaultTestServer(t)
+		defer server.Close()
+		mock.V1Secrets = map[string]map[string]interface{}{
+			"ci/deployer": {"credentials": "old value", "other": "other value"},
+		}
+		v1 := cred
+		v1.VaultMount = "kv"
+		v1.VaultKVVersion = 1
+
+		version, err := UpdateKV(context.Background(), client, server.URL, &v1, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("", version)
+		assertions.Equal(map[string]interface{}{
+			"credentials": "ABCDBC",
+			"other":       "other value",
+		}, mock.V1Secrets["ci/deployer"])
+	})
+	t.Run("invalid token returns error", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupVaultTestServer(t)
+		defer server.Close()
+		mock.Token = "other-token"
+
+		_, err := UpdateKV(context.Background(), client, server.URL, &cred, "ABCDBC")
+		assertions.Error(err)
+		assertions.Contains(err.Error(), "permission denied")
+	})
+}
+
+func TestGetKV(t *testing.T) {
+	cred := config.Credential{
+		VaultPath: "ci/deployer",
+		Variable:  "credentials",
+	}
+	t.Run("value of the field gets returned", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupVaultTestServer(t)
+		defer server.Close()
+		mock.Secrets["ci/deployer"] = &test.MockKVSecret{
+			Versions: []map[string]interface{}{{"credentials": "old value"}},
+		}
+
+		value, err := GetKV(context.Background(), client, server.URL, &cred)
+		assertions.NoError(err)
+		assertions.Equal("old value", value)
+	})
+	t.Run("missing secret returns not found", func(t *testing.T) {
+		assertions := require.New(t)
+		_, server, client := test.SetupVaultTestServer(t)
+		defer server.Close()
+
+		_, err := GetKV(context.Background(), client, server.URL, &cred)
+		assertions.True(errors.Is(err, destination.ErrNotFound))
+	})
+	t.Run("missing field returns not found", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupVaultTestServer(t)
+		defer server.Close()
+		mock.Secrets["ci/deployer"] = &test.MockKVSecret{
+			Versions: []map[string]interface{}{{"other": "other value"}},
+		}
+
+		_, err := GetKV(context.Background(), client, server.URL, &cred)
+		assertions.True(errors.Is(err, destination.ErrNotFound))
+	})
+}
+
+func TestRemoveKVField(t *testing.T) {
+	cred := config.Credential{
+		VaultPath: "ci/deployer",
+		Variable:  "credentials",
+	}
+	t.Run("only the field gets removed", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupVaultTestServer(t)
+		defer server.Close()
+		mock.Secrets["ci/deployer"] = &test.MockKVSecret{
+			Versions: []map[string]interface{}{
+				{"credentials": "old value", "other": "other value"},
+			},
+		}
+
+		err := RemoveKVField(context.Background(), client, server.URL, &cred)
+		assertions.NoError(err)
+		assertions.Equal(
+			map[string]interface{}{"other": "other value"},
+			mock.Secrets["ci/deployer"].Versions[1],
+		)
+	})
+	t.Run("secret without other fields gets deleted", func(t *testing.T) {
+		assertions := require.New(t)
+		mock, server, client := test.SetupVaultTestServer(t)
+		defer server.Close()
+		mock.Secrets["ci/deployer"] = &test.MockKVSecret{
+			Versions: []map[string]interface{}{{"credentials": "old value"}},
+		}
+
+		err := RemoveKVField(context.Background(), client, server.URL, &cred)
+		assertions.NoError(err)
+		assertions.True(mock.Secrets["ci/deployer"].Deleted)
+	})
+	t.Run("missing secret is ignored", func(t *testing.T) {
+		assertions := require.New(t)
+		_, server, client := test.SetupVaultTestServer(t)
+		defer server.Close()
+
+		err := RemoveKVField(context.Background(), client, server.URL, &cred)
+		assertions.NoError(err)
+	})
+}
+
+func TestKVDestination(t *testing.T) {
+	t.Run("missing client returns an error", func(t *testing.T) {
+		assertions := require.New(t)
+		_, err := NewKVDestination(&config.Config{})
+		assertions.Error(err)
+	})
+	t.Run("written version gets returned", func(t *testing.T) {
+		assertions := require.New(t)
+		_, server, client := test.SetupVaultTestServer(t)
+		defer server.Close()
+		cfg := &config.Config{
+			VaultClient: client,
+			Vault:       config.VaultConnection{Address: server.URL},
+		}
+		dst, err := NewKVDestination(cfg)
+		assertions.NoError(err)
+		cred := &config.Credential{VaultPath: "ci/deployer", Variable: "credentials"}
+
+		version, err := destination.Write(context.Background(), dst, cred, "ABCDBC")
+		assertions.NoError(err)
+		assertions.Equal("1", version)
+		assertions.Equal(
+			"field credentials of vault secret secret/ci/deployer",
+			destination.Describe(dst, cred),
+		)
+	})
+}